@@ -0,0 +1,26 @@
+// +build !desktop
+
+package cmd
+
+import (
+	"github.com/loophole/cli/internal/pkg/cache"
+	"github.com/spf13/cobra"
+)
+
+// certsCmd represents the certs command
+var certsCmd = &cobra.Command{
+	Use:   "certs",
+	Short: "Group of commands concerning cached TLS certificates",
+	Long:  "Parent for commands managing TLS certificates cached in loophole directory. Always use with one of subcommands",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+func certsDirectory() string {
+	return cache.GetLocalStorageDir("certs")
+}
+
+func init() {
+	rootCmd.AddCommand(certsCmd)
+}
@@ -0,0 +1,46 @@
+// +build !desktop
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/loophole/cli/internal/pkg/certstore"
+	"github.com/loophole/cli/internal/pkg/communication"
+	"github.com/spf13/cobra"
+)
+
+var certsClearCacheCmd = &cobra.Command{
+	Use:   "clear-cache <hostname>",
+	Short: "Remove cached TLS certificates of given hostname",
+	Long: `Removes TLS certificates cached for given hostname, nothing is requested from the certificate authority.
+
+Certificate can be issued only while the tunnel is running, so new one is obtained on the next start of the tunnel for the hostname.
+Use 'loophole certs show <hostname>' after the start to check the new certificate.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		certificates, err := certstore.Find(certsDirectory(), args[0])
+		if err != nil {
+			communication.Fatal(fmt.Sprintf("Failed to read cached certificates: %s", err.Error()))
+		}
+		if len(certificates) == 0 {
+			communication.Fatal(fmt.Sprintf("No cached certificate for %s", args[0]))
+		}
+		for _, certificate := range certificates {
+			if err := certstore.Remove(certificate); err != nil {
+				communication.Fatal(fmt.Sprintf("Failed to remove '%s': %s", certificate.Path, err.Error()))
+			}
+		}
+		communication.Info(fmt.Sprintf("Removed %d cached certificate(s), new certificate for %s will be obtained on the next tunnel start", len(certificates), args[0]))
+	},
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 {
+			return errors.New("Missing argument: hostname")
+		}
+		return nil
+	},
+}
+
+func init() {
+	certsCmd.AddCommand(certsClearCacheCmd)
+}
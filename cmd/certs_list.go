@@ -0,0 +1,62 @@
+// +build !desktop
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/loophole/cli/internal/pkg/certstore"
+	"github.com/loophole/cli/internal/pkg/communication"
+	"github.com/spf13/cobra"
+)
+
+// certificateRenewalWindow is how long before expiry certificate is reported as expiring
+const certificateRenewalWindow = 30 * 24 * time.Hour
+
+var certsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List cached TLS certificates",
+	Long:  "Lists TLS certificates cached in loophole directory with their hostnames, expiry and issuer.",
+	Run: func(cmd *cobra.Command, args []string) {
+		certificates, err := certstore.List(certsDirectory())
+		if err != nil {
+			communication.Fatal(fmt.Sprintf("Failed to read cached certificates: %s", err.Error()))
+		}
+		if len(certificates) == 0 {
+			fmt.Println("No cached certificates")
+			return
+		}
+
+		now := time.Now()
+		writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, "HOSTNAMES\tEXPIRES\tSTATUS\tISSUER\tACME DIRECTORY")
+		for _, certificate := range certificates {
+			directory := certificate.Directory
+			if directory == "" {
+				directory = "default"
+			}
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\n", strings.Join(certificate.Hostnames(), ","),
+				certificate.Leaf.NotAfter.Local().Format("2006-01-02 15:04"), certificateStatus(certificate, now), certificate.Issuer(), directory)
+		}
+		writer.Flush()
+	},
+}
+
+func certificateStatus(certificate *certstore.Certificate, now time.Time) string {
+	switch {
+	case certificate.Expired(now):
+		return "expired"
+	case certificate.Leaf.NotAfter.Sub(now) < certificateRenewalWindow:
+		return "expiring"
+	default:
+		return "valid"
+	}
+}
+
+func init() {
+	certsCmd.AddCommand(certsListCmd)
+}
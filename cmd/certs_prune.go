@@ -0,0 +1,44 @@
+// +build !desktop
+
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/loophole/cli/internal/pkg/certstore"
+	"github.com/loophole/cli/internal/pkg/communication"
+	"github.com/spf13/cobra"
+)
+
+var pruneAllCertificates bool
+
+var certsPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Delete expired TLS certificates",
+	Long:  "Deletes expired TLS certificates from loophole directory, or all of them when used with --all.",
+	Run: func(cmd *cobra.Command, args []string) {
+		certificates, err := certstore.List(certsDirectory())
+		if err != nil {
+			communication.Fatal(fmt.Sprintf("Failed to read cached certificates: %s", err.Error()))
+		}
+
+		now := time.Now()
+		removed := 0
+		for _, certificate := range certificates {
+			if !pruneAllCertificates && !certificate.Expired(now) {
+				continue
+			}
+			if err := certstore.Remove(certificate); err != nil {
+				communication.Fatal(fmt.Sprintf("Failed to remove '%s': %s", certificate.Path, err.Error()))
+			}
+			removed++
+		}
+		communication.Info(fmt.Sprintf("Removed %d cached certificate(s)", removed))
+	},
+}
+
+func init() {
+	certsPruneCmd.Flags().BoolVar(&pruneAllCertificates, "all", false, "delete all cached certificates, not only expired ones")
+	certsCmd.AddCommand(certsPruneCmd)
+}
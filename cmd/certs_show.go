@@ -0,0 +1,64 @@
+// +build !desktop
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/loophole/cli/internal/pkg/certstore"
+	"github.com/loophole/cli/internal/pkg/communication"
+	"github.com/spf13/cobra"
+)
+
+var certsShowCmd = &cobra.Command{
+	Use:   "show <hostname>",
+	Short: "Show details of cached TLS certificate",
+	Long:  "Shows details of TLS certificates cached for given hostname, including the certificate chain and OCSP status.",
+	Run: func(cmd *cobra.Command, args []string) {
+		certificates, err := certstore.Find(certsDirectory(), args[0])
+		if err != nil {
+			communication.Fatal(fmt.Sprintf("Failed to read cached certificates: %s", err.Error()))
+		}
+		if len(certificates) == 0 {
+			communication.Fatal(fmt.Sprintf("No cached certificate for %s", args[0]))
+		}
+
+		httpClient := &http.Client{Timeout: 10 * time.Second}
+		for i, certificate := range certificates {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("File:        %s\n", certificate.Path)
+			fmt.Printf("Hostnames:   %s\n", strings.Join(certificate.Hostnames(), ", "))
+			fmt.Printf("Issuer:      %s\n", certificate.Issuer())
+			fmt.Printf("Serial:      %s\n", certificate.Leaf.SerialNumber.Text(16))
+			fmt.Printf("Valid from:  %s\n", certificate.Leaf.NotBefore.Local().Format(time.RFC1123))
+			fmt.Printf("Valid until: %s (%s)\n", certificate.Leaf.NotAfter.Local().Format(time.RFC1123), certificateStatus(certificate, time.Now()))
+			fmt.Println("Chain:")
+			for _, chainCertificate := range certificate.Chain {
+				fmt.Printf("  - %s\n", chainCertificate.Subject.String())
+			}
+			if len(certificate.Chain) > 1 {
+				status, err := certstore.OCSPStatus(httpClient, certificate.Leaf, certificate.Chain[1])
+				if err != nil {
+					status = fmt.Sprintf("unavailable (%s)", err.Error())
+				}
+				fmt.Printf("OCSP status: %s\n", status)
+			}
+		}
+	},
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 {
+			return errors.New("Missing argument: hostname")
+		}
+		return nil
+	},
+}
+
+func init() {
+	certsCmd.AddCommand(certsShowCmd)
+}
@@ -0,0 +1,22 @@
+//go:build dev && !desktop
+// +build dev,!desktop
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// devCACmd represents the dev-ca command
+var devCACmd = &cobra.Command{
+	Use:   "dev-ca",
+	Short: "Group of commands concerning local development CA",
+	Long:  "Parent for commands managing certificate authority used to issue TLS certificates in development builds. Always use with one of subcommands",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(devCACmd)
+}
@@ -0,0 +1,46 @@
+//go:build dev && !desktop
+// +build dev,!desktop
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/loophole/cli/internal/pkg/cache"
+	"github.com/loophole/cli/internal/pkg/communication"
+	"github.com/loophole/cli/internal/pkg/devca"
+	"github.com/spf13/cobra"
+)
+
+var devCAExportOutput string
+
+var devCAExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export development CA certificate",
+	Long: `Exports PEM encoded certificate of the local development CA, creating the CA if it doesn't exist yet.
+
+Import it once into the system or browser trust store and certificates served by development builds are trusted, e.g.:
+  loophole dev-ca export --output loophole-dev-ca.pem
+  sudo cp loophole-dev-ca.pem /usr/local/share/ca-certificates/loophole-dev-ca.crt && sudo update-ca-certificates`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ca, err := devca.LoadOrCreate(cache.GetLocalStorageDir("dev-ca"))
+		if err != nil {
+			communication.Fatal(err.Error())
+		}
+		if devCAExportOutput == "" {
+			os.Stdout.Write(ca.CertificatePEM())
+			return
+		}
+		if err := ioutil.WriteFile(devCAExportOutput, ca.CertificatePEM(), 0644); err != nil {
+			communication.Fatal(fmt.Sprintf("Failed to write '%s': %s", devCAExportOutput, err.Error()))
+		}
+		communication.Info(fmt.Sprintf("Development CA certificate written to '%s'", devCAExportOutput))
+	},
+}
+
+func init() {
+	devCAExportCmd.Flags().StringVarP(&devCAExportOutput, "output", "o", "", "file to write the certificate to, standard output if not set")
+	devCACmd.AddCommand(devCAExportCmd)
+}
@@ -0,0 +1,142 @@
+// +build !desktop
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/loophole/cli/internal/app/loophole"
+	lm "github.com/loophole/cli/internal/app/loophole/models"
+	"github.com/loophole/cli/internal/pkg/childprocess"
+	"github.com/loophole/cli/internal/pkg/closehandler"
+	"github.com/loophole/cli/internal/pkg/communication"
+	"github.com/loophole/cli/internal/pkg/token"
+	"github.com/loophole/cli/internal/pkg/urlmaker"
+
+	"github.com/spf13/cobra"
+)
+
+// childStopTimeout is time given to the command to exit after being interrupted, before it's killed
+const childStopTimeout = 10 * time.Second
+
+var execInjectEnv bool
+
+var execCmd = &cobra.Command{
+	Use:   "exec --port <port> [flags] -- <command> [args...]",
+	Short: "Run command, e.g. your dev server, and expose the port it listens on to the public",
+	Long: `Runs given command and exposes the port it listens on via loophole tunnel once it's answering.
+
+E.g. 'loophole exec --port 3000 -- npm run dev' starts your dev server and tunnels it.
+The command gets PORT and LOOPHOLE_URL (the public URL of the tunnel) environment variables, use '--inject-env=false' to disable that.
+Signals like Ctrl+C are passed to the command, the tunnel is stopped when the command exits and loophole exits with its status.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		loggedIn := token.IsTokenSaved()
+		idToken := token.GetIdToken()
+		communication.ApplicationStart(loggedIn, idToken)
+
+		checkVersion()
+
+		exposeConfig := lm.ExposeHTTPConfig{
+			Local:  localEndpointSpecs,
+			Remote: remoteEndpointSpecs,
+		}
+
+		authMethod, err := loophole.RegisterTunnel(&exposeConfig.Remote)
+		if err != nil {
+			communication.Fatal(err.Error())
+		}
+
+		env := []string{}
+		if execInjectEnv {
+			env = append(env,
+				fmt.Sprintf("PORT=%d", exposeConfig.Local.Port),
+				fmt.Sprintf("LOOPHOLE_URL=%s", urlmaker.GetSiteURL("https", exposeConfig.Remote.SiteID, exposeConfig.Remote.Domain)))
+		}
+		restoreTerminal := closehandler.SaveTerminalState()
+		child, err := childprocess.Start(args, env)
+		if err != nil {
+			communication.Fatal(fmt.Sprintf("Failed to run '%s': %v", args[0], err))
+		}
+		stopForwarding := child.ForwardSignals()
+		removeSink := communication.AddSink(communication.Sink{Mechanism: &childStopper{child: child, restoreTerminal: restoreTerminal}})
+
+		code := superviseChild(child, exposeConfig, args[0], func(quitChannel <-chan bool) error {
+			return loophole.ForwardPort(exposeConfig, authMethod, quitChannel)
+		})
+		removeSink()
+		stopForwarding()
+		restoreTerminal()
+		communication.Flush()
+		os.Exit(code)
+	},
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 {
+			return errors.New("Missing argument: command to run")
+		}
+		return nil
+	},
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		err := parseBasicAuthFlags(cmd.Flags())
+		if err != nil {
+			return err
+		}
+		err = parseServeFlags(cmd.Flags())
+		if err != nil {
+			return err
+		}
+		return lm.Validate(&localEndpointSpecs)
+	},
+}
+
+func init() {
+	initServeCommand(execCmd)
+	execCmd.Flags().SetInterspersed(false)
+	execCmd.Flags().Int32Var(&localEndpointSpecs.Port, "port", 0, "port the command listens on")
+	execCmd.MarkFlagRequired("port")
+	execCmd.Flags().StringVar(&localEndpointSpecs.Host, "host", "127.0.0.1", "host the command listens on")
+	execCmd.Flags().BoolVar(&localEndpointSpecs.HTTPS, "https", false, "use if the command serves HTTPS")
+	execCmd.Flags().StringVar(&localEndpointSpecs.HealthCheck.Path, "health-check-path", "", "wait for the command to answer HTTP requests to given path instead of accepting TCP connections, e.g. /healthz")
+	execCmd.Flags().BoolVar(&execInjectEnv, "inject-env", true, "pass PORT and LOOPHOLE_URL environment variables to the command")
+
+	rootCmd.AddCommand(execCmd)
+}
+
+// superviseChild tunnels the port once the command answers, the tunnel is stopped when the command exits;
+// returns the status loophole should exit with, which is the one of the command unless the tunnel failed
+func superviseChild(child *childprocess.Process, exposeConfig lm.ExposeHTTPConfig, command string, forward func(quitChannel <-chan bool) error) int {
+	quitChannel := make(chan bool)
+	go func() {
+		<-child.Done()
+		close(quitChannel)
+	}()
+
+	if err := loophole.WaitForUpstream(exposeConfig, quitChannel); err != nil {
+		communication.TunnelWarn(exposeConfig.Remote.TunnelID, fmt.Sprintf("'%s' exited before listening on port %d", command, exposeConfig.Local.Port))
+		return child.ExitCode()
+	}
+	if err := forward(quitChannel); err != nil {
+		child.Stop(childStopTimeout)
+		return 1
+	}
+	return child.ExitCode()
+}
+
+// childStopper interrupts the command when loophole is about to exit on failure, so that it doesn't outlive the tunnel
+type childStopper struct {
+	communication.NoopMechanism
+	child           *childprocess.Process
+	restoreTerminal func()
+}
+
+func (s *childStopper) Fatal(message string) {
+	s.child.Stop(childStopTimeout)
+	s.restoreTerminal()
+}
+
+func (s *childStopper) TunnelStartFailure(tunnelID string, err error) {
+	s.child.Stop(childStopTimeout)
+	s.restoreTerminal()
+}
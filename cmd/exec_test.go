@@ -0,0 +1,96 @@
+// +build !desktop
+
+package cmd
+
+import (
+	"errors"
+	"net"
+	"runtime"
+	"testing"
+
+	lm "github.com/loophole/cli/internal/app/loophole/models"
+	"github.com/loophole/cli/internal/pkg/childprocess"
+)
+
+// execTestConfig returns config of the tunnel to the port of the listener, which stands for the command's server
+func execTestConfig(listener net.Listener) lm.ExposeHTTPConfig {
+	return lm.ExposeHTTPConfig{
+		Local: lm.LocalHTTPEndpointSpecs{Host: "127.0.0.1", Port: int32(listener.Addr().(*net.TCPAddr).Port)},
+	}
+}
+
+func startTestCommand(t *testing.T, script string) *childprocess.Process {
+	if runtime.GOOS == "windows" {
+		t.Skip("test relies on POSIX shell")
+	}
+	child, err := childprocess.Start([]string{"sh", "-c", script}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return child
+}
+
+func TestSuperviseChildExitingBeforeListening(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exposeConfig := execTestConfig(listener)
+	listener.Close()
+	child := startTestCommand(t, "exit 3")
+
+	forwarded := false
+	code := superviseChild(child, exposeConfig, "sh", func(quitChannel <-chan bool) error {
+		forwarded = true
+		return nil
+	})
+	if forwarded {
+		t.Fatalf("Tunnel was started although the command never listened")
+	}
+	if code != 3 {
+		t.Fatalf("Exit code %d is different than the command's: 3", code)
+	}
+}
+
+func TestSuperviseChildExitingAfterTunnelStarted(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	child := startTestCommand(t, "sleep 0.2; exit 5")
+
+	stopped := false
+	code := superviseChild(child, execTestConfig(listener), "sh", func(quitChannel <-chan bool) error {
+		<-quitChannel
+		stopped = true
+		return nil
+	})
+	if !stopped {
+		t.Fatalf("Tunnel wasn't stopped when the command exited")
+	}
+	if code != 5 {
+		t.Fatalf("Exit code %d is different than the command's: 5", code)
+	}
+}
+
+func TestSuperviseChildStopsCommandWhenTunnelFails(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	child := startTestCommand(t, "exec sleep 10")
+
+	code := superviseChild(child, execTestConfig(listener), "sh", func(quitChannel <-chan bool) error {
+		return errors.New("gateway unreachable")
+	})
+	select {
+	case <-child.Done():
+	default:
+		t.Fatalf("Command outlived the failed tunnel")
+	}
+	if code != 1 {
+		t.Fatalf("Exit code %d is different than expected: 1", code)
+	}
+}
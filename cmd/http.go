@@ -5,10 +5,14 @@ package cmd
 import (
 	"errors"
 	"fmt"
+	"net"
+	"net/url"
 	"strconv"
+	"strings"
 
 	"github.com/loophole/cli/internal/app/loophole"
 	lm "github.com/loophole/cli/internal/app/loophole/models"
+	"github.com/loophole/cli/internal/pkg/closehandler"
 	"github.com/loophole/cli/internal/pkg/communication"
 	"github.com/loophole/cli/internal/pkg/token"
 
@@ -16,27 +20,42 @@ import (
 )
 
 var localEndpointSpecs lm.LocalHTTPEndpointSpecs
+var routeFlags []string
+var requestHeaderFlags []string
+var responseHeaderFlags []string
+var faultFlags []string
 
 var httpCmd = &cobra.Command{
-	Use:   "http <port> [host]",
+	Use:   "http <port|unix:socket> [host] [<port|host:port|unix:socket>...]",
 	Short: "Expose http server on given port to the public",
 	Long: `Exposes http server running locally, or on locally available machine to the public via loophole tunnel.
 
 To expose server running locally on port 3000 simply use 'loophole http 3000'.
-To expose port running on some local host e.g. 192.168.1.20 use 'loophole http <port> 192.168.1.20'`,
+To expose port running on some local host e.g. 192.168.1.20 use 'loophole http <port> 192.168.1.20'
+To expose server listening on Unix socket use 'loophole http unix:/path/to.sock'
+To balance requests across replicas of your server list all of them, e.g. 'loophole http 3000 3001 --lb least-connections',
+replicas failing health checks (see '--health-check-interval') don't get any requests until they're back.
+
+To serve multiple local services under one hostname use routes, e.g. 'loophole http 5173 --route /api=8080'
+will send requests starting with /api to port 8080 and everything else to port 5173.
+For gRPC servers use '--upstream-protocol h2c', or '--upstream-protocol h2' with '--https' when they use TLS.
+Add ',strip-prefix' to the route (e.g. '--route /api=8080,strip-prefix') to remove the prefix before proxying.
+Certificates of https route targets are verified, add ',insecure' to accept self-signed ones.
+
+Headers can be manipulated with '--request-header' and '--response-header' rules in '[set|add|remove:]<name>[=<value>]' format,
+e.g. '--request-header X-Env=staging', '--request-header add:X-Tag=demo' or '--response-header remove:X-Powered-By'.
+
+To test how your app copes with failures use '--fault' rules in '<prefix>=<status>[:<percentage>%]' format,
+e.g. '--fault /api/orders=503:20%' responds with 503 to one in five requests under /api/orders.
+Bad network conditions can be simulated with '--simulate 3g' or explicit '--latency', '--jitter' and '--reset-rate' values.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		loggedIn := token.IsTokenSaved()
 		idToken := token.GetIdToken()
 		communication.ApplicationStart(loggedIn, idToken)
 
 		checkVersion()
+		closehandler.SetupCloseHandler()
 
-		localEndpointSpecs.Host = "127.0.0.1"
-		if len(args) > 1 {
-			localEndpointSpecs.Host = args[1]
-		}
-		port, _ := strconv.ParseInt(args[0], 10, 32)
-		localEndpointSpecs.Port = int32(port)
 		quitChannel := make(chan bool)
 
 		exposeConfig := lm.ExposeHTTPConfig{
@@ -44,6 +63,13 @@ To expose port running on some local host e.g. 192.168.1.20 use 'loophole http <
 			Remote: remoteEndpointSpecs,
 		}
 
+		if exposeConfig.Local.WaitForUpstream {
+			if err := loophole.WaitForUpstream(exposeConfig, quitChannel); err != nil {
+				communication.TunnelStartFailure(exposeConfig.Remote.TunnelID, err)
+				return
+			}
+		}
+
 		authMethod, err := loophole.RegisterTunnel(&exposeConfig.Remote)
 		if err != nil {
 			communication.Fatal(err.Error())
@@ -55,14 +81,34 @@ To expose port running on some local host e.g. 192.168.1.20 use 'loophole http <
 		if len(args) < 1 {
 			return errors.New("Missing argument: port")
 		}
-		_, err := strconv.ParseInt(args[0], 10, 32)
-		if err != nil {
-			return fmt.Errorf("Invalid argument: port: %v", err)
-		}
 		return nil
 	},
 	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
-		return parseBasicAuthFlags(cmd.Flags())
+		err := parseLocalEndpointArgs(args)
+		if err != nil {
+			return err
+		}
+		err = parseBasicAuthFlags(cmd.Flags())
+		if err != nil {
+			return err
+		}
+		err = parseServeFlags(cmd.Flags())
+		if err != nil {
+			return err
+		}
+		err = parseRouteFlags()
+		if err != nil {
+			return err
+		}
+		err = parseHeaderFlags()
+		if err != nil {
+			return err
+		}
+		err = parseFaultFlags()
+		if err != nil {
+			return err
+		}
+		return lm.Validate(&localEndpointSpecs)
 	},
 }
 
@@ -71,6 +117,252 @@ func init() {
 	httpCmd.Flags().BoolVar(&localEndpointSpecs.HTTPS, "https", false, "use if your server is already using HTTPS")
 	httpCmd.Flags().BoolVar(&remoteEndpointSpecs.DisableProxyErrorPage, "disable-proxy-error-page", false, "disable proxy error page and return 502 when your server is not available")
 	httpCmd.Flags().StringVar(&localEndpointSpecs.Path, "path", "", "specify path you wish to expose")
+	httpCmd.Flags().StringVar(&localEndpointSpecs.LoadBalancing, "lb", "", "policy of balancing requests across replicas of your server: round-robin (default), least-connections or sticky-cookie")
+	httpCmd.Flags().StringVar(&localEndpointSpecs.UpstreamProtocol, "upstream-protocol", "", "protocol your server speaks: http1 (default), h2 (HTTP/2 over TLS, requires --https) or h2c (HTTP/2 cleartext, e.g. gRPC), --route targets are always proxied over http1")
+	httpCmd.Flags().StringVar(&localEndpointSpecs.HostHeader, "host-header", "", "Host header sent to your server: 'rewrite' to use local address, 'preserve' to keep public hostname or any custom value")
+	httpCmd.Flags().StringArrayVar(&requestHeaderFlags, "request-header", []string{}, "request header rule in '[set|add|remove:]<name>[=<value>]' format (can be used multiple times)")
+	httpCmd.Flags().StringArrayVar(&responseHeaderFlags, "response-header", []string{}, "response header rule in '[set|add|remove:]<name>[=<value>]' format (can be used multiple times)")
+	httpCmd.Flags().StringArrayVar(&routeFlags, "route", []string{}, "route requests with given path prefix to another local server, e.g. '/api=8080', '/api=192.168.1.20:8080', '/api=unix:/run/api.sock' or '/api=https://127.0.0.1:8443,strip-prefix,insecure' (can be used multiple times)")
+
+	httpCmd.Flags().StringVar(&localEndpointSpecs.HealthCheck.Path, "health-check-path", "", "check your server with HTTP requests to given path instead of opening TCP connections, e.g. /healthz")
+	httpCmd.Flags().DurationVar(&localEndpointSpecs.HealthCheck.Interval, "health-check-interval", 0, "check whether your server is available every given time, e.g. 5s (enables maintenance page while it's down)")
+	httpCmd.Flags().DurationVar(&localEndpointSpecs.HealthCheck.Timeout, "health-check-timeout", 0, "time after which health check fails (default 2s)")
+	httpCmd.Flags().IntVar(&localEndpointSpecs.HealthCheck.HealthyThreshold, "healthy-threshold", 0, "number of successful health checks after which your server is considered up (default 1)")
+	httpCmd.Flags().IntVar(&localEndpointSpecs.HealthCheck.UnhealthyThreshold, "unhealthy-threshold", 0, "number of failed health checks after which your server is considered down (default 2)")
+	httpCmd.Flags().BoolVar(&localEndpointSpecs.WaitForUpstream, "wait-for-upstream", false, "start the tunnel only once your server answers")
+
+	httpCmd.Flags().StringArrayVar(&faultFlags, "fault", []string{}, "respond with error status to percentage of requests under the path, e.g. '/api/orders=503:20%' (can be used multiple times)")
 
 	rootCmd.AddCommand(httpCmd)
 }
+
+func parseRouteFlags() error {
+	localEndpointSpecs.Routes = []lm.Route{}
+	for _, routeFlag := range routeFlags {
+		route, err := parseRoute(routeFlag)
+		if err != nil {
+			return err
+		}
+		localEndpointSpecs.Routes = append(localEndpointSpecs.Routes, route)
+	}
+	return nil
+}
+
+// parseRoute parses route in '<prefix>=<target>[,strip-prefix][,insecure]' format
+func parseRoute(routeSpec string) (lm.Route, error) {
+	parts := strings.SplitN(routeSpec, "=", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return lm.Route{}, fmt.Errorf("Invalid route '%s', expected format is '<prefix>=<port|host:port|url|unix:socket>[,strip-prefix][,insecure]'", routeSpec)
+	}
+	route := lm.Route{
+		Prefix: parts[0],
+	}
+	targetWithOptions := strings.Split(parts[1], ",")
+	for _, option := range targetWithOptions[1:] {
+		switch option {
+		case "strip-prefix":
+			route.StripPrefix = true
+		case "insecure":
+			route.InsecureSkipVerify = true
+		default:
+			return lm.Route{}, fmt.Errorf("Invalid route '%s', unknown option '%s'", routeSpec, option)
+		}
+	}
+	endpoint, err := parseRouteTarget(targetWithOptions[0])
+	if err != nil {
+		return lm.Route{}, fmt.Errorf("Invalid route '%s': %v", routeSpec, err)
+	}
+	route.Endpoint = endpoint
+
+	return route, lm.ValidateRoute(&route)
+}
+
+// parseRouteTarget accepts port only ('8080'), host and port ('192.168.1.20:8080'), full URL ('https://127.0.0.1:8443/app')
+// or Unix socket ('unix:/run/api.sock')
+func parseRouteTarget(target string) (lm.Endpoint, error) {
+	if socket, ok := parseUnixSocket(target); ok {
+		if socket == "" {
+			return lm.Endpoint{}, errors.New("socket path is missing")
+		}
+		return lm.Endpoint{
+			Protocol: "http",
+			Socket:   socket,
+		}, nil
+	}
+	if port, err := strconv.ParseInt(target, 10, 32); err == nil {
+		return lm.Endpoint{
+			Protocol: "http",
+			Host:     "127.0.0.1",
+			Port:     int32(port),
+		}, nil
+	}
+	if !strings.Contains(target, "://") {
+		target = fmt.Sprintf("http://%s", target)
+	}
+	targetURL, err := url.Parse(target)
+	if err != nil {
+		return lm.Endpoint{}, err
+	}
+	if targetURL.Scheme != "http" && targetURL.Scheme != "https" {
+		return lm.Endpoint{}, fmt.Errorf("unsupported protocol '%s'", targetURL.Scheme)
+	}
+	endpoint := lm.Endpoint{
+		Protocol: targetURL.Scheme,
+		Host:     targetURL.Hostname(),
+		Path:     targetURL.Path,
+	}
+	if endpoint.Host == "" {
+		endpoint.Host = "127.0.0.1"
+	}
+	switch {
+	case targetURL.Port() != "":
+		port, err := strconv.ParseInt(targetURL.Port(), 10, 32)
+		if err != nil {
+			return lm.Endpoint{}, fmt.Errorf("invalid port: %v", err)
+		}
+		endpoint.Port = int32(port)
+	case endpoint.Protocol == "https":
+		endpoint.Port = 443
+	default:
+		endpoint.Port = 80
+	}
+	return endpoint, nil
+}
+
+// parseLocalEndpointArgs parses '<port|unix:socket> [host] [<port|host:port|unix:socket>...]' arguments,
+// second argument is the host of the server unless it's another replica
+func parseLocalEndpointArgs(args []string) error {
+	host := "127.0.0.1"
+	replicas := args[1:]
+	if len(replicas) > 0 {
+		if _, ok := parseUpstream(replicas[0], host); !ok {
+			host = replicas[0]
+			replicas = replicas[1:]
+		}
+	}
+
+	endpoint, ok := parseUpstream(args[0], host)
+	if !ok {
+		return fmt.Errorf("Invalid argument: '%s' is neither port nor unix:<socket>", args[0])
+	}
+	localEndpointSpecs.Host = endpoint.Host
+	localEndpointSpecs.Port = endpoint.Port
+	localEndpointSpecs.Socket = endpoint.Socket
+
+	localEndpointSpecs.Upstreams = []lm.Endpoint{}
+	for _, replica := range replicas {
+		upstream, ok := parseUpstream(replica, host)
+		if !ok {
+			return fmt.Errorf("Invalid argument: '%s' is neither port, host:port nor unix:<socket>", replica)
+		}
+		localEndpointSpecs.Upstreams = append(localEndpointSpecs.Upstreams, upstream)
+	}
+	return nil
+}
+
+// parseUpstream accepts port on the given host ('3000'), host and port ('192.168.1.20:3000') or Unix socket ('unix:/run/app.sock')
+func parseUpstream(arg string, host string) (lm.Endpoint, bool) {
+	if socket, ok := parseUnixSocket(arg); ok {
+		return lm.Endpoint{Socket: socket}, socket != ""
+	}
+	if port, err := strconv.ParseInt(arg, 10, 32); err == nil {
+		return lm.Endpoint{Host: host, Port: int32(port)}, port > 0
+	}
+	upstreamHost, upstreamPort, err := net.SplitHostPort(arg)
+	if err != nil || upstreamHost == "" {
+		return lm.Endpoint{}, false
+	}
+	port, err := strconv.ParseInt(upstreamPort, 10, 32)
+	if err != nil || port <= 0 {
+		return lm.Endpoint{}, false
+	}
+	return lm.Endpoint{Host: upstreamHost, Port: int32(port)}, true
+}
+
+// parseUnixSocket returns socket path of 'unix:/path/to.sock' target
+func parseUnixSocket(target string) (string, bool) {
+	if !strings.HasPrefix(target, "unix:") {
+		return "", false
+	}
+	return strings.TrimPrefix(target, "unix:"), true
+}
+
+func parseHeaderFlags() error {
+	var err error
+	localEndpointSpecs.RequestHeaders, err = parseHeaderRules(requestHeaderFlags)
+	if err != nil {
+		return err
+	}
+	localEndpointSpecs.ResponseHeaders, err = parseHeaderRules(responseHeaderFlags)
+	return err
+}
+
+// parseHeaderRules parses rules in '[set|add|remove:]<name>[=<value>]' format, action defaults to 'set'
+func parseHeaderRules(ruleSpecs []string) ([]lm.HeaderRule, error) {
+	rules := []lm.HeaderRule{}
+	for _, ruleSpec := range ruleSpecs {
+		rule := lm.HeaderRule{
+			Action: lm.HeaderActionSet,
+		}
+		nameWithValue := ruleSpec
+		if parts := strings.SplitN(ruleSpec, ":", 2); len(parts) == 2 {
+			rule.Action = lm.HeaderAction(parts[0])
+			nameWithValue = parts[1]
+		}
+		parts := strings.SplitN(nameWithValue, "=", 2)
+		rule.Name = strings.TrimSpace(parts[0])
+		if len(parts) == 2 {
+			rule.Value = parts[1]
+		}
+
+		switch {
+		case rule.Action != lm.HeaderActionSet && rule.Action != lm.HeaderActionAdd && rule.Action != lm.HeaderActionRemove:
+			return nil, fmt.Errorf("Invalid header rule '%s', unknown action '%s'", ruleSpec, rule.Action)
+		case rule.Name == "":
+			return nil, fmt.Errorf("Invalid header rule '%s', header name is missing", ruleSpec)
+		case rule.Action != lm.HeaderActionRemove && len(parts) != 2:
+			return nil, fmt.Errorf("Invalid header rule '%s', header value is missing", ruleSpec)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func parseFaultFlags() error {
+	localEndpointSpecs.Faults = []lm.FaultRule{}
+	for _, faultFlag := range faultFlags {
+		rule, err := parseFaultRule(faultFlag)
+		if err != nil {
+			return err
+		}
+		localEndpointSpecs.Faults = append(localEndpointSpecs.Faults, rule)
+	}
+	return nil
+}
+
+// parseFaultRule parses fault rule in '<prefix>=<status>[:<percentage>%]' format, percentage defaults to 100
+func parseFaultRule(ruleSpec string) (lm.FaultRule, error) {
+	parts := strings.SplitN(ruleSpec, "=", 2)
+	if len(parts) != 2 {
+		return lm.FaultRule{}, fmt.Errorf("Invalid fault '%s', expected format is '<prefix>=<status>[:<percentage>%%]'", ruleSpec)
+	}
+	rule := lm.FaultRule{
+		Prefix:     parts[0],
+		Percentage: 100,
+	}
+	statusWithPercentage := strings.SplitN(parts[1], ":", 2)
+	statusCode, err := strconv.Atoi(statusWithPercentage[0])
+	if err != nil {
+		return lm.FaultRule{}, fmt.Errorf("Invalid fault '%s', status code is not a number", ruleSpec)
+	}
+	rule.StatusCode = statusCode
+	if len(statusWithPercentage) == 2 {
+		percentage, err := strconv.ParseFloat(strings.TrimSuffix(statusWithPercentage[1], "%"), 64)
+		if err != nil {
+			return lm.FaultRule{}, fmt.Errorf("Invalid fault '%s', percentage is not a number", ruleSpec)
+		}
+		rule.Percentage = percentage
+	}
+
+	return rule, lm.ValidateFaultRule(&rule)
+}
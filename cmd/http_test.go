@@ -0,0 +1,63 @@
+// +build !desktop
+
+package cmd
+
+import (
+	"testing"
+
+	lm "github.com/loophole/cli/internal/app/loophole/models"
+)
+
+func TestParseRoute(t *testing.T) {
+	cases := map[string]lm.Route{
+		"/api=8080": {
+			Prefix:   "/api",
+			Endpoint: lm.Endpoint{Protocol: "http", Host: "127.0.0.1", Port: 8080},
+		},
+		"/api=192.168.1.20:8080,strip-prefix": {
+			Prefix:      "/api",
+			Endpoint:    lm.Endpoint{Protocol: "http", Host: "192.168.1.20", Port: 8080},
+			StripPrefix: true,
+		},
+		"/admin=https://127.0.0.1/app": {
+			Prefix:   "/admin",
+			Endpoint: lm.Endpoint{Protocol: "https", Host: "127.0.0.1", Port: 443, Path: "/app"},
+		},
+		"/admin=https://127.0.0.1:8443,strip-prefix,insecure": {
+			Prefix:             "/admin",
+			Endpoint:           lm.Endpoint{Protocol: "https", Host: "127.0.0.1", Port: 8443},
+			StripPrefix:        true,
+			InsecureSkipVerify: true,
+		},
+		"/ws=unix:/run/app.sock": {
+			Prefix:   "/ws",
+			Endpoint: lm.Endpoint{Protocol: "http", Socket: "/run/app.sock"},
+		},
+	}
+	for spec, expected := range cases {
+		route, err := parseRoute(spec)
+		if err != nil {
+			t.Fatalf("Route '%s' was rejected: %v", spec, err)
+		}
+		if route != expected {
+			t.Fatalf("Route '%s' was parsed as %+v instead of %+v", spec, route, expected)
+		}
+	}
+}
+
+func TestParseRouteRejectsInvalidRoutes(t *testing.T) {
+	for _, spec := range []string{
+		"/api",
+		"/api=",
+		"api=8080",
+		"/api=8080,unknown",
+		"/api=ftp://127.0.0.1",
+		"/api=127.0.0.1:port",
+		"/api=unix:",
+		"/api=8080,insecure",
+	} {
+		if _, err := parseRoute(spec); err == nil {
+			t.Fatalf("Invalid route '%s' was accepted", spec)
+		}
+	}
+}
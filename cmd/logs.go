@@ -0,0 +1,37 @@
+// +build !desktop
+
+package cmd
+
+import (
+	"github.com/loophole/cli/internal/pkg/logfiles"
+	"github.com/spf13/cobra"
+)
+
+// logsCmd represents the logs command
+var logsCmd = &cobra.Command{
+	Use:   "logs",
+	Short: "Group of commands concerning log files",
+	Long:  "Parent for commands browsing log files written by previous loophole invocations. Always use with one of subcommands",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+// previousLogSessions returns log sessions except the one of current invocation, most recent first
+func previousLogSessions() ([]*logfiles.Session, error) {
+	sessions, err := logfiles.List(logsDirectory())
+	if err != nil {
+		return nil, err
+	}
+	previous := []*logfiles.Session{}
+	for _, session := range sessions {
+		if !session.Is(currentLogFile) {
+			previous = append(previous, session)
+		}
+	}
+	return previous, nil
+}
+
+func init() {
+	rootCmd.AddCommand(logsCmd)
+}
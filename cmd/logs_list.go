@@ -0,0 +1,45 @@
+// +build !desktop
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/loophole/cli/internal/pkg/bandwidth"
+	"github.com/loophole/cli/internal/pkg/communication"
+	"github.com/spf13/cobra"
+)
+
+var logsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List log sessions",
+	Long:  "Lists log files of previous loophole invocations, most recent first.",
+	Run: func(cmd *cobra.Command, args []string) {
+		sessions, err := previousLogSessions()
+		if err != nil {
+			communication.Fatal(fmt.Sprintf("Failed to read log files: %s", err.Error()))
+		}
+		if len(sessions) == 0 {
+			fmt.Println("No log files")
+			return
+		}
+
+		writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, "SESSION\tSTARTED\tLAST WRITTEN\tSIZE\tCOMPRESSED")
+		for _, session := range sessions {
+			compressed := "no"
+			if session.Compressed {
+				compressed = "yes"
+			}
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\n", session.Name, session.Started.Format("2006-01-02 15:04:05"),
+				session.Modified.Format("2006-01-02 15:04:05"), bandwidth.FormatSize(session.Size), compressed)
+		}
+		writer.Flush()
+	},
+}
+
+func init() {
+	logsCmd.AddCommand(logsListCmd)
+}
@@ -0,0 +1,167 @@
+// +build !desktop
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/loophole/cli/internal/pkg/communication"
+	"github.com/loophole/cli/internal/pkg/logfiles"
+	"github.com/mattn/go-colorable"
+	"github.com/rs/zerolog"
+	"github.com/spf13/cobra"
+)
+
+// logFollowInterval is how often the log is checked for new lines when following it
+const logFollowInterval = 500 * time.Millisecond
+
+var logsShowTunnelID string
+var logsShowLevel string
+var logsShowGrep string
+var logsShowTail int
+var logsShowFollow bool
+var logsShowJSON bool
+
+var logsShowCmd = &cobra.Command{
+	Use:   "show [session]",
+	Short: "Show log of given session",
+	Long:  "Shows log of given session as listed by 'loophole logs list', or of the most recent one when not specified.",
+	Args:  cobra.MaximumNArgs(1),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if logsShowTail < 0 {
+			return fmt.Errorf("Invalid --tail value %d, expected positive number of lines", logsShowTail)
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		filter, err := logsShowFilter()
+		if err != nil {
+			communication.Fatal(err.Error())
+		}
+		session, err := logsShowSession(args)
+		if err != nil {
+			communication.Fatal(err.Error())
+		}
+		if logsShowFollow && session.Compressed {
+			communication.Fatal(fmt.Sprintf("Log session '%s' is finished and compressed, it can't be followed", session.Name))
+		}
+		reader, err := session.Open()
+		if err != nil {
+			communication.Fatal(fmt.Sprintf("Failed to open log file: %s", err.Error()))
+		}
+		defer reader.Close()
+
+		printLine := logLinePrinter(logsShowJSON)
+		// with --tail matching lines are buffered until the end of the log, new lines are printed right away
+		tail := [][]byte{}
+		readLogLines(bufio.NewReader(reader), logsShowFollow, func(line []byte, followed bool) {
+			if !filter.Match(line) {
+				return
+			}
+			if logsShowTail == 0 || followed {
+				printLine(line)
+				return
+			}
+			tail = append(tail, line)
+			if len(tail) > logsShowTail {
+				tail = tail[1:]
+			}
+		}, func() {
+			for _, line := range tail {
+				printLine(line)
+			}
+			tail = nil
+		})
+	},
+}
+
+func logsShowFilter() (*logfiles.Filter, error) {
+	filter := &logfiles.Filter{TunnelID: logsShowTunnelID}
+	level, err := zerolog.ParseLevel(logsShowLevel)
+	if err != nil || level == zerolog.NoLevel {
+		return nil, fmt.Errorf("Invalid --level value '%s', expected one of: debug, info, warn, error, fatal", logsShowLevel)
+	}
+	filter.Level = level
+	if logsShowGrep != "" {
+		filter.Pattern, err = regexp.Compile(logsShowGrep)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid --grep pattern: %s", err.Error())
+		}
+	}
+	return filter, nil
+}
+
+func logsShowSession(args []string) (*logfiles.Session, error) {
+	if len(args) > 0 {
+		return logfiles.Find(logsDirectory(), args[0])
+	}
+	sessions, err := previousLogSessions()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read log files: %s", err.Error())
+	}
+	if len(sessions) == 0 {
+		return nil, fmt.Errorf("No log files")
+	}
+	return sessions[0], nil
+}
+
+// readLogLines calls handle for each line of the log, then end once whole log is read,
+// when following the log it keeps waiting for new lines, passing them with followed set
+func readLogLines(reader *bufio.Reader, follow bool, handle func(line []byte, followed bool), end func()) {
+	followed := false
+	partial := []byte{}
+	for {
+		chunk, err := reader.ReadBytes('\n')
+		partial = append(partial, chunk...)
+		if err == nil {
+			handle(bytes.TrimRight(partial, "\r\n"), followed)
+			partial = []byte{}
+			continue
+		}
+		if err != io.EOF || !follow {
+			if len(partial) > 0 {
+				handle(partial, followed)
+			}
+			if err != io.EOF {
+				communication.Error(fmt.Sprintf("Failed to read log file: %s", err.Error()))
+			}
+			end()
+			return
+		}
+		if !followed {
+			end()
+			followed = true
+		}
+		time.Sleep(logFollowInterval)
+	}
+}
+
+// logLinePrinter returns function printing zerolog lines in human readable way, or as they are when raw is set
+func logLinePrinter(raw bool) func(line []byte) {
+	console := zerolog.ConsoleWriter{Out: colorable.NewColorableStdout()}
+	return func(line []byte) {
+		if !raw {
+			if _, err := console.Write(line); err == nil {
+				return
+			}
+		}
+		os.Stdout.Write(append(line, '\n'))
+	}
+}
+
+func init() {
+	logsShowCmd.Flags().StringVar(&logsShowTunnelID, "tunnel", "", "Show only lines logged by tunnel with given ID")
+	logsShowCmd.Flags().StringVar(&logsShowLevel, "level", "debug", "Show only lines with given level or higher: debug, info, warn, error or fatal")
+	logsShowCmd.Flags().StringVar(&logsShowGrep, "grep", "", "Show only lines matching given regular expression")
+	logsShowCmd.Flags().IntVarP(&logsShowTail, "tail", "n", 0, "Show only given number of last matching lines")
+	logsShowCmd.Flags().BoolVarP(&logsShowFollow, "follow", "f", false, "Keep showing new lines as they're written to the log")
+	logsShowCmd.Flags().BoolVar(&logsShowJSON, "json", false, "Show lines as they're stored in the log file, as JSON")
+
+	logsCmd.AddCommand(logsShowCmd)
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/loophole/cli/internal/app/loophole"
 	lm "github.com/loophole/cli/internal/app/loophole/models"
+	"github.com/loophole/cli/internal/pkg/closehandler"
 	"github.com/loophole/cli/internal/pkg/communication"
 	"github.com/loophole/cli/internal/pkg/token"
 	"github.com/spf13/cobra"
@@ -27,6 +28,7 @@ To expose local directory (e.g. /data/my-data) simply use 'loophole path /data/m
 		communication.ApplicationStart(loggedIn, idToken)
 
 		checkVersion()
+		closehandler.SetupCloseHandler()
 
 		dirEndpointSpecs.Path = args[0]
 		quitChannel := make(chan bool)
@@ -34,6 +36,7 @@ To expose local directory (e.g. /data/my-data) simply use 'loophole path /data/m
 		exposeConfig := lm.ExposeDirectoryConfig{
 			Local:  dirEndpointSpecs,
 			Remote: remoteEndpointSpecs,
+			Share:  shareLinkSpecs,
 		}
 
 		authMethod, err := loophole.RegisterTunnel(&exposeConfig.Remote)
@@ -50,11 +53,16 @@ To expose local directory (e.g. /data/my-data) simply use 'loophole path /data/m
 		return nil
 	},
 	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
-		return parseBasicAuthFlags(cmd.Flags())
+		err := parseBasicAuthFlags(cmd.Flags())
+		if err != nil {
+			return err
+		}
+		return parseServeFlags(cmd.Flags())
 	},
 }
 
 func init() {
 	initServeCommand(dirCmd)
+	initShareLinkFlags(dirCmd)
 	rootCmd.AddCommand(dirCmd)
 }
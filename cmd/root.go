@@ -3,6 +3,8 @@
 package cmd
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	stdlog "log"
 	"os"
@@ -10,6 +12,8 @@ import (
 
 	"github.com/loophole/cli/config"
 	"github.com/loophole/cli/internal/pkg/cache"
+	"github.com/loophole/cli/internal/pkg/communication"
+	"github.com/loophole/cli/internal/pkg/logfiles"
 	"github.com/mattn/go-colorable"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -26,21 +30,40 @@ var rootCmd = &cobra.Command{
 	},
 }
 
+// logRetention limits log files kept from previous invocations
+var logRetention logfiles.RetentionPolicy
+
+// currentLogFile is the log file of this invocation
+var currentLogFile string
+
 func init() {
 	cobra.OnInitialize(initLogger)
 
 	rootCmd.PersistentFlags().BoolVarP(&config.Config.Display.Verbose, "verbose", "v", false, "verbose output")
+
+	rootCmd.PersistentFlags().DurationVar(&logRetention.MaxAge, "log-max-age", 30*24*time.Hour, "Remove log files older than given time (0 keeps them regardless of age)")
+	rootCmd.PersistentFlags().IntVar(&logRetention.MaxCount, "log-max-count", 100, "Maximum number of log files of previous invocations to keep (0 means unlimited)")
+	logRetention.MaxTotalSize = 500 * 1000 * 1000
+	rootCmd.PersistentFlags().Var((*sizeValue)(&logRetention.MaxTotalSize), "log-max-size", "Maximum total size of compressed log files of previous invocations, e.g. 100MB")
+}
+
+func logsDirectory() string {
+	return cache.GetLocalStorageDir("logs")
 }
 
 func initLogger() {
-	logLocation := cache.GetLocalStorageFile(fmt.Sprintf("%s.log", time.Now().Format("2006-01-02--15-04-05")), "logs")
+	now := time.Now()
+	currentLogFile = cache.GetLocalStorageFile(logfiles.FileName(now), "logs")
 
-	f, err := os.Create(logLocation)
+	f, err := os.Create(currentLogFile)
 	if err != nil {
 		stdlog.Fatalln("Error creating log file:", err)
 	}
 
-	consoleWriter := zerolog.ConsoleWriter{Out: colorable.NewColorableStderr()}
+	consoleWriter := hiddenFieldsWriter{
+		ConsoleWriter: zerolog.ConsoleWriter{Out: colorable.NewColorableStderr()},
+		fields:        []string{"tunnelId"},
+	}
 	multi := zerolog.MultiLevelWriter(consoleWriter, f)
 	log.Logger = zerolog.New(multi).With().Timestamp().Logger()
 
@@ -51,13 +74,45 @@ func initLogger() {
 
 	stdlog.SetFlags(0)
 	stdlog.SetOutput(log.Logger)
+
+	if err := logfiles.ApplyRetention(logsDirectory(), logRetention, now, currentLogFile); err != nil {
+		log.Warn().Err(err).Msg("Failed to clean up old log files")
+	}
+}
+
+// hiddenFieldsWriter leaves out fields which are only useful when searching the log files, e.g. tunnel ID
+type hiddenFieldsWriter struct {
+	zerolog.ConsoleWriter
+	fields []string
+}
+
+func (w hiddenFieldsWriter) Write(p []byte) (int, error) {
+	var event map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(p))
+	decoder.UseNumber()
+	if err := decoder.Decode(&event); err != nil {
+		return w.ConsoleWriter.Write(p)
+	}
+	for _, field := range w.fields {
+		delete(event, field)
+	}
+	filtered, err := json.Marshal(event)
+	if err != nil {
+		return w.ConsoleWriter.Write(p)
+	}
+	if _, err := w.ConsoleWriter.Write(filtered); err != nil {
+		return 0, err
+	}
+	return len(p), nil
 }
 
 // Execute runs command parsing chain
 func Execute() {
 	rootCmd.Version = fmt.Sprintf("%s (%s)", config.Config.Version, config.Config.CommitHash)
 
-	if err := rootCmd.Execute(); err != nil {
+	err := rootCmd.Execute()
+	communication.Flush()
+	if err != nil {
 		os.Exit(1)
 	}
 }
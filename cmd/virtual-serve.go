@@ -9,21 +9,30 @@ import (
 	"io"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/beevik/guid"
 	"github.com/blang/semver/v4"
 	"github.com/loophole/cli/config"
 	lm "github.com/loophole/cli/internal/app/loophole/models"
 	"github.com/loophole/cli/internal/pkg/apiclient"
+	"github.com/loophole/cli/internal/pkg/bandwidth"
 	"github.com/loophole/cli/internal/pkg/cache"
 	"github.com/loophole/cli/internal/pkg/communication"
+	"github.com/loophole/cli/internal/pkg/hooks"
 	"github.com/loophole/cli/internal/pkg/inpututil"
+	"github.com/loophole/cli/internal/pkg/netsim"
+	"github.com/loophole/cli/internal/pkg/ratelimit"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	"golang.org/x/term"
 )
 
 var remoteEndpointSpecs lm.RemoteEndpointSpecs
+var shareLinkSpecs lm.ShareLinkSpecs
+var hooksSpecs lm.HooksSpecs
+var expiresAtFlag string
+var simulatePresetFlag string
 
 var basicAuthUsernameFlagName = "basic-auth-username"
 var basicAuthPasswordFlagName = "basic-auth-password"
@@ -39,12 +48,256 @@ func initServeCommand(serveCmd *cobra.Command) {
 
 	serveCmd.PersistentFlags().StringVarP(&remoteEndpointSpecs.BasicAuthUsername, basicAuthUsernameFlagName, "u", "", "Basic authentication username to protect site with")
 	serveCmd.PersistentFlags().StringVarP(&remoteEndpointSpecs.BasicAuthPassword, basicAuthPasswordFlagName, "p", "", "Basic authentication password to protect site with")
+	serveCmd.PersistentFlags().StringVar(&remoteEndpointSpecs.HtpasswdFile, "htpasswd", "", "htpasswd file with users (bcrypt, SHA or MD5 hashes) allowed to access the site, reloaded automatically when changed")
+	serveCmd.MarkFlagFilename("htpasswd")
+
+	serveCmd.PersistentFlags().StringVar(&remoteEndpointSpecs.ErrorTemplateFile, "error-template", "", "HTML template (Go html/template) for error pages, given .StatusCode, .StatusText, .Category, .Message, .RequestID and .LogoURL, reloaded automatically when changed")
+	serveCmd.MarkFlagFilename("error-template")
+
+	serveCmd.PersistentFlags().StringVar(&remoteEndpointSpecs.AccessLog.File, "access-log", "", "Write access log of the served requests to given file, or to standard output when set to -")
+	serveCmd.MarkFlagFilename("access-log")
+	serveCmd.PersistentFlags().StringVar(&remoteEndpointSpecs.AccessLog.Format, "access-log-format", lm.AccessLogFormatCombined, "Access log format: common, combined, json or Go text/template given .Time, .ClientIP, .User, .Method, .Host, .Path, .Protocol, .Status, .Bytes, .Duration, .UserAgent, .Referer and .RequestID")
+	remoteEndpointSpecs.AccessLog.MaxSize = 100 * 1000 * 1000
+	serveCmd.PersistentFlags().Var((*sizeValue)(&remoteEndpointSpecs.AccessLog.MaxSize), "access-log-max-size", "Rotate access log file when it grows over given size, e.g. 10MB")
+	serveCmd.PersistentFlags().IntVar(&remoteEndpointSpecs.AccessLog.MaxBackups, "access-log-max-backups", 5, "Number of rotated access log files to keep")
 
 	serveCmd.PersistentFlags().BoolVar(&remoteEndpointSpecs.DisableOldCiphers, "disable-old-ciphers", false, "Disable TLS ciphers older than TLS1.2")
+	serveCmd.PersistentFlags().StringVar(&remoteEndpointSpecs.TLS.Profile, "tls-profile", "", "TLS profile following Mozilla guidelines: modern (TLS 1.3 only), intermediate or legacy")
+	serveCmd.PersistentFlags().StringVar(&remoteEndpointSpecs.TLS.MinVersion, "tls-min-version", "", "Minimum TLS version: 1.0, 1.1, 1.2 or 1.3 (TLS 1.3 only mode)")
+	serveCmd.PersistentFlags().StringSliceVar(&remoteEndpointSpecs.TLS.CipherSuites, "tls-ciphers", []string{}, "Allowed TLS 1.2 and older cipher suites, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 (can be used multiple times)")
+	serveCmd.PersistentFlags().StringSliceVar(&remoteEndpointSpecs.TLS.Curves, "tls-curves", []string{}, "Allowed elliptic curves in order of preference: X25519, P256, P384 or P521 (can be used multiple times)")
+	serveCmd.PersistentFlags().BoolVar(&remoteEndpointSpecs.TLS.DisableHTTP2, "disable-http2", false, "Don't offer HTTP/2 to the clients via ALPN")
+	serveCmd.PersistentFlags().DurationVar(&remoteEndpointSpecs.TLS.HSTSMaxAge, "hsts", 0, "Send Strict-Transport-Security header telling browsers to use only HTTPS for given time, e.g. 8760h")
+	serveCmd.PersistentFlags().StringVar(&remoteEndpointSpecs.TLS.CertFile, "tls-cert", "", "PEM encoded certificate (with intermediates) to use instead of obtaining one via ACME, reloaded automatically when changed")
+	serveCmd.MarkFlagFilename("tls-cert")
+	serveCmd.PersistentFlags().StringVar(&remoteEndpointSpecs.TLS.KeyFile, "tls-key", "", "PEM encoded private key of the certificate provided with --tls-cert")
+	serveCmd.MarkFlagFilename("tls-key")
+	serveCmd.PersistentFlags().StringVar(&remoteEndpointSpecs.TLS.ACMEDirectoryURL, "acme-directory", "", "ACME directory URL to obtain certificate from instead of Let's Encrypt, e.g. local Pebble or step-ca instance")
+	serveCmd.PersistentFlags().StringVar(&remoteEndpointSpecs.TLS.ACMEEmail, "acme-email", "", "Contact email for the ACME account")
+	serveCmd.PersistentFlags().StringVar(&remoteEndpointSpecs.TLS.ACMECAFile, "acme-ca-file", "", "PEM encoded CA certificate to trust when connecting to the ACME directory")
+	serveCmd.MarkFlagFilename("acme-ca-file")
+	serveCmd.PersistentFlags().StringVar(&remoteEndpointSpecs.TLS.ClientCAFile, "client-ca", "", "PEM encoded CA certificate, enables mutual TLS requiring client certificates signed by it")
+	serveCmd.MarkFlagFilename("client-ca")
+	serveCmd.PersistentFlags().StringSliceVar(&remoteEndpointSpecs.TLS.ClientCertPaths, "client-cert-path", []string{}, "Require client certificate only for given path prefix, making it optional elsewhere (can be used multiple times)")
+
+	serveCmd.PersistentFlags().StringSliceVar(&remoteEndpointSpecs.AllowedCIDRs, "allow-cidr", []string{}, "Allow access only from given IP addresses or CIDR ranges, e.g. 203.0.113.0/24 (can be used multiple times)")
+	serveCmd.PersistentFlags().StringSliceVar(&remoteEndpointSpecs.DeniedCIDRs, "deny-cidr", []string{}, "Deny access from given IP addresses or CIDR ranges (can be used multiple times)")
+	serveCmd.PersistentFlags().StringVar(&remoteEndpointSpecs.AccessListFile, "access-list-file", "", "File with 'allow <cidr>' and 'deny <cidr>' lines, reloaded automatically when changed")
+	serveCmd.MarkFlagFilename("access-list-file")
+
+	serveCmd.PersistentFlags().StringVar(&remoteEndpointSpecs.OIDC.IssuerURL, "oidc-issuer", "", "OpenID Connect issuer URL, enables single sign-on in front of the site")
+	serveCmd.PersistentFlags().StringVar(&remoteEndpointSpecs.OIDC.ClientID, "oidc-client-id", "", "OpenID Connect client ID")
+	serveCmd.PersistentFlags().StringVar(&remoteEndpointSpecs.OIDC.ClientSecret, "oidc-client-secret", "", "OpenID Connect client secret (defaults to LOOPHOLE_OIDC_CLIENT_SECRET environment variable)")
+	serveCmd.PersistentFlags().StringSliceVar(&remoteEndpointSpecs.OIDC.AllowedEmails, "oidc-allow-email", []string{}, "Email address allowed to log in via OpenID Connect (can be used multiple times)")
+	serveCmd.PersistentFlags().StringSliceVar(&remoteEndpointSpecs.OIDC.AllowedDomains, "oidc-allow-domain", []string{}, "Email domain allowed to log in via OpenID Connect, e.g. example.com (can be used multiple times)")
+
+	serveCmd.PersistentFlags().DurationVar(&remoteEndpointSpecs.ExpiresIn, "expires-in", 0, "Shut the tunnel down after given time, e.g. 2h")
+	serveCmd.PersistentFlags().StringVar(&expiresAtFlag, "expires-at", "", "Shut the tunnel down at given time, e.g. 18:00, '2006-01-02 15:04' or RFC3339 timestamp")
+	serveCmd.PersistentFlags().DurationVar(&remoteEndpointSpecs.IdleTimeout, "idle-timeout", 0, "Shut the tunnel down after no traffic for given time, e.g. 30m")
+
+	serveCmd.PersistentFlags().Var((*rateValue)(&remoteEndpointSpecs.RateLimit.Rate), "rate-limit", "Maximum request rate per client IP address, e.g. 10r/s or 600r/m")
+	serveCmd.PersistentFlags().IntVar(&remoteEndpointSpecs.RateLimit.Burst, "burst", 0, "Number of requests client can make at once over the rate limit (defaults to the rate)")
+	serveCmd.PersistentFlags().Var((*rateValue)(&remoteEndpointSpecs.RateLimit.GlobalRate), "global-rate-limit", "Maximum request rate of all the clients together, e.g. 100r/s")
+	serveCmd.PersistentFlags().IntVar(&remoteEndpointSpecs.RateLimit.GlobalBurst, "global-burst", 0, "Number of requests all the clients can make at once over the global rate limit (defaults to the rate)")
+	serveCmd.PersistentFlags().IntVar(&remoteEndpointSpecs.MaxConnections, "max-connections", 0, "Maximum number of concurrent tunneled connections (0 means unlimited)")
+
+	serveCmd.PersistentFlags().Var((*bandwidthValue)(&remoteEndpointSpecs.MaxBandwidth), "max-bandwidth", "Maximum transfer rate of the tunnel in each direction, e.g. 5MB/s")
+	serveCmd.PersistentFlags().Var((*bandwidthValue)(&remoteEndpointSpecs.MaxConnectionBandwidth), "max-connection-bandwidth", "Maximum transfer rate of single connection in each direction, e.g. 1MB/s")
+	serveCmd.PersistentFlags().Var((*sizeValue)(&remoteEndpointSpecs.Quota), "quota", "Total transfer quota, the tunnel is stopped when exhausted, e.g. 10GB")
+
+	serveCmd.PersistentFlags().StringVar(&simulatePresetFlag, "simulate", "", fmt.Sprintf("Simulate bad network conditions using preset (%s), values can be overridden with --latency, --jitter, --simulate-bandwidth and --reset-rate", strings.Join(netsim.PresetNames(), ", ")))
+	serveCmd.PersistentFlags().DurationVar(&remoteEndpointSpecs.NetworkSimulation.Latency, "latency", 0, "Simulated latency added in each direction, e.g. 200ms")
+	serveCmd.PersistentFlags().DurationVar(&remoteEndpointSpecs.NetworkSimulation.Jitter, "jitter", 0, "Simulated random variation of the latency, e.g. 50ms")
+	serveCmd.PersistentFlags().Var((*bandwidthValue)(&remoteEndpointSpecs.NetworkSimulation.Bandwidth), "simulate-bandwidth", "Simulated bandwidth of each connection, e.g. 200KB/s")
+	serveCmd.PersistentFlags().Float64Var(&remoteEndpointSpecs.NetworkSimulation.ResetRate, "reset-rate", 0, "Probability of simulated connection reset, between 0 and 1")
+
+	serveCmd.PersistentFlags().StringSliceVar(&hooksSpecs.Webhooks, "webhook", []string{}, "URL to POST JSON tunnel events to, compatible with Slack incoming webhooks (can be used multiple times)")
+	serveCmd.PersistentFlags().StringVar(&hooksSpecs.WebhookSecret, "webhook-secret", "", fmt.Sprintf("Secret to sign webhook payloads with, HMAC-SHA256 is sent in %s header (defaults to LOOPHOLE_WEBHOOK_SECRET environment variable)", hooks.SignatureHeader))
+	serveCmd.PersistentFlags().StringArrayVar(&hooksSpecs.Commands, "hook-command", []string{}, "Shell command to run on tunnel events, given LOOPHOLE_EVENT, LOOPHOLE_SITE_URL and other LOOPHOLE_* environment variables (can be used multiple times)")
+	serveCmd.PersistentFlags().StringSliceVar(&hooksSpecs.Events, "hook-events", []string{}, fmt.Sprintf("Notify hooks only about given events: %s (defaults to all)", strings.Join(hooks.EventTypes, ", ")))
+	serveCmd.PersistentFlags().IntVar(&hooksSpecs.Retries, "hook-retries", 3, "Number of times failed hook deliveries are retried, with exponential backoff (webhooks only on network errors and 5xx responses)")
 
 	remoteEndpointSpecs.TunnelID = guid.NewString()
 }
 
+// rateValue is a flag accepting rates like 10r/s, stored as number of requests per second
+type rateValue float64
+
+func (v *rateValue) String() string {
+	if *v == 0 {
+		return ""
+	}
+	return ratelimit.FormatRate(float64(*v))
+}
+
+func (v *rateValue) Set(value string) error {
+	rate, err := ratelimit.ParseRate(value)
+	if err != nil {
+		return err
+	}
+	*v = rateValue(rate)
+	return nil
+}
+
+func (v *rateValue) Type() string {
+	return "rate"
+}
+
+// bandwidthValue is a flag accepting transfer rates like 5MB/s, stored as number of bytes per second
+type bandwidthValue int64
+
+func (v *bandwidthValue) String() string {
+	if *v == 0 {
+		return ""
+	}
+	return bandwidth.FormatSize(int64(*v)) + "/s"
+}
+
+func (v *bandwidthValue) Set(value string) error {
+	rate, err := bandwidth.ParseRate(value)
+	if err != nil {
+		return err
+	}
+	*v = bandwidthValue(rate)
+	return nil
+}
+
+func (v *bandwidthValue) Type() string {
+	return "bandwidth"
+}
+
+// sizeValue is a flag accepting sizes like 10GB, stored as number of bytes
+type sizeValue int64
+
+func (v *sizeValue) String() string {
+	if *v == 0 {
+		return ""
+	}
+	return bandwidth.FormatSize(int64(*v))
+}
+
+func (v *sizeValue) Set(value string) error {
+	size, err := bandwidth.ParseSize(value)
+	if err != nil {
+		return err
+	}
+	*v = sizeValue(size)
+	return nil
+}
+
+func (v *sizeValue) Type() string {
+	return "size"
+}
+
+// parseServeFlags processes flags common to all serve commands which need more than plain value
+func parseServeFlags(flagset *pflag.FlagSet) error {
+	secretFromEnvironment(flagset, "oidc-client-secret", "LOOPHOLE_OIDC_CLIENT_SECRET", &remoteEndpointSpecs.OIDC.ClientSecret)
+	secretFromEnvironment(flagset, "webhook-secret", "LOOPHOLE_WEBHOOK_SECRET", &hooksSpecs.WebhookSecret)
+	err := parseExpiryFlags()
+	if err != nil {
+		return err
+	}
+	err = parseSimulationFlags(flagset)
+	if err != nil {
+		return err
+	}
+	return installHooks()
+}
+
+// secretFromEnvironment reads the secret from the environment variable unless the flag was given, the variable
+// isn't used as the flag default, so that the secret doesn't show up in help and generated docs
+func secretFromEnvironment(flagset *pflag.FlagSet, name string, variable string, value *string) {
+	if !flagset.Changed(name) {
+		*value = os.Getenv(variable)
+	}
+}
+
+// hookQueueSize is number of communicates waiting for the hooks, so that slow deliveries don't stall the tunnel
+const hookQueueSize = 64
+
+// installHooks makes tunnel events delivered to the configured webhooks and commands
+func installHooks() error {
+	if !hooksSpecs.Enabled() {
+		return nil
+	}
+	dispatcher, err := hooks.NewDispatcher(hooksSpecs)
+	if err != nil {
+		return err
+	}
+	communication.AddSink(communication.Sink{Mechanism: hooks.NewNotifier(dispatcher), QueueSize: hookQueueSize})
+	return nil
+}
+
+func parseSimulationFlags(flagset *pflag.FlagSet) error {
+	simulation := &remoteEndpointSpecs.NetworkSimulation
+	if simulation.ResetRate < 0 || simulation.ResetRate > 1 {
+		return fmt.Errorf("Invalid --reset-rate value %g, expected probability between 0 and 1", simulation.ResetRate)
+	}
+	if simulatePresetFlag == "" {
+		return nil
+	}
+	preset, err := netsim.Preset(simulatePresetFlag)
+	if err != nil {
+		return err
+	}
+	// explicitly set values take precedence over the preset, including zero which turns the condition off
+	if !flagset.Changed("latency") {
+		simulation.Latency = preset.Latency
+	}
+	if !flagset.Changed("jitter") {
+		simulation.Jitter = preset.Jitter
+	}
+	if !flagset.Changed("simulate-bandwidth") {
+		simulation.Bandwidth = preset.Bandwidth
+	}
+	if !flagset.Changed("reset-rate") {
+		simulation.ResetRate = preset.ResetRate
+	}
+	return nil
+}
+
+func parseExpiryFlags() error {
+	if expiresAtFlag == "" {
+		return nil
+	}
+	expiresAt, err := parseExpiryTime(expiresAtFlag, time.Now())
+	if err != nil {
+		return err
+	}
+	remoteEndpointSpecs.ExpiresAt = expiresAt
+	return nil
+}
+
+// parseExpiryTime accepts RFC3339 timestamp, local date and time or just local time of the day,
+// which refers to the nearest such moment in the future; moments in the past are rejected
+func parseExpiryTime(value string, now time.Time) (time.Time, error) {
+	expiresAt, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		expiresAt, err = time.ParseInLocation("2006-01-02 15:04", value, now.Location())
+	}
+	if err != nil {
+		timeOfDay, err := time.ParseInLocation("15:04", value, now.Location())
+		if err != nil {
+			return time.Time{}, fmt.Errorf("Invalid --expires-at value '%s', expected e.g. 18:00, '2006-01-02 15:04' or RFC3339 timestamp", value)
+		}
+		expiresAt = time.Date(now.Year(), now.Month(), now.Day(), timeOfDay.Hour(), timeOfDay.Minute(), 0, 0, now.Location())
+		if !expiresAt.After(now) {
+			expiresAt = expiresAt.AddDate(0, 0, 1)
+		}
+	}
+	if !expiresAt.After(now) {
+		return time.Time{}, fmt.Errorf("Invalid --expires-at value '%s', the time has already passed", value)
+	}
+	return expiresAt, nil
+}
+
+// initShareLinkFlags adds share link flags, available only for commands exposing directories
+func initShareLinkFlags(serveCmd *cobra.Command) {
+	serveCmd.Flags().DurationVar(&shareLinkSpecs.TTL, "share-ttl", 0, "Make the site available only via signed share link valid for given duration, e.g. 24h")
+	serveCmd.Flags().StringVar(&shareLinkSpecs.Path, "share-path", "", "Limit share link to given file or subdirectory, e.g. /reports/q3.pdf")
+	serveCmd.Flags().IntVar(&shareLinkSpecs.MaxDownloads, "max-downloads", 0, "Maximum number of file downloads via the share link, resumed downloads aren't counted (0 means unlimited)")
+}
+
 func parseBasicAuthFlags(flagset *pflag.FlagSet) error {
 	usernameProvided := false
 	passwordProvided := false
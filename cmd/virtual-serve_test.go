@@ -0,0 +1,94 @@
+// +build !desktop
+
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	lm "github.com/loophole/cli/internal/app/loophole/models"
+	"github.com/spf13/pflag"
+)
+
+func TestParseExpiryTime(t *testing.T) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	cases := map[string]time.Time{
+		"18:00":                now.Add(6 * time.Hour),
+		"09:30":                time.Date(2021, 6, 2, 9, 30, 0, 0, time.UTC),
+		"2021-06-03 08:00":     time.Date(2021, 6, 3, 8, 0, 0, 0, time.UTC),
+		"2021-06-01T13:00:00Z": now.Add(time.Hour),
+	}
+	for value, expected := range cases {
+		expiresAt, err := parseExpiryTime(value, now)
+		if err != nil {
+			t.Fatalf("Expiry time '%s' was rejected: %v", value, err)
+		}
+		if !expiresAt.Equal(expected) {
+			t.Fatalf("Expiry time '%s' was parsed as %s instead of %s", value, expiresAt, expected)
+		}
+	}
+}
+
+func TestParseExpiryTimeRejectsPastAndInvalidValues(t *testing.T) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	for _, value := range []string{"2021-05-31 18:00", "2021-06-01T12:00:00Z", "tomorrow", "25:00"} {
+		if _, err := parseExpiryTime(value, now); err == nil {
+			t.Fatalf("Expiry time '%s' was accepted", value)
+		}
+	}
+}
+
+func TestParseSimulationFlagsKeepsExplicitZero(t *testing.T) {
+	defer func(specs lm.NetworkSimulationSpecs, preset string) {
+		remoteEndpointSpecs.NetworkSimulation, simulatePresetFlag = specs, preset
+	}(remoteEndpointSpecs.NetworkSimulation, simulatePresetFlag)
+
+	flagset := pflag.NewFlagSet("http", pflag.ContinueOnError)
+	flagset.StringVar(&simulatePresetFlag, "simulate", "", "")
+	flagset.DurationVar(&remoteEndpointSpecs.NetworkSimulation.Latency, "latency", 0, "")
+	flagset.DurationVar(&remoteEndpointSpecs.NetworkSimulation.Jitter, "jitter", 0, "")
+	flagset.Var((*bandwidthValue)(&remoteEndpointSpecs.NetworkSimulation.Bandwidth), "simulate-bandwidth", "")
+	flagset.Float64Var(&remoteEndpointSpecs.NetworkSimulation.ResetRate, "reset-rate", 0, "")
+	if err := flagset.Parse([]string{"--simulate", "3g", "--reset-rate", "0", "--latency", "250ms"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := parseSimulationFlags(flagset); err != nil {
+		t.Fatal(err)
+	}
+	simulation := remoteEndpointSpecs.NetworkSimulation
+	if simulation.ResetRate != 0 {
+		t.Fatalf("Explicit zero reset rate was replaced with %g", simulation.ResetRate)
+	}
+	if simulation.Latency != 250*time.Millisecond {
+		t.Fatalf("Explicit latency was replaced with %s", simulation.Latency)
+	}
+	if simulation.Jitter != 50*time.Millisecond || simulation.Bandwidth != 200*1000 {
+		t.Fatalf("Preset values weren't applied: %+v", simulation)
+	}
+}
+
+func TestSecretFromEnvironment(t *testing.T) {
+	t.Setenv("LOOPHOLE_TEST_SECRET", "from-environment")
+	for _, name := range []string{"oidc-client-secret", "webhook-secret"} {
+		if flag := httpCmd.PersistentFlags().Lookup(name); flag.DefValue != "" {
+			t.Fatalf("Secret is shown as the default of --%s: '%s'", name, flag.DefValue)
+		}
+	}
+
+	var secret string
+	flagset := pflag.NewFlagSet("http", pflag.ContinueOnError)
+	flagset.StringVar(&secret, "secret", "", "")
+	secretFromEnvironment(flagset, "secret", "LOOPHOLE_TEST_SECRET", &secret)
+	if secret != "from-environment" {
+		t.Fatalf("Secret wasn't read from the environment: '%s'", secret)
+	}
+
+	if err := flagset.Parse([]string{"--secret", "explicit"}); err != nil {
+		t.Fatal(err)
+	}
+	secretFromEnvironment(flagset, "secret", "LOOPHOLE_TEST_SECRET", &secret)
+	if secret != "explicit" {
+		t.Fatalf("Explicit secret was replaced with '%s'", secret)
+	}
+}
@@ -4,9 +4,11 @@ package cmd
 
 import (
 	"errors"
+	"fmt"
 
 	"github.com/loophole/cli/internal/app/loophole"
 	lm "github.com/loophole/cli/internal/app/loophole/models"
+	"github.com/loophole/cli/internal/pkg/closehandler"
 	"github.com/loophole/cli/internal/pkg/communication"
 	"github.com/loophole/cli/internal/pkg/token"
 
@@ -29,6 +31,7 @@ To expose local directory via webdav (e.g. /data/my-data) simply use 'loophole w
 		communication.ApplicationStart(loggedIn, idToken)
 
 		checkVersion()
+		closehandler.SetupCloseHandler()
 
 		webdavEndpointSpecs.Path = args[0]
 		quitChannel := make(chan bool)
@@ -36,6 +39,7 @@ To expose local directory via webdav (e.g. /data/my-data) simply use 'loophole w
 		exposeConfig := lm.ExposeWebdavConfig{
 			Local:  webdavEndpointSpecs,
 			Remote: remoteEndpointSpecs,
+			Share:  shareLinkSpecs,
 		}
 
 		authMethod, err := loophole.RegisterTunnel(&exposeConfig.Remote)
@@ -52,12 +56,21 @@ To expose local directory via webdav (e.g. /data/my-data) simply use 'loophole w
 		return nil
 	},
 	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
-		return parseBasicAuthFlags(cmd.Flags())
+		err := parseBasicAuthFlags(cmd.Flags())
+		if err != nil {
+			return err
+		}
+		if len(remoteEndpointSpecs.ReadOnlyUsers) > 0 && remoteEndpointSpecs.BasicAuthUsername == "" && remoteEndpointSpecs.HtpasswdFile == "" {
+			return fmt.Errorf("--read-only-user requires users to log in, use it with %s or --htpasswd", basicAuthUsernameFlagName)
+		}
+		return parseServeFlags(cmd.Flags())
 	},
 }
 
 func init() {
 	initServeCommand(webdavCmd)
+	initShareLinkFlags(webdavCmd)
+	webdavCmd.Flags().StringSliceVar(&remoteEndpointSpecs.ReadOnlyUsers, "read-only-user", []string{}, "basic auth or htpasswd user allowed only to read files (can be used multiple times)")
 
 	rootCmd.AddCommand(webdavCmd)
 }
@@ -13,7 +13,6 @@ require (
 	github.com/mdp/qrterminal v1.0.1
 	github.com/mitchellh/go-homedir v1.1.0
 	github.com/ncruces/zenity v0.5.2
-	github.com/pkg/errors v0.9.1
 	github.com/rs/zerolog v1.19.0
 	github.com/skratchdot/open-golang v0.0.0-20200116055534-eef842397966
 	github.com/spf13/cobra v1.0.0
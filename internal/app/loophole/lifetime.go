@@ -0,0 +1,140 @@
+package loophole
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	lm "github.com/loophole/cli/internal/app/loophole/models"
+)
+
+// expiryAnnouncementThresholds are the remaining times at which upcoming shutdown is announced again
+var expiryAnnouncementThresholds = []time.Duration{
+	time.Hour, 30 * time.Minute, 10 * time.Minute, 5 * time.Minute, time.Minute, 10 * time.Second,
+}
+
+// expiryRescheduleThreshold is how much the deadline has to move because of traffic to announce it again
+const expiryRescheduleThreshold = 5 * time.Minute
+
+// tunnelLifetime keeps track of the moment tunnel should be shut down, either because
+// the configured time is reached or because there was no traffic for the idle period;
+// connections kept open without any traffic, e.g. keep-alive or idle websockets, don't count as activity
+type tunnelLifetime struct {
+	deadline        time.Time
+	idleTimeout     time.Duration
+	lastActivity    time.Time
+	lastTransferred int64
+	announcedAt     time.Time
+	announcedExpiry time.Time
+	mutex           sync.Mutex
+}
+
+func newTunnelLifetime(remoteConfig lm.RemoteEndpointSpecs, now time.Time) *tunnelLifetime {
+	deadline := remoteConfig.ExpiresAt
+	if remoteConfig.ExpiresIn > 0 {
+		expiresIn := now.Add(remoteConfig.ExpiresIn)
+		if deadline.IsZero() || expiresIn.Before(deadline) {
+			deadline = expiresIn
+		}
+	}
+	return &tunnelLifetime{
+		deadline:     deadline,
+		idleTimeout:  remoteConfig.IdleTimeout,
+		lastActivity: now,
+	}
+}
+
+// Enabled returns whether tunnel is ever going to be shut down automatically
+func (t *tunnelLifetime) Enabled() bool {
+	return !t.deadline.IsZero() || t.idleTimeout > 0
+}
+
+func (t *tunnelLifetime) connectionOpened(now time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.lastActivity = now
+}
+
+// trafficObserved takes total number of bytes transferred by the tunnel, any change counts as activity
+func (t *tunnelLifetime) trafficObserved(transferred int64, now time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if transferred != t.lastTransferred {
+		t.lastTransferred = transferred
+		t.lastActivity = now
+	}
+}
+
+// ExpiresAt returns the moment tunnel is going to be shut down if nothing changes,
+// the idle deadline moves forward with traffic
+func (t *tunnelLifetime) ExpiresAt(now time.Time) time.Time {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.expiresAt(now)
+}
+
+func (t *tunnelLifetime) expiresAt(now time.Time) time.Time {
+	expiresAt := t.deadline
+	if t.idleTimeout > 0 {
+		idleDeadline := t.lastActivity.Add(t.idleTimeout)
+		if expiresAt.IsZero() || idleDeadline.Before(expiresAt) {
+			expiresAt = idleDeadline
+		}
+	}
+	return expiresAt
+}
+
+// Expired returns whether tunnel should be shut down
+func (t *tunnelLifetime) Expired(now time.Time) bool {
+	expiresAt := t.ExpiresAt(now)
+	return !expiresAt.IsZero() && !now.Before(expiresAt)
+}
+
+// ExpiryReason describes why the tunnel expired
+func (t *tunnelLifetime) ExpiryReason(now time.Time) string {
+	if !t.deadline.IsZero() && !now.Before(t.deadline) {
+		return "Tunnel reached its expiry time"
+	}
+	return fmt.Sprintf("No traffic for %s", t.idleTimeout)
+}
+
+// ShouldAnnounce returns whether remaining time should be communicated, which happens on start,
+// when crossing one of the thresholds and when the deadline moved noticeably because of traffic
+func (t *tunnelLifetime) ShouldAnnounce(now time.Time) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	expiresAt := t.expiresAt(now)
+	if expiresAt.IsZero() {
+		return false
+	}
+	announce := t.announcedAt.IsZero()
+	if expiryAnnouncementLevel(expiresAt.Sub(now)) > expiryAnnouncementLevel(t.announcedExpiry.Sub(t.announcedAt)) {
+		announce = true
+	}
+	if absDuration(expiresAt.Sub(t.announcedExpiry)) >= expiryRescheduleThreshold && now.Sub(t.announcedAt) >= expiryRescheduleThreshold {
+		announce = true
+	}
+	if announce {
+		t.announcedAt = now
+		t.announcedExpiry = expiresAt
+	}
+	return announce
+}
+
+// expiryAnnouncementLevel returns number of thresholds the remaining time already crossed
+func expiryAnnouncementLevel(remaining time.Duration) int {
+	level := 0
+	for _, threshold := range expiryAnnouncementThresholds {
+		if remaining <= threshold {
+			level++
+		}
+	}
+	return level
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
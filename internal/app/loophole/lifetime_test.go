@@ -0,0 +1,87 @@
+package loophole
+
+import (
+	"testing"
+	"time"
+
+	lm "github.com/loophole/cli/internal/app/loophole/models"
+)
+
+func TestTunnelLifetimeUsesEarliestDeadline(t *testing.T) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	lifetime := newTunnelLifetime(lm.RemoteEndpointSpecs{
+		ExpiresIn: 2 * time.Hour,
+		ExpiresAt: now.Add(time.Hour),
+	}, now)
+
+	if !lifetime.ExpiresAt(now).Equal(now.Add(time.Hour)) {
+		t.Fatalf("Expiry time %s is different than expected: %s", lifetime.ExpiresAt(now), now.Add(time.Hour))
+	}
+	if lifetime.Expired(now.Add(59 * time.Minute)) {
+		t.Fatalf("Tunnel should not expire before deadline")
+	}
+	if !lifetime.Expired(now.Add(time.Hour)) {
+		t.Fatalf("Tunnel should expire at deadline")
+	}
+}
+
+func TestTunnelLifetimeIdleTimeout(t *testing.T) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	lifetime := newTunnelLifetime(lm.RemoteEndpointSpecs{IdleTimeout: 30 * time.Minute}, now)
+
+	lifetime.connectionOpened(now.Add(10 * time.Minute))
+	lifetime.trafficObserved(1024, now.Add(20*time.Minute))
+	if lifetime.Expired(now.Add(49 * time.Minute)) {
+		t.Fatalf("Tunnel should not expire before idle timeout passes since last traffic")
+	}
+	lifetime.trafficObserved(4096, now.Add(time.Hour))
+	if lifetime.Expired(now.Add(time.Hour + 29*time.Minute)) {
+		t.Fatalf("Traffic should move the idle deadline forward")
+	}
+	if !lifetime.Expired(now.Add(time.Hour + 30*time.Minute)) {
+		t.Fatalf("Tunnel should expire after idle timeout")
+	}
+}
+
+func TestTunnelLifetimeIdleTimeoutIgnoresOpenConnections(t *testing.T) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	lifetime := newTunnelLifetime(lm.RemoteEndpointSpecs{IdleTimeout: 30 * time.Minute}, now)
+
+	// keep-alive connection is open, but nothing is transferred over it
+	lifetime.connectionOpened(now.Add(time.Minute))
+	lifetime.trafficObserved(512, now.Add(2*time.Minute))
+	lifetime.trafficObserved(512, now.Add(20*time.Minute))
+	if !lifetime.Expired(now.Add(32 * time.Minute)) {
+		t.Fatalf("Tunnel should expire when open connection has no traffic")
+	}
+}
+
+func TestTunnelLifetimeAnnouncements(t *testing.T) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	lifetime := newTunnelLifetime(lm.RemoteEndpointSpecs{ExpiresIn: 2 * time.Hour}, now)
+
+	testCases := []struct {
+		elapsed  time.Duration
+		expected bool
+	}{
+		{0, true},
+		{time.Second, false},
+		{30 * time.Minute, false},
+		{time.Hour, true},
+		{time.Hour + time.Second, false},
+		{90 * time.Minute, true},
+		{119 * time.Minute, true},
+	}
+	for _, testCase := range testCases {
+		if announced := lifetime.ShouldAnnounce(now.Add(testCase.elapsed)); announced != testCase.expected {
+			t.Fatalf("Announcement after %s was %t, expected %t", testCase.elapsed, announced, testCase.expected)
+		}
+	}
+}
+
+func TestTunnelLifetimeDisabledByDefault(t *testing.T) {
+	lifetime := newTunnelLifetime(lm.RemoteEndpointSpecs{}, time.Now())
+	if lifetime.Enabled() || lifetime.Expired(time.Now().Add(24*time.Hour)) {
+		t.Fatalf("Tunnel without expiry settings should never expire")
+	}
+}
@@ -0,0 +1,60 @@
+package loophole
+
+import (
+	"fmt"
+	"strings"
+
+	lm "github.com/loophole/cli/internal/app/loophole/models"
+	"github.com/loophole/cli/internal/pkg/communication"
+	"github.com/loophole/cli/internal/pkg/httpserver"
+	"github.com/loophole/cli/internal/pkg/metrics"
+)
+
+// RejectedConnectionsMetric is the name of per site counter of connections rejected because of concurrent connections limit
+const RejectedConnectionsMetric = "tunnel_connections_rejected"
+
+// limitsReporter periodically logs how many requests and connections were rejected because of the limits
+type limitsReporter struct {
+	tunnelID                string
+	rateLimitedRequests     *metrics.Counter
+	rejectedConnections     *metrics.Counter
+	lastRateLimitedRequests int64
+	lastRejectedConnections int64
+}
+
+func newLimitsReporter(remoteConfig lm.RemoteEndpointSpecs) *limitsReporter {
+	reporter := &limitsReporter{
+		tunnelID:            remoteConfig.TunnelID,
+		rateLimitedRequests: metrics.GetSiteCounter(httpserver.RateLimitedRequestsMetric, remoteConfig.SiteID),
+		rejectedConnections: metrics.GetSiteCounter(RejectedConnectionsMetric, remoteConfig.SiteID),
+	}
+	reporter.lastRateLimitedRequests = reporter.rateLimitedRequests.Value()
+	reporter.lastRejectedConnections = reporter.rejectedConnections.Value()
+	return reporter
+}
+
+// addTotals fills the numbers of rejected requests and connections, so that they're part of the tunnel status
+func (r *limitsReporter) addTotals(stats *lm.TrafficStats) {
+	stats.RateLimitedRequests = r.rateLimitedRequests.Value()
+	stats.RejectedConnections = r.rejectedConnections.Value()
+}
+
+func (r *limitsReporter) report() {
+	rateLimitedRequests := r.rateLimitedRequests.Value()
+	rejectedConnections := r.rejectedConnections.Value()
+
+	rejections := []string{}
+	if rateLimitedRequests > r.lastRateLimitedRequests {
+		rejections = append(rejections, fmt.Sprintf("%d requests over the rate limit", rateLimitedRequests-r.lastRateLimitedRequests))
+	}
+	if rejectedConnections > r.lastRejectedConnections {
+		rejections = append(rejections, fmt.Sprintf("%d connections over the concurrent connections limit", rejectedConnections-r.lastRejectedConnections))
+	}
+	if len(rejections) > 0 {
+		communication.TunnelWarn(r.tunnelID, fmt.Sprintf("Rejected %s since last report (%d and %d in total)",
+			strings.Join(rejections, " and "), rateLimitedRequests, rejectedConnections))
+	}
+
+	r.lastRateLimitedRequests = rateLimitedRequests
+	r.lastRejectedConnections = rejectedConnections
+}
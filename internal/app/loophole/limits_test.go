@@ -0,0 +1,23 @@
+package loophole
+
+import (
+	"testing"
+
+	lm "github.com/loophole/cli/internal/app/loophole/models"
+	"github.com/loophole/cli/internal/pkg/httpserver"
+	"github.com/loophole/cli/internal/pkg/metrics"
+)
+
+func TestLimitsAreReportedInTrafficStats(t *testing.T) {
+	remoteConfig := lm.RemoteEndpointSpecs{TunnelID: "tunnel", SiteID: "limits-test"}
+	reporter := newLimitsReporter(remoteConfig)
+	metrics.GetSiteCounter(httpserver.RateLimitedRequestsMetric, remoteConfig.SiteID).Inc()
+	metrics.GetSiteCounter(httpserver.RateLimitedRequestsMetric, remoteConfig.SiteID).Inc()
+	metrics.GetSiteCounter(RejectedConnectionsMetric, remoteConfig.SiteID).Inc()
+
+	stats := lm.TrafficStats{}
+	reporter.addTotals(&stats)
+	if stats.RateLimitedRequests != 2 || stats.RejectedConnections != 1 {
+		t.Fatalf("Unexpected numbers of rejections in the stats: %+v", stats)
+	}
+}
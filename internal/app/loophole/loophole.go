@@ -1,18 +1,30 @@
 package loophole
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/loophole/cli/config"
 	lm "github.com/loophole/cli/internal/app/loophole/models"
 	"github.com/loophole/cli/internal/pkg/apiclient"
+	"github.com/loophole/cli/internal/pkg/bandwidth"
+	"github.com/loophole/cli/internal/pkg/cache"
+	"github.com/loophole/cli/internal/pkg/certstore"
 	"github.com/loophole/cli/internal/pkg/communication"
+	"github.com/loophole/cli/internal/pkg/healthcheck"
 	"github.com/loophole/cli/internal/pkg/httpserver"
 	"github.com/loophole/cli/internal/pkg/keys"
+	"github.com/loophole/cli/internal/pkg/metrics"
+	"github.com/loophole/cli/internal/pkg/netsim"
+	"github.com/loophole/cli/internal/pkg/proxyprotocol"
+	"github.com/loophole/cli/internal/pkg/sharelink"
 	"github.com/loophole/cli/internal/pkg/urlmaker"
 	"golang.org/x/crypto/ssh"
 )
@@ -35,13 +47,17 @@ var remoteEndpoint = lm.Endpoint{
 	Port: 80,
 }
 
-func handleClient(tunnelID string, client net.Conn, local net.Conn) {
+func handleClient(tunnelID string, client net.Conn, local net.Conn, traffic *trafficControl) {
 	defer client.Close()
 	chDone := make(chan bool)
+	toClient, toLocal := traffic.writers(client, local)
+	if delay, reset := traffic.simulator.ScheduleReset(client); reset {
+		communication.TunnelDebug(tunnelID, fmt.Sprintf("Simulating connection reset in %s", delay))
+	}
 
 	// Start local -> client data transfer
 	go func() {
-		nob, err := io.Copy(client, local)
+		nob, err := io.Copy(toClient, local)
 		communication.TunnelDebug(tunnelID, fmt.Sprintf("Transfered out %d bytes", nob))
 		if err != nil {
 			if err != io.EOF {
@@ -55,7 +71,7 @@ func handleClient(tunnelID string, client net.Conn, local net.Conn) {
 
 	// Start client -> local data transfer
 	go func() {
-		nob, err := io.Copy(local, client)
+		nob, err := io.Copy(toLocal, client)
 		communication.TunnelDebug(tunnelID, fmt.Sprintf("Received %d bytes", nob))
 		if err != nil {
 			if err != io.EOF {
@@ -123,19 +139,64 @@ func connectViaSSH(siteID string, tunnelID string, authMethod ssh.AuthMethod) (*
 	return serverSSHConnHTTPS, nil
 }
 
-func createTLSReverseProxy(localEndpoint lm.Endpoint, remoteConfig lm.RemoteEndpointSpecs) (*http.Server, error) {
+func createTLSReverseProxy(localEndpoints []lm.Endpoint, checkers []*healthcheck.Checker, localConfig lm.LocalHTTPEndpointSpecs, remoteConfig lm.RemoteEndpointSpecs) (*http.Server, error) {
+	localEndpoint := localEndpoints[0]
 	communication.LoadingStart(remoteConfig.TunnelID, "Starting local TLS proxy server")
 	serverBuilder := httpserver.New().
 		WithSiteID(remoteConfig.SiteID).
 		WithDomain(remoteConfig.Domain).
 		DisableOldCiphers(remoteConfig.DisableOldCiphers).
+		WithIPFilter(remoteConfig.AllowedCIDRs, remoteConfig.DeniedCIDRs, remoteConfig.AccessListFile).
+		WithOIDC(remoteConfig.OIDC).
+		WithRateLimit(remoteConfig.RateLimit).
+		WithTLS(remoteConfig.TLS).
+		WithErrorTemplate(remoteConfig.ErrorTemplateFile).
+		WithAccessLog(remoteConfig.AccessLog).
 		Proxy().
 		ToEndpoint(localEndpoint)
 
+	if len(localConfig.Routes) > 0 {
+		serverBuilder = serverBuilder.
+			WithRoutes(localConfig.Routes)
+	}
+	if localConfig.HostHeader != "" {
+		serverBuilder = serverBuilder.
+			WithHostHeader(localConfig.HostHeader)
+	}
+	if len(localConfig.RequestHeaders) > 0 {
+		serverBuilder = serverBuilder.
+			WithRequestHeaders(localConfig.RequestHeaders)
+	}
+	if len(localConfig.ResponseHeaders) > 0 {
+		serverBuilder = serverBuilder.
+			WithResponseHeaders(localConfig.ResponseHeaders)
+	}
+	if len(localEndpoints) > 1 {
+		serverBuilder = serverBuilder.
+			WithUpstreams(localEndpoints[1:], localConfig.LoadBalancing)
+	}
+	if len(checkers) > 0 {
+		serverBuilder = serverBuilder.
+			WithHealthChecks(checkers)
+	}
+	if localConfig.UpstreamProtocol != "" {
+		serverBuilder = serverBuilder.
+			WithUpstreamProtocol(localConfig.UpstreamProtocol)
+	}
+	if len(localConfig.Faults) > 0 {
+		serverBuilder = serverBuilder.
+			WithFaults(localConfig.Faults)
+	}
+
 	if remoteConfig.BasicAuthUsername != "" && remoteConfig.BasicAuthPassword != "" {
 		serverBuilder = serverBuilder.
 			WithBasicAuth(remoteConfig.BasicAuthUsername, remoteConfig.BasicAuthPassword)
 	}
+	if remoteConfig.HtpasswdFile != "" {
+		serverBuilder = serverBuilder.
+			WithHtpasswdFile(remoteConfig.HtpasswdFile)
+	}
+
 	if remoteConfig.DisableProxyErrorPage {
 		serverBuilder = serverBuilder.
 			DisableProxyErrorPage()
@@ -146,6 +207,17 @@ func createTLSReverseProxy(localEndpoint lm.Endpoint, remoteConfig lm.RemoteEndp
 	}
 
 	communication.TunnelDebug(remoteConfig.TunnelID, fmt.Sprintf("Proxy via http to %s created", localEndpoint.URI()))
+	if localConfig.UpstreamProtocol == lm.UpstreamProtocolH2 || localConfig.UpstreamProtocol == lm.UpstreamProtocolH2C {
+		if remoteConfig.TLS.DisableHTTP2 {
+			communication.TunnelWarn(remoteConfig.TunnelID, "HTTP/2 is disabled for the clients, gRPC requests won't work")
+		}
+	}
+	for _, route := range localConfig.Routes {
+		communication.TunnelDebug(remoteConfig.TunnelID, fmt.Sprintf("Route %s proxied to %s", route.Prefix, route.Endpoint.URI()))
+		if route.InsecureSkipVerify {
+			communication.TunnelWarn(remoteConfig.TunnelID, fmt.Sprintf("Certificate of %s is not verified", route.Endpoint.URI()))
+		}
+	}
 	server, err := serverBuilder.Build()
 	if err != nil {
 		communication.LoadingFailure(remoteConfig.TunnelID, err)
@@ -160,7 +232,7 @@ func startLocalHTTPServer(tunnelID string, server *http.Server) (*lm.Endpoint, e
 	communication.LoadingStart(tunnelID, "Starting local proxy server... ")
 
 	communication.TunnelDebug(tunnelID, "Server for proxy created")
-	localListener, err := net.Listen("tcp", ":0")
+	localListener, err := net.Listen("tcp", "127.0.0.1:0")
 	if err != nil {
 		communication.LoadingFailure(tunnelID, err)
 		communication.TunnelError(tunnelID, "Failed to listen on TLS proxy for HTTPS")
@@ -172,8 +244,9 @@ func startLocalHTTPServer(tunnelID string, server *http.Server) (*lm.Endpoint, e
 	}
 	communication.TunnelDebug(tunnelID, fmt.Sprintf("Proxy listener for HTTPS started on port %d", localListenerEndpoint.Port))
 	go func() {
-		err := server.ServeTLS(localListener, "", "")
-		if err != nil {
+		// every connection is prefixed with PROXY protocol header carrying the client address reported by the gateway
+		err := server.ServeTLS(proxyprotocol.NewListener(localListener), "", "")
+		if err != nil && err != http.ErrServerClosed {
 			communication.LoadingFailure(tunnelID, err)
 			communication.TunnelStartFailure(tunnelID, err)
 		}
@@ -211,6 +284,12 @@ func getStaticFileServer(exposeDirectoryConfig lm.ExposeDirectoryConfig) (*http.
 		WithSiteID(exposeDirectoryConfig.Remote.SiteID).
 		WithDomain(exposeDirectoryConfig.Remote.Domain).
 		DisableOldCiphers(exposeDirectoryConfig.Remote.DisableOldCiphers).
+		WithIPFilter(exposeDirectoryConfig.Remote.AllowedCIDRs, exposeDirectoryConfig.Remote.DeniedCIDRs, exposeDirectoryConfig.Remote.AccessListFile).
+		WithOIDC(exposeDirectoryConfig.Remote.OIDC).
+		WithRateLimit(exposeDirectoryConfig.Remote.RateLimit).
+		WithTLS(exposeDirectoryConfig.Remote.TLS).
+		WithErrorTemplate(exposeDirectoryConfig.Remote.ErrorTemplateFile).
+		WithAccessLog(exposeDirectoryConfig.Remote.AccessLog).
 		ServeStatic().
 		FromDirectory(exposeDirectoryConfig.Local.Path)
 
@@ -218,6 +297,29 @@ func getStaticFileServer(exposeDirectoryConfig lm.ExposeDirectoryConfig) (*http.
 		serverBuilder = serverBuilder.
 			WithBasicAuth(exposeDirectoryConfig.Remote.BasicAuthUsername, exposeDirectoryConfig.Remote.BasicAuthPassword)
 	}
+	if exposeDirectoryConfig.Remote.HtpasswdFile != "" {
+		serverBuilder = serverBuilder.
+			WithHtpasswdFile(exposeDirectoryConfig.Remote.HtpasswdFile)
+	}
+
+	var shareLinkKey []byte
+	if exposeDirectoryConfig.Share.Enabled() {
+		key, err := sharelink.LoadOrCreateKey(cache.GetLocalStorageFile("share-links.key", ""))
+		if err != nil {
+			communication.LoadingFailure(exposeDirectoryConfig.Remote.TunnelID, err)
+			communication.TunnelError(exposeDirectoryConfig.Remote.TunnelID, "Failed to load share link signing key")
+			return nil, err
+		}
+		downloads, err := sharelink.LoadDownloads(cache.GetLocalStorageFile("share-links.downloads", ""))
+		if err != nil {
+			communication.LoadingFailure(exposeDirectoryConfig.Remote.TunnelID, err)
+			communication.TunnelError(exposeDirectoryConfig.Remote.TunnelID, "Failed to load share link download counts")
+			return nil, err
+		}
+		shareLinkKey = key
+		serverBuilder = serverBuilder.
+			WithShareLinks(shareLinkKey, downloads)
+	}
 
 	communication.LoadingSuccess(exposeDirectoryConfig.Remote.TunnelID)
 	server, err := serverBuilder.Build()
@@ -226,6 +328,11 @@ func getStaticFileServer(exposeDirectoryConfig lm.ExposeDirectoryConfig) (*http.
 		communication.TunnelError(exposeDirectoryConfig.Remote.TunnelID, "Something went wrong while creating server")
 		return nil, err
 	}
+	if shareLinkKey != nil {
+		if err := announceShareLink(exposeDirectoryConfig.Remote, exposeDirectoryConfig.Share, shareLinkKey); err != nil {
+			return nil, err
+		}
+	}
 	return server, nil
 }
 
@@ -235,6 +342,12 @@ func getWebdavServer(exposeWebDavConfig lm.ExposeWebdavConfig) (*http.Server, er
 		WithSiteID(exposeWebDavConfig.Remote.SiteID).
 		WithDomain(exposeWebDavConfig.Remote.Domain).
 		DisableOldCiphers(exposeWebDavConfig.Remote.DisableOldCiphers).
+		WithIPFilter(exposeWebDavConfig.Remote.AllowedCIDRs, exposeWebDavConfig.Remote.DeniedCIDRs, exposeWebDavConfig.Remote.AccessListFile).
+		WithOIDC(exposeWebDavConfig.Remote.OIDC).
+		WithRateLimit(exposeWebDavConfig.Remote.RateLimit).
+		WithTLS(exposeWebDavConfig.Remote.TLS).
+		WithErrorTemplate(exposeWebDavConfig.Remote.ErrorTemplateFile).
+		WithAccessLog(exposeWebDavConfig.Remote.AccessLog).
 		ServeWebdav().
 		FromDirectory(exposeWebDavConfig.Local.Path)
 
@@ -242,6 +355,33 @@ func getWebdavServer(exposeWebDavConfig lm.ExposeWebdavConfig) (*http.Server, er
 		serverBuilder = serverBuilder.
 			WithBasicAuth(exposeWebDavConfig.Remote.BasicAuthUsername, exposeWebDavConfig.Remote.BasicAuthPassword)
 	}
+	if exposeWebDavConfig.Remote.HtpasswdFile != "" {
+		serverBuilder = serverBuilder.
+			WithHtpasswdFile(exposeWebDavConfig.Remote.HtpasswdFile)
+	}
+	if len(exposeWebDavConfig.Remote.ReadOnlyUsers) > 0 {
+		serverBuilder = serverBuilder.
+			WithReadOnlyUsers(exposeWebDavConfig.Remote.ReadOnlyUsers)
+	}
+
+	var shareLinkKey []byte
+	if exposeWebDavConfig.Share.Enabled() {
+		key, err := sharelink.LoadOrCreateKey(cache.GetLocalStorageFile("share-links.key", ""))
+		if err != nil {
+			communication.LoadingFailure(exposeWebDavConfig.Remote.TunnelID, err)
+			communication.TunnelError(exposeWebDavConfig.Remote.TunnelID, "Failed to load share link signing key")
+			return nil, err
+		}
+		downloads, err := sharelink.LoadDownloads(cache.GetLocalStorageFile("share-links.downloads", ""))
+		if err != nil {
+			communication.LoadingFailure(exposeWebDavConfig.Remote.TunnelID, err)
+			communication.TunnelError(exposeWebDavConfig.Remote.TunnelID, "Failed to load share link download counts")
+			return nil, err
+		}
+		shareLinkKey = key
+		serverBuilder = serverBuilder.
+			WithShareLinks(shareLinkKey, downloads)
+	}
 
 	communication.LoadingSuccess(exposeWebDavConfig.Remote.TunnelID)
 	server, err := serverBuilder.Build()
@@ -250,9 +390,70 @@ func getWebdavServer(exposeWebDavConfig lm.ExposeWebdavConfig) (*http.Server, er
 		communication.TunnelError(exposeWebDavConfig.Remote.TunnelID, "Something went wrong while creating server")
 		return nil, err
 	}
+	if shareLinkKey != nil {
+		if err := announceShareLink(exposeWebDavConfig.Remote, exposeWebDavConfig.Share, shareLinkKey); err != nil {
+			return nil, err
+		}
+	}
 	return server, nil
 }
 
+// announceShareLink signs new share link and prints it, since it's the only way to access the site
+func announceShareLink(remoteConfig lm.RemoteEndpointSpecs, shareLinkSpecs lm.ShareLinkSpecs, key []byte) error {
+	claims := sharelink.NewClaims(shareLinkSpecs.TTL, shareLinkSpecs.Path, shareLinkSpecs.MaxDownloads)
+	token, err := sharelink.Sign(key, claims)
+	if err != nil {
+		communication.TunnelError(remoteConfig.TunnelID, "Failed to sign share link")
+		return err
+	}
+	linkPath := shareLinkSpecs.Path
+	if linkPath == "" {
+		linkPath = "/"
+	}
+	communication.TunnelInfo(remoteConfig.TunnelID, fmt.Sprintf("Share link valid until %s: %s%s?%s=%s",
+		time.Unix(claims.ExpiresAt, 0).Format(time.RFC1123),
+		urlmaker.GetSiteURL("https", remoteConfig.SiteID, remoteConfig.Domain), linkPath,
+		httpserver.ShareLinkQueryParam, url.QueryEscape(token)))
+	return nil
+}
+
+// reportCertificateStatus logs expiry and OCSP status of the certificate served to the clients
+func reportCertificateStatus(tunnelID string, httpClient *http.Client, connectionState *tls.ConnectionState) {
+	if connectionState == nil || len(connectionState.PeerCertificates) == 0 {
+		return
+	}
+	certificate := connectionState.PeerCertificates[0]
+	message := fmt.Sprintf("TLS Certificate issued by %s, valid until %s", certificate.Issuer.CommonName, certificate.NotAfter.Local().Format(time.RFC1123))
+	if time.Until(certificate.NotAfter) < 7*24*time.Hour {
+		communication.TunnelWarn(tunnelID, message)
+	} else {
+		communication.TunnelInfo(tunnelID, message)
+	}
+
+	if len(connectionState.PeerCertificates) < 2 {
+		return
+	}
+	status, err := certstore.OCSPStatus(httpClient, certificate, connectionState.PeerCertificates[1])
+	if err != nil {
+		communication.TunnelDebug(tunnelID, fmt.Sprintf("Checking OCSP status failed: %s", err.Error()))
+		return
+	}
+	if status == "good" {
+		communication.TunnelInfo(tunnelID, fmt.Sprintf("TLS Certificate OCSP status: %s", status))
+	} else {
+		communication.TunnelWarn(tunnelID, fmt.Sprintf("TLS Certificate OCSP status: %s", status))
+	}
+}
+
+// shutdownGracefully lets the requests in progress finish before the tunnel is closed
+func shutdownGracefully(tunnelID string, server *http.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		communication.TunnelWarn(tunnelID, fmt.Sprintf("Failed to wait for requests in progress: %s", err.Error()))
+	}
+}
+
 func listenOnRemoteEndpoint(tunnelID string, serverSSHConnHTTPS *ssh.Client) (*net.Listener, error) {
 	listenerHTTPSOverSSH, err := serverSSHConnHTTPS.Listen("tcp", remoteEndpoint.URI())
 	if err != nil {
@@ -282,22 +483,74 @@ func RegisterTunnel(remoteConfig *lm.RemoteEndpointSpecs) (ssh.AuthMethod, error
 
 // ForwardPort is used to forward external URL to locally available port
 func ForwardPort(exposeHTTPConfig lm.ExposeHTTPConfig, publicKeyAuthMethod ssh.AuthMethod, quitChannel <-chan bool) error {
+	localEndpoints := getLocalEndpoints(exposeHTTPConfig.Local)
+
+	if err := lm.Validate(&exposeHTTPConfig.Local); err != nil {
+		communication.TunnelStartFailure(exposeHTTPConfig.Remote.TunnelID, err)
+		return err
+	}
+
+	var checkers []*healthcheck.Checker
+	if exposeHTTPConfig.Local.HealthCheck.Enabled() {
+		stopChecks := make(chan struct{})
+		defer close(stopChecks)
+		for _, endpoint := range localEndpoints {
+			checker := newUpstreamChecker(exposeHTTPConfig.Remote.TunnelID, endpoint, exposeHTTPConfig.Local)
+			go checker.Run(stopChecks)
+			checkers = append(checkers, checker)
+		}
+	}
+
+	server, err := createTLSReverseProxy(localEndpoints, checkers, exposeHTTPConfig.Local, exposeHTTPConfig.Remote)
+	if err != nil {
+		return err
+	}
+	return forward(exposeHTTPConfig.Remote, publicKeyAuthMethod, server, describeRoutes(localEndpoints, exposeHTTPConfig.Local.Routes), []string{"https"}, quitChannel)
+}
+
+// getLocalEndpoints returns the endpoint requests are proxied to when no route matches, followed by its replicas
+func getLocalEndpoints(local lm.LocalHTTPEndpointSpecs) []lm.Endpoint {
 	protocol := "http"
-	if exposeHTTPConfig.Local.HTTPS {
+	if local.HTTPS {
 		protocol = "https"
 	}
-	localEndpoint := lm.Endpoint{
+	endpoints := []lm.Endpoint{{
 		Protocol: protocol,
-		Host:     exposeHTTPConfig.Local.Host,
-		Port:     exposeHTTPConfig.Local.Port,
-		Path:     exposeHTTPConfig.Local.Path,
+		Host:     local.Host,
+		Port:     local.Port,
+		Path:     local.Path,
+		Socket:   local.Socket,
+	}}
+	for _, upstream := range local.Upstreams {
+		upstream.Protocol = protocol
+		upstream.Path = local.Path
+		endpoints = append(endpoints, upstream)
 	}
+	return endpoints
+}
 
-	server, err := createTLSReverseProxy(localEndpoint, exposeHTTPConfig.Remote)
-	if err != nil {
-		return err
+// describeRoutes produces human readable description of local endpoints, e.g. "/api -> http://127.0.0.1:8080, / -> http://127.0.0.1:5173"
+func describeRoutes(localEndpoints []lm.Endpoint, routes []lm.Route) string {
+	uris := []string{}
+	for _, endpoint := range localEndpoints {
+		uris = append(uris, endpoint.URI())
 	}
-	return forward(exposeHTTPConfig.Remote, publicKeyAuthMethod, server, localEndpoint.URI(), []string{"https"}, quitChannel)
+	localEndpoint := strings.Join(uris, " | ")
+	if len(routes) == 0 {
+		return localEndpoint
+	}
+	descriptions := []string{}
+	hasRootRoute := false
+	for _, route := range routes {
+		if route.Prefix == "/" {
+			hasRootRoute = true
+		}
+		descriptions = append(descriptions, fmt.Sprintf("%s -> %s", route.Prefix, route.Endpoint.URI()))
+	}
+	if !hasRootRoute {
+		descriptions = append(descriptions, fmt.Sprintf("/ -> %s", localEndpoint))
+	}
+	return strings.Join(descriptions, ", ")
 }
 
 // ForwardDirectory is used to expose local directory via HTTP (download only)
@@ -355,19 +608,56 @@ func forward(remoteEndpointSpecs lm.RemoteEndpointSpecs,
 			Timeout:   time.Second * 30,
 			Transport: netTransport,
 		}
-		_, err := netClient.Get(urlmaker.GetSiteURL("https", remoteEndpointSpecs.SiteID, remoteEndpointSpecs.Domain))
+		response, err := netClient.Get(urlmaker.GetSiteURL("https", remoteEndpointSpecs.SiteID, remoteEndpointSpecs.Domain))
 
 		if err != nil {
 			communication.TunnelError(remoteEndpointSpecs.TunnelID, "TLS Certificate failed to provision. Will be obtained with first request made by any client, therefore first execution may be slower")
 		} else {
+			response.Body.Close()
 			communication.TunnelInfo(remoteEndpointSpecs.TunnelID, "TLS Certificate successfully provisioned")
+			reportCertificateStatus(remoteEndpointSpecs.TunnelID, netClient, response.TLS)
 		}
 	}()
 
+	if remoteEndpointSpecs.OIDC.Enabled() {
+		communication.TunnelInfo(remoteEndpointSpecs.TunnelID, fmt.Sprintf("Single sign-on enabled, make sure %s%s is registered as redirect URL with your OIDC provider",
+			urlmaker.GetSiteURL("https", remoteEndpointSpecs.SiteID, remoteEndpointSpecs.Domain), httpserver.OIDCCallbackPath))
+	}
+
+	if remoteEndpointSpecs.NetworkSimulation.Enabled() {
+		communication.TunnelWarn(remoteEndpointSpecs.TunnelID, fmt.Sprintf("Simulating bad network conditions: %s", netsim.Describe(remoteEndpointSpecs.NetworkSimulation)))
+	}
+
 	communication.TunnelStartSuccess(remoteEndpointSpecs, localEndpoint)
 
 	acceptedClients := make(chan net.Conn)
 	tunnelTerminatedOnPurpose := false
+	visited := false
+
+	lifetime := newTunnelLifetime(remoteEndpointSpecs, time.Now())
+	var lifetimeTicks <-chan time.Time
+	if lifetime.Enabled() {
+		lifetimeTicker := time.NewTicker(time.Second)
+		defer lifetimeTicker.Stop()
+		lifetimeTicks = lifetimeTicker.C
+	}
+
+	var connectionSlots chan struct{}
+	if remoteEndpointSpecs.MaxConnections > 0 {
+		connectionSlots = make(chan struct{}, remoteEndpointSpecs.MaxConnections)
+	}
+	rejectedConnections := metrics.GetSiteCounter(RejectedConnectionsMetric, remoteEndpointSpecs.SiteID)
+	traffic := newTrafficControl(remoteEndpointSpecs, time.Now())
+	throughputTicker := time.NewTicker(time.Second)
+	defer throughputTicker.Stop()
+
+	limitsReporter := newLimitsReporter(remoteEndpointSpecs)
+	var limitsReportTicks <-chan time.Time
+	if remoteEndpointSpecs.RateLimit.Enabled() || connectionSlots != nil {
+		limitsReportTicker := time.NewTicker(time.Minute)
+		defer limitsReportTicker.Stop()
+		limitsReportTicks = limitsReportTicker.C
+	}
 
 	go func(l *net.Listener, tunnelTerminatedOnPurpose *bool) {
 		for {
@@ -376,7 +666,7 @@ func forward(remoteEndpointSpecs lm.RemoteEndpointSpecs,
 			communication.TunnelDebug(remoteEndpointSpecs.TunnelID, "Accepted")
 			if err == io.EOF {
 				if !(*tunnelTerminatedOnPurpose) {
-					communication.TunnelInfo(remoteEndpointSpecs.TunnelID, err.Error()+" Connection dropped, reconnecting...")
+					communication.TunnelRestart(remoteEndpointSpecs.TunnelID)
 					(*l).Close()
 					serverSSHConnHTTPS, err = connectViaSSH(remoteEndpointSpecs.SiteID, remoteEndpointSpecs.TunnelID, authMethod)
 					if err != nil {
@@ -412,17 +702,70 @@ func forward(remoteEndpointSpecs lm.RemoteEndpointSpecs,
 			tunnelTerminatedOnPurpose = true
 			communication.TunnelStopSuccess(remoteEndpointSpecs.TunnelID)
 			return nil
+		case now := <-lifetimeTicks:
+			lifetime.trafficObserved(traffic.meter.Transferred(), now)
+			if lifetime.Expired(now) {
+				tunnelTerminatedOnPurpose = true
+				communication.TunnelInfo(remoteEndpointSpecs.TunnelID, lifetime.ExpiryReason(now)+", shutting down...")
+				shutdownGracefully(remoteEndpointSpecs.TunnelID, server)
+				communication.TunnelStopSuccess(remoteEndpointSpecs.TunnelID)
+				return nil
+			}
+			if lifetime.ShouldAnnounce(now) {
+				communication.TunnelExpiration(remoteEndpointSpecs.TunnelID, lifetime.ExpiresAt(now))
+			}
+		case <-traffic.meter.Exhausted():
+			tunnelTerminatedOnPurpose = true
+			communication.TunnelInfo(remoteEndpointSpecs.TunnelID, fmt.Sprintf("Transfer quota of %s exhausted, shutting down...", bandwidth.FormatSize(remoteEndpointSpecs.Quota)))
+			shutdownGracefully(remoteEndpointSpecs.TunnelID, server)
+			communication.TunnelStopSuccess(remoteEndpointSpecs.TunnelID)
+			return nil
+		case now := <-throughputTicker.C:
+			if stats, changed := traffic.throughput(now); changed {
+				limitsReporter.addTotals(&stats)
+				communication.TunnelThroughput(remoteEndpointSpecs.TunnelID, stats)
+			}
+		case <-limitsReportTicks:
+			limitsReporter.report()
 		case client := <-acceptedClients:
 			communication.TunnelDebug(remoteEndpointSpecs.TunnelID, "Handling client")
+			if connectionSlots != nil {
+				select {
+				case connectionSlots <- struct{}{}:
+				default:
+					rejectedConnections.Inc()
+					communication.TunnelDebug(remoteEndpointSpecs.TunnelID, fmt.Sprintf("Limit of %d concurrent connections reached, rejecting connection", remoteEndpointSpecs.MaxConnections))
+					client.Close()
+					continue
+				}
+			}
+			if !visited {
+				visited = true
+				communication.TunnelFirstVisitor(remoteEndpointSpecs.TunnelID, client.RemoteAddr().String())
+			}
+			lifetime.connectionOpened(time.Now())
 			go func() {
+				if connectionSlots != nil {
+					defer func() { <-connectionSlots }()
+				}
 				communication.TunnelInfo(remoteEndpointSpecs.TunnelID, "Succeeded to accept connection over HTTPS")
+				communication.TunnelDebug(remoteEndpointSpecs.TunnelID, fmt.Sprintf("Client address reported by gateway: %s", client.RemoteAddr()))
 				communication.TunnelDebug(remoteEndpointSpecs.TunnelID, fmt.Sprintf("Dialing into local proxy for HTTPS: %s", localListenerEndpoint.URI()))
 				local, err := net.Dial("tcp", localListenerEndpoint.URI())
 				if err != nil {
 					communication.TunnelError(remoteEndpointSpecs.TunnelID, "Dialing into local proxy for HTTPS failed")
+					client.Close()
+					return
 				}
 				communication.TunnelDebug(remoteEndpointSpecs.TunnelID, "Dialing into local proxy for HTTPS succeeded")
-				handleClient(remoteEndpointSpecs.TunnelID, client, local)
+				err = proxyprotocol.WriteHeader(local, client.RemoteAddr(), client.LocalAddr())
+				if err != nil {
+					communication.TunnelError(remoteEndpointSpecs.TunnelID, "Passing client address to local proxy failed")
+					local.Close()
+					client.Close()
+					return
+				}
+				handleClient(remoteEndpointSpecs.TunnelID, client, local, traffic)
 			}()
 		}
 	}
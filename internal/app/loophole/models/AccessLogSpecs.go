@@ -0,0 +1,25 @@
+package models
+
+// Access log formats, any other format is treated as Go text/template
+const (
+	AccessLogFormatCommon   = "common"
+	AccessLogFormatCombined = "combined"
+	AccessLogFormatJSON     = "json"
+)
+
+// AccessLogStdout is the access log file name used to write the log to standard output
+const AccessLogStdout = "-"
+
+// AccessLogSpecs is collection of parameters used to record requests served by the tunnel,
+// log file is rotated when it grows over MaxSize bytes, keeping MaxBackups previous files
+type AccessLogSpecs struct {
+	File       string `json:"file"`
+	Format     string `json:"format"`
+	MaxSize    int64  `json:"maxSize"`
+	MaxBackups int    `json:"maxBackups"`
+}
+
+// Enabled returns whether access log is configured
+func (specs *AccessLogSpecs) Enabled() bool {
+	return specs.File != ""
+}
@@ -8,10 +8,15 @@ type Endpoint struct {
 	Host     string `json:"host"`
 	Port     int32  `json:"port"`
 	Path     string `json:"path"`
+	// Socket is the path of Unix domain socket, used instead of host and port when set
+	Socket string `json:"socket"`
 }
 
-// URI returns the full uri string protocol://host:port
+// URI returns the full uri string protocol://host:port, or protocol+unix:/path/to.sock for Unix sockets
 func (endpoint *Endpoint) URI() string {
+	if endpoint.Socket != "" {
+		return fmt.Sprintf("%s+unix:%s%s", endpoint.Protocol, endpoint.Socket, endpoint.Path)
+	}
 	if endpoint.Protocol != "" {
 		return fmt.Sprintf("%s://%s:%d%s", endpoint.Protocol, endpoint.Host, endpoint.Port, endpoint.Path)
 	}
@@ -20,5 +25,9 @@ func (endpoint *Endpoint) URI() string {
 
 // Hostname returns the hostname part of endpoint (not including protocol)
 func (endpoint *Endpoint) Hostname() string {
+	if endpoint.Socket != "" {
+		// requests sent over Unix socket still need a host
+		return "localhost"
+	}
 	return fmt.Sprintf("%s:%d", endpoint.Host, endpoint.Port)
 }
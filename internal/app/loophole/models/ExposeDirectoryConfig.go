@@ -4,4 +4,5 @@ package models
 type ExposeDirectoryConfig struct {
 	Local  LocalDirectorySpecs `json:"local"`
 	Remote RemoteEndpointSpecs `json:"remote"`
+	Share  ShareLinkSpecs      `json:"share"`
 }
@@ -4,4 +4,5 @@ package models
 type ExposeWebdavConfig struct {
 	Local  LocalDirectorySpecs `json:"local"`
 	Remote RemoteEndpointSpecs `json:"remote"`
+	Share  ShareLinkSpecs      `json:"share"`
 }
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FaultRule describes HTTP error injected for given percentage of requests under the path prefix
+type FaultRule struct {
+	Prefix     string  `json:"prefix"`
+	StatusCode int     `json:"statusCode"`
+	Percentage float64 `json:"percentage"`
+}
+
+// ValidateFaultRule checks if the fault rule is usable
+func ValidateFaultRule(rule *FaultRule) error {
+	if !strings.HasPrefix(rule.Prefix, "/") {
+		return fmt.Errorf("Fault path '%s' has to start with '/'", rule.Prefix)
+	}
+	if rule.StatusCode < 400 || rule.StatusCode > 599 {
+		return fmt.Errorf("Fault status code %d has to be between 400 and 599", rule.StatusCode)
+	}
+	if rule.Percentage <= 0 || rule.Percentage > 100 {
+		return fmt.Errorf("Fault percentage %g has to be between 0 and 100", rule.Percentage)
+	}
+	return nil
+}
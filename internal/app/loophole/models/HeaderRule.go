@@ -0,0 +1,27 @@
+package models
+
+// HeaderAction is used to define supported header manipulations
+type HeaderAction string
+
+const (
+	// HeaderActionSet replaces all values of the header
+	HeaderActionSet HeaderAction = "set"
+	// HeaderActionAdd appends value to the existing values of the header
+	HeaderActionAdd HeaderAction = "add"
+	// HeaderActionRemove removes the header
+	HeaderActionRemove HeaderAction = "remove"
+)
+
+const (
+	// HostHeaderRewrite sets Host header to the local endpoint address
+	HostHeaderRewrite = "rewrite"
+	// HostHeaderPreserve keeps Host header sent by the client (public hostname)
+	HostHeaderPreserve = "preserve"
+)
+
+// HeaderRule is describing single manipulation of request or response headers
+type HeaderRule struct {
+	Action HeaderAction `json:"action"`
+	Name   string       `json:"name"`
+	Value  string       `json:"value"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// HealthCheckSpecs is collection of parameters used to actively check whether local server is available,
+// server is checked by opening TCP connection, or by HTTP request when path is set
+type HealthCheckSpecs struct {
+	Path               string        `json:"path"`
+	Interval           time.Duration `json:"interval"`
+	Timeout            time.Duration `json:"timeout"`
+	HealthyThreshold   int           `json:"healthyThreshold"`
+	UnhealthyThreshold int           `json:"unhealthyThreshold"`
+}
+
+// Enabled returns whether health checks are configured
+func (specs *HealthCheckSpecs) Enabled() bool {
+	return specs.Interval > 0 || specs.Path != ""
+}
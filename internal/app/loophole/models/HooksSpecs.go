@@ -0,0 +1,16 @@
+package models
+
+// HooksSpecs is collection of parameters used to notify about tunnel lifecycle events,
+// by posting them to webhook URLs or running local commands
+type HooksSpecs struct {
+	Webhooks      []string `json:"webhooks"`
+	WebhookSecret string   `json:"webhookSecret"`
+	Commands      []string `json:"commands"`
+	Events        []string `json:"events"`
+	Retries       int      `json:"retries"`
+}
+
+// Enabled returns whether any hook is configured
+func (specs *HooksSpecs) Enabled() bool {
+	return len(specs.Webhooks) > 0 || len(specs.Commands) > 0
+}
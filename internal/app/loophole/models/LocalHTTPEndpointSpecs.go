@@ -2,6 +2,20 @@ package models
 
 import "fmt"
 
+// Protocols used to talk to the local server
+const (
+	UpstreamProtocolHTTP1 = "http1"
+	UpstreamProtocolH2    = "h2"
+	UpstreamProtocolH2C   = "h2c"
+)
+
+// Policies of balancing requests across upstreams
+const (
+	LoadBalancingRoundRobin       = "round-robin"
+	LoadBalancingLeastConnections = "least-connections"
+	LoadBalancingStickyCookie     = "sticky-cookie"
+)
+
 // LocalHTTPEndpointSpecs is collection of parameters used to describe
 // configuration for local port to be exposed
 type LocalHTTPEndpointSpecs struct {
@@ -9,14 +23,68 @@ type LocalHTTPEndpointSpecs struct {
 	Host  string `json:"host"`
 	HTTPS bool   `json:"https"`
 	Path  string `json:"path"`
+	// Socket is the path of Unix domain socket the server listens on, used instead of host and port when set
+	Socket string `json:"socket"`
+
+	Routes []Route `json:"routes"`
+
+	// Upstreams are replicas of the server requests are balanced across, in addition to the one given by host and port
+	Upstreams     []Endpoint `json:"upstreams"`
+	LoadBalancing string     `json:"loadBalancing"`
+
+	// UpstreamProtocol is one of the upstream protocols, HTTP/1.1 is used when empty
+	UpstreamProtocol string `json:"upstreamProtocol"`
+
+	HostHeader      string       `json:"hostHeader"`
+	RequestHeaders  []HeaderRule `json:"requestHeaders"`
+	ResponseHeaders []HeaderRule `json:"responseHeaders"`
+
+	Faults []FaultRule `json:"faults"`
+
+	HealthCheck HealthCheckSpecs `json:"healthCheck"`
+	// WaitForUpstream delays registering the tunnel until local server answers
+	WaitForUpstream bool `json:"waitForUpstream"`
 }
 
 func Validate(options *LocalHTTPEndpointSpecs) error {
-	if options.Port <= 0 {
+	if options.Socket == "" && options.Port <= 0 {
 		return fmt.Errorf("Port not set")
 	}
-	if options.Host == "" {
+	if options.Socket == "" && options.Host == "" {
 		return fmt.Errorf("Host not set")
 	}
+	switch options.UpstreamProtocol {
+	case "", UpstreamProtocolHTTP1:
+	case UpstreamProtocolH2:
+		if !options.HTTPS {
+			return fmt.Errorf("Upstream protocol '%s' requires HTTPS, use '%s' for HTTP/2 without TLS", UpstreamProtocolH2, UpstreamProtocolH2C)
+		}
+	case UpstreamProtocolH2C:
+		if options.HTTPS {
+			return fmt.Errorf("Upstream protocol '%s' can't be used with HTTPS, use '%s' instead", UpstreamProtocolH2C, UpstreamProtocolH2)
+		}
+	default:
+		return fmt.Errorf("Unknown upstream protocol '%s', expected one of: %s, %s, %s", options.UpstreamProtocol, UpstreamProtocolHTTP1, UpstreamProtocolH2, UpstreamProtocolH2C)
+	}
+	for _, upstream := range options.Upstreams {
+		if upstream.Socket == "" && (upstream.Port <= 0 || upstream.Host == "") {
+			return fmt.Errorf("Upstream '%s' needs host and port or socket", upstream.URI())
+		}
+	}
+	switch options.LoadBalancing {
+	case "", LoadBalancingRoundRobin, LoadBalancingLeastConnections, LoadBalancingStickyCookie:
+	default:
+		return fmt.Errorf("Unknown load balancing policy '%s', expected one of: %s, %s, %s", options.LoadBalancing, LoadBalancingRoundRobin, LoadBalancingLeastConnections, LoadBalancingStickyCookie)
+	}
+	for i := range options.Routes {
+		if err := ValidateRoute(&options.Routes[i]); err != nil {
+			return err
+		}
+	}
+	for i := range options.Faults {
+		if err := ValidateFaultRule(&options.Faults[i]); err != nil {
+			return err
+		}
+	}
 	return nil
 }
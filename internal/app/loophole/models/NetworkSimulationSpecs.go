@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// NetworkSimulationSpecs is collection of parameters used to simulate bad network conditions
+type NetworkSimulationSpecs struct {
+	Latency   time.Duration `json:"latency"`
+	Jitter    time.Duration `json:"jitter"`
+	Bandwidth int64         `json:"bandwidth"`
+	ResetRate float64       `json:"resetRate"`
+}
+
+// Enabled returns whether any network condition is simulated
+func (specs *NetworkSimulationSpecs) Enabled() bool {
+	return specs.Latency > 0 || specs.Jitter > 0 || specs.Bandwidth > 0 || specs.ResetRate > 0
+}
@@ -0,0 +1,15 @@
+package models
+
+// OIDCSpecs is collection of parameters used to protect site with OpenID Connect single sign-on
+type OIDCSpecs struct {
+	IssuerURL      string   `json:"issuerUrl"`
+	ClientID       string   `json:"clientId"`
+	ClientSecret   string   `json:"clientSecret"`
+	AllowedEmails  []string `json:"allowedEmails"`
+	AllowedDomains []string `json:"allowedDomains"`
+}
+
+// Enabled returns whether single sign-on is configured
+func (specs *OIDCSpecs) Enabled() bool {
+	return specs.IssuerURL != ""
+}
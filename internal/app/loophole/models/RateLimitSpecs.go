@@ -0,0 +1,14 @@
+package models
+
+// RateLimitSpecs is collection of parameters used to limit request rate, rates are given in requests per second
+type RateLimitSpecs struct {
+	Rate        float64 `json:"rate"`
+	Burst       int     `json:"burst"`
+	GlobalRate  float64 `json:"globalRate"`
+	GlobalBurst int     `json:"globalBurst"`
+}
+
+// Enabled returns whether any of the rate limits is set
+func (specs *RateLimitSpecs) Enabled() bool {
+	return specs.Rate > 0 || specs.GlobalRate > 0
+}
@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 // RemoteEndpointSpecs is collection of parameters used to describe
 // configuration for public endpoint
 type RemoteEndpointSpecs struct {
@@ -11,6 +13,30 @@ type RemoteEndpointSpecs struct {
 	TunnelID              string   `json:"tunnelId"`
 	BasicAuthUsername     string   `json:"basicAuthUsername"`
 	BasicAuthPassword     string   `json:"basicAuthPassword"`
+	HtpasswdFile          string   `json:"htpasswdFile"`
+	ReadOnlyUsers         []string `json:"readOnlyUsers"`
 	DisableProxyErrorPage bool     `json:"disableProxyErrorPage"`
+	ErrorTemplateFile     string   `json:"errorTemplateFile"`
 	DisableOldCiphers     bool     `json:"disableOldCiphers"`
+	AllowedCIDRs          []string `json:"allowedCidrs"`
+	DeniedCIDRs           []string `json:"deniedCidrs"`
+	AccessListFile        string   `json:"accessListFile"`
+
+	OIDC OIDCSpecs `json:"oidc"`
+	TLS  TLSSpecs  `json:"tls"`
+
+	AccessLog AccessLogSpecs `json:"accessLog"`
+
+	ExpiresIn   time.Duration `json:"expiresIn"`
+	ExpiresAt   time.Time     `json:"expiresAt"`
+	IdleTimeout time.Duration `json:"idleTimeout"`
+
+	RateLimit      RateLimitSpecs `json:"rateLimit"`
+	MaxConnections int            `json:"maxConnections"`
+
+	MaxBandwidth           int64 `json:"maxBandwidth"`
+	MaxConnectionBandwidth int64 `json:"maxConnectionBandwidth"`
+	Quota                  int64 `json:"quota"`
+
+	NetworkSimulation NetworkSimulationSpecs `json:"networkSimulation"`
 }
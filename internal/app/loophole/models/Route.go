@@ -0,0 +1,35 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Route is representing mapping between public path prefix and local endpoint
+type Route struct {
+	Prefix      string   `json:"prefix"`
+	Endpoint    Endpoint `json:"endpoint"`
+	StripPrefix bool     `json:"stripPrefix"`
+	// InsecureSkipVerify disables verification of the certificate presented by HTTPS endpoint
+	InsecureSkipVerify bool `json:"insecureSkipVerify"`
+}
+
+// ValidateRoute checks whether route can be used by the proxy
+func ValidateRoute(route *Route) error {
+	if !strings.HasPrefix(route.Prefix, "/") {
+		return fmt.Errorf("Route prefix '%s' has to start with '/'", route.Prefix)
+	}
+	if route.InsecureSkipVerify && route.Endpoint.Protocol != "https" {
+		return fmt.Errorf("Route '%s' can skip certificate verification only for https target", route.Prefix)
+	}
+	if route.Endpoint.Socket != "" {
+		return nil
+	}
+	if route.Endpoint.Port <= 0 {
+		return fmt.Errorf("Route '%s' port not set", route.Prefix)
+	}
+	if route.Endpoint.Host == "" {
+		return fmt.Errorf("Route '%s' host not set", route.Prefix)
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// ShareLinkSpecs is collection of parameters used to protect exposed directory with signed share link
+type ShareLinkSpecs struct {
+	TTL          time.Duration `json:"ttl"`
+	Path         string        `json:"path"`
+	MaxDownloads int           `json:"maxDownloads"`
+}
+
+// Enabled returns whether exposed directory is available only via share link
+func (specs *ShareLinkSpecs) Enabled() bool {
+	return specs.TTL > 0
+}
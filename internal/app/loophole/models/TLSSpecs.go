@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// TLS profiles following Mozilla server side TLS guidelines
+const (
+	TLSProfileModern       = "modern"
+	TLSProfileIntermediate = "intermediate"
+	TLSProfileLegacy       = "legacy"
+)
+
+// TLSSpecs is collection of parameters used to obtain TLS certificate for the site
+type TLSSpecs struct {
+	CertFile         string `json:"certFile"`
+	KeyFile          string `json:"keyFile"`
+	ACMEDirectoryURL string `json:"acmeDirectoryUrl"`
+	ACMEEmail        string `json:"acmeEmail"`
+	ACMECAFile       string `json:"acmeCaFile"`
+	// ClientCAFile enables mutual TLS, requiring client certificates signed by one of the CAs from the file
+	ClientCAFile string `json:"clientCaFile"`
+	// ClientCertPaths makes client certificate optional except for requests with given path prefixes
+	ClientCertPaths []string `json:"clientCertPaths"`
+	// Profile is one of the TLS profiles, adjusted by the explicitly provided settings below
+	Profile      string   `json:"profile"`
+	MinVersion   string   `json:"minVersion"`
+	CipherSuites []string `json:"cipherSuites"`
+	Curves       []string `json:"curves"`
+	DisableHTTP2 bool     `json:"disableHttp2"`
+	// HSTSMaxAge enables Strict-Transport-Security header when greater than zero
+	HSTSMaxAge time.Duration `json:"hstsMaxAge"`
+}
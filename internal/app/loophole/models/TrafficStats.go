@@ -0,0 +1,12 @@
+package models
+
+// TrafficStats describes current throughput and total transfer of the tunnel in bytes,
+// along with total numbers of requests and connections rejected because of the limits
+type TrafficStats struct {
+	InPerSecond         int64 `json:"inPerSecond"`
+	OutPerSecond        int64 `json:"outPerSecond"`
+	Transferred         int64 `json:"transferred"`
+	Quota               int64 `json:"quota"`
+	RateLimitedRequests int64 `json:"rateLimitedRequests"`
+	RejectedConnections int64 `json:"rejectedConnections"`
+}
@@ -0,0 +1,65 @@
+package loophole
+
+import (
+	"io"
+	"time"
+
+	lm "github.com/loophole/cli/internal/app/loophole/models"
+	"github.com/loophole/cli/internal/pkg/bandwidth"
+	"github.com/loophole/cli/internal/pkg/netsim"
+)
+
+// trafficControl throttles and meters traffic of all the tunneled connections
+type trafficControl struct {
+	meter                  *bandwidth.Meter
+	inbound                *bandwidth.Limiter
+	outbound               *bandwidth.Limiter
+	maxConnectionBandwidth int64
+	simulator              *netsim.Simulator
+
+	lastIn     int64
+	lastOut    int64
+	lastReport time.Time
+	idle       bool
+}
+
+func newTrafficControl(remoteConfig lm.RemoteEndpointSpecs, now time.Time) *trafficControl {
+	return &trafficControl{
+		meter:                  bandwidth.NewMeter(remoteConfig.Quota),
+		inbound:                bandwidth.NewLimiter(remoteConfig.MaxBandwidth),
+		outbound:               bandwidth.NewLimiter(remoteConfig.MaxBandwidth),
+		maxConnectionBandwidth: remoteConfig.MaxConnectionBandwidth,
+		simulator:              netsim.New(remoteConfig.NetworkSimulation),
+		lastReport:             now,
+		idle:                   true,
+	}
+}
+
+// writers wraps both sides of the tunneled connection, bandwidth limits and simulated
+// network conditions apply to each direction separately
+func (t *trafficControl) writers(client io.Writer, local io.Writer) (io.Writer, io.Writer) {
+	toClient := bandwidth.NewWriter(client, t.meter, bandwidth.Outbound, t.outbound, bandwidth.NewLimiter(t.maxConnectionBandwidth))
+	toLocal := bandwidth.NewWriter(local, t.meter, bandwidth.Inbound, t.inbound, bandwidth.NewLimiter(t.maxConnectionBandwidth))
+	return t.simulator.Writer(toClient), t.simulator.Writer(toLocal)
+}
+
+// throughput returns traffic statistics since the previous call, skipping the report
+// when there was no traffic since the last report which was idle already
+func (t *trafficControl) throughput(now time.Time) (lm.TrafficStats, bool) {
+	in, out := t.meter.Totals()
+	elapsed := now.Sub(t.lastReport).Seconds()
+	if elapsed <= 0 {
+		return lm.TrafficStats{}, false
+	}
+	stats := lm.TrafficStats{
+		InPerSecond:  int64(float64(in-t.lastIn) / elapsed),
+		OutPerSecond: int64(float64(out-t.lastOut) / elapsed),
+		Transferred:  in + out,
+		Quota:        t.meter.Quota(),
+	}
+	idle := in == t.lastIn && out == t.lastOut
+	report := !(idle && t.idle)
+
+	t.lastIn, t.lastOut, t.lastReport, t.idle = in, out, now, idle
+	return stats, report
+}
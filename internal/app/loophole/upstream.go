@@ -0,0 +1,61 @@
+package loophole
+
+import (
+	"fmt"
+	"net/http"
+
+	lm "github.com/loophole/cli/internal/app/loophole/models"
+	"github.com/loophole/cli/internal/pkg/communication"
+	"github.com/loophole/cli/internal/pkg/healthcheck"
+	"github.com/loophole/cli/internal/pkg/httpserver"
+)
+
+// newUpstreamChecker creates health checker reporting local server going down or up
+func newUpstreamChecker(tunnelID string, endpoint lm.Endpoint, local lm.LocalHTTPEndpointSpecs) *healthcheck.Checker {
+	return healthcheck.New(endpoint, local.HealthCheck, upstreamCheckTransport(endpoint, local), func(healthy bool, err error) {
+		reason := ""
+		if err != nil {
+			reason = err.Error()
+		}
+		communication.TunnelUpstreamStatus(tunnelID, endpoint.URI(), healthy, reason)
+	})
+}
+
+// upstreamCheckTransport speaks the protocol of the local server, so that e.g. h2c-only gRPC server passes HTTP checks
+func upstreamCheckTransport(endpoint lm.Endpoint, local lm.LocalHTTPEndpointSpecs) http.RoundTripper {
+	return httpserver.NewUpstreamTransport(endpoint, endpoint.Protocol == "https", local.UpstreamProtocol)
+}
+
+// WaitForUpstream blocks until local server (or any of its replicas) answers, so that the tunnel isn't registered
+// before requests can be served, returns error describing why the tunnel can't be started when quit before that
+func WaitForUpstream(exposeHTTPConfig lm.ExposeHTTPConfig, quitChannel <-chan bool) error {
+	localEndpoints := getLocalEndpoints(exposeHTTPConfig.Local)
+	checkers := []*healthcheck.Checker{}
+	for _, endpoint := range localEndpoints {
+		checker := healthcheck.New(endpoint, exposeHTTPConfig.Local.HealthCheck, upstreamCheckTransport(endpoint, exposeHTTPConfig.Local), nil)
+		if checker.Check() == nil {
+			return nil
+		}
+		checkers = append(checkers, checker)
+	}
+
+	communication.TunnelInfo(exposeHTTPConfig.Remote.TunnelID, fmt.Sprintf("Waiting for local server at %s to answer", describeRoutes(localEndpoints, nil)))
+	answered := make(chan int, len(checkers))
+	stopWaiting := make(chan bool)
+	defer close(stopWaiting)
+	for index, checker := range checkers {
+		go func(index int, checker *healthcheck.Checker) {
+			if checker.WaitUntilHealthy(stopWaiting) {
+				answered <- index
+			}
+		}(index, checker)
+	}
+
+	select {
+	case index := <-answered:
+		communication.TunnelUpstreamStatus(exposeHTTPConfig.Remote.TunnelID, localEndpoints[index].URI(), true, "")
+		return nil
+	case <-quitChannel:
+		return fmt.Errorf("Stopped before local server at %s answered, tunnel was not started", describeRoutes(localEndpoints, nil))
+	}
+}
@@ -0,0 +1,57 @@
+package loophole
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	lm "github.com/loophole/cli/internal/app/loophole/models"
+	"github.com/loophole/cli/internal/pkg/healthcheck"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+func TestUpstreamCheckSpeaksH2C(t *testing.T) {
+	upstream := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 {
+			w.WriteHeader(http.StatusHTTPVersionNotSupported)
+		}
+	}), &http2.Server{}))
+	defer upstream.Close()
+	upstreamURL, _ := url.Parse(upstream.URL)
+	port, _ := strconv.Atoi(upstreamURL.Port())
+	endpoint := lm.Endpoint{Protocol: "http", Host: "127.0.0.1", Port: int32(port)}
+	local := lm.LocalHTTPEndpointSpecs{
+		UpstreamProtocol: lm.UpstreamProtocolH2C,
+		HealthCheck:      lm.HealthCheckSpecs{Path: "/healthz"},
+	}
+
+	if err := healthcheck.New(endpoint, local.HealthCheck, upstreamCheckTransport(endpoint, local), nil).Check(); err != nil {
+		t.Fatalf("Health check of h2c upstream failed: %v", err)
+	}
+	if err := healthcheck.New(endpoint, local.HealthCheck, nil, nil).Check(); err == nil {
+		t.Fatalf("HTTP/1 health check of h2c-only upstream should fail")
+	}
+}
+
+func TestWaitForUpstreamReportsQuitBeforeAnswer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	quitChannel := make(chan bool)
+	close(quitChannel)
+	err = WaitForUpstream(lm.ExposeHTTPConfig{
+		Local: lm.LocalHTTPEndpointSpecs{Host: "127.0.0.1", Port: int32(port)},
+	}, quitChannel)
+	if err == nil || !strings.Contains(err.Error(), "not started") {
+		t.Fatalf("Quitting before local server answered wasn't reported: %v", err)
+	}
+}
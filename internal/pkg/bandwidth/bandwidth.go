@@ -0,0 +1,222 @@
+// Package bandwidth implements throttling and metering of transferred bytes
+package bandwidth
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrQuotaExhausted is returned by writers once the transfer quota is used up
+var ErrQuotaExhausted = errors.New("Transfer quota exhausted")
+
+// chunkSize is the largest write passed through at once, so that throttled transfers are smooth
+const chunkSize = 16 * 1024
+
+var sizeUnits = []struct {
+	suffix     string
+	multiplier float64
+}{
+	{"KIB", 1 << 10}, {"MIB", 1 << 20}, {"GIB", 1 << 30}, {"TIB", 1 << 40},
+	{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"TB", 1e12},
+	{"K", 1e3}, {"M", 1e6}, {"G", 1e9}, {"T", 1e12},
+	{"B", 1},
+}
+
+// ParseSize parses size like 10GB, 512MiB, 1.5MB or plain number of bytes
+func ParseSize(value string) (int64, error) {
+	normalized := strings.ToUpper(strings.TrimSpace(value))
+	multiplier := 1.0
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(normalized, unit.suffix) {
+			normalized = strings.TrimSpace(strings.TrimSuffix(normalized, unit.suffix))
+			multiplier = unit.multiplier
+			break
+		}
+	}
+	number, err := strconv.ParseFloat(normalized, 64)
+	if err != nil || number <= 0 {
+		return 0, fmt.Errorf("Invalid size '%s', expected positive value like 10GB or 512MiB", value)
+	}
+	return int64(number * multiplier), nil
+}
+
+// ParseRate parses transfer rate like 5MB/s or 512KiB/s and returns it in bytes per second
+func ParseRate(value string) (int64, error) {
+	normalized := strings.TrimSpace(value)
+	if !strings.HasSuffix(strings.ToLower(normalized), "/s") {
+		return 0, fmt.Errorf("Invalid rate '%s', expected value per second like 5MB/s", value)
+	}
+	return ParseSize(normalized[:len(normalized)-2])
+}
+
+// FormatSize formats number of bytes in human readable way, e.g. 1.5 MB
+func FormatSize(bytes int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	size := float64(bytes)
+	unit := 0
+	for size >= 1000 && unit < len(units)-1 {
+		size /= 1000
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d %s", bytes, units[unit])
+	}
+	return fmt.Sprintf("%.1f %s", size, units[unit])
+}
+
+// Limiter is a token bucket of bytes, allowing bursts of at most one second worth of transfer
+type Limiter struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+	mutex  sync.Mutex
+}
+
+// NewLimiter creates limiter of given rate in bytes per second, nil limiter is not limiting
+func NewLimiter(bytesPerSecond int64) *Limiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	return &Limiter{
+		rate:   float64(bytesPerSecond),
+		tokens: float64(bytesPerSecond),
+		last:   time.Now(),
+	}
+}
+
+// reserve takes n bytes from the bucket and returns how long to wait before transferring them
+func (l *Limiter) reserve(n int, now time.Time) time.Duration {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if elapsed := now.Sub(l.last).Seconds(); elapsed > 0 {
+		l.tokens = math.Min(l.rate, l.tokens+elapsed*l.rate)
+		l.last = now
+	}
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// Wait blocks until n bytes can be transferred
+func (l *Limiter) Wait(n int) {
+	if l == nil {
+		return
+	}
+	if delay := l.reserve(n, time.Now()); delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+// Meter counts transferred bytes and signals when the quota is exhausted
+type Meter struct {
+	in        int64
+	out       int64
+	quota     int64
+	exhausted chan struct{}
+	once      sync.Once
+}
+
+// NewMeter creates meter with given quota of bytes in both directions, 0 means no quota
+func NewMeter(quota int64) *Meter {
+	return &Meter{
+		quota:     quota,
+		exhausted: make(chan struct{}),
+	}
+}
+
+func (m *Meter) count(counter *int64, n int) {
+	atomic.AddInt64(counter, int64(n))
+	if m.quota > 0 && m.Transferred() >= m.quota {
+		m.once.Do(func() { close(m.exhausted) })
+	}
+}
+
+// Totals returns number of bytes received from and sent to clients
+func (m *Meter) Totals() (int64, int64) {
+	return atomic.LoadInt64(&m.in), atomic.LoadInt64(&m.out)
+}
+
+// Transferred returns number of bytes transferred in both directions
+func (m *Meter) Transferred() int64 {
+	in, out := m.Totals()
+	return in + out
+}
+
+// Quota returns the transfer quota, 0 means no quota
+func (m *Meter) Quota() int64 {
+	return m.quota
+}
+
+// Exhausted is closed once the quota is used up
+func (m *Meter) Exhausted() <-chan struct{} {
+	return m.exhausted
+}
+
+// Direction tells which meter counter the writer increments
+type Direction int
+
+const (
+	// Inbound is the traffic from clients to local server
+	Inbound Direction = iota
+	// Outbound is the traffic from local server to clients
+	Outbound
+)
+
+type writer struct {
+	w         io.Writer
+	meter     *Meter
+	direction Direction
+	limiters  []*Limiter
+}
+
+// NewWriter wraps the writer so that writes are counted by the meter and throttled by all the limiters,
+// nil limiters are ignored
+func NewWriter(w io.Writer, meter *Meter, direction Direction, limiters ...*Limiter) io.Writer {
+	return &writer{
+		w:         w,
+		meter:     meter,
+		direction: direction,
+		limiters:  limiters,
+	}
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		select {
+		case <-w.meter.Exhausted():
+			return written, ErrQuotaExhausted
+		default:
+		}
+
+		chunk := p
+		if len(chunk) > chunkSize {
+			chunk = chunk[:chunkSize]
+		}
+		for _, limiter := range w.limiters {
+			limiter.Wait(len(chunk))
+		}
+		n, err := w.w.Write(chunk)
+		written += n
+		if w.direction == Inbound {
+			w.meter.count(&w.meter.in, n)
+		} else {
+			w.meter.count(&w.meter.out, n)
+		}
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
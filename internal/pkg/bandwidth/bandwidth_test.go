@@ -0,0 +1,75 @@
+package bandwidth
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestParseSize(t *testing.T) {
+	testCases := []struct {
+		value    string
+		expected int64
+		valid    bool
+	}{
+		{"10GB", 10000000000, true},
+		{"512MiB", 512 * 1024 * 1024, true},
+		{"1.5kb", 1500, true},
+		{"100", 100, true},
+		{"0MB", 0, false},
+		{"lots", 0, false},
+	}
+
+	for _, testCase := range testCases {
+		size, err := ParseSize(testCase.value)
+		if (err == nil) != testCase.valid {
+			t.Fatalf("Parsing '%s' returned unexpected error: %v", testCase.value, err)
+		}
+		if size != testCase.expected {
+			t.Fatalf("Size %d parsed from '%s' is different than expected: %d", size, testCase.value, testCase.expected)
+		}
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	rate, err := ParseRate("5MB/s")
+	if err != nil || rate != 5000000 {
+		t.Fatalf("Rate %d parsed from '5MB/s' is different than expected: 5000000 (%v)", rate, err)
+	}
+	if _, err := ParseRate("5MB"); err == nil {
+		t.Fatalf("Expected error for rate without time unit")
+	}
+}
+
+func TestLimiterDelaysTransferOverRate(t *testing.T) {
+	now := time.Now()
+	limiter := NewLimiter(1000)
+
+	if delay := limiter.reserve(1000, now); delay != 0 {
+		t.Fatalf("Transfer within burst was delayed by %s", delay)
+	}
+	if delay := limiter.reserve(500, now); delay != 500*time.Millisecond {
+		t.Fatalf("Delay %s is different than expected: %s", delay, 500*time.Millisecond)
+	}
+}
+
+func TestWriterStopsWhenQuotaIsExhausted(t *testing.T) {
+	meter := NewMeter(10)
+	buffer := &bytes.Buffer{}
+	writer := NewWriter(buffer, meter, Outbound)
+
+	if _, err := writer.Write([]byte("0123456789")); err != nil {
+		t.Fatalf("Write within quota failed: %v", err)
+	}
+	select {
+	case <-meter.Exhausted():
+	default:
+		t.Fatalf("Meter should report exhausted quota")
+	}
+	if _, err := writer.Write([]byte("x")); err != ErrQuotaExhausted {
+		t.Fatalf("Write over quota returned unexpected error: %v", err)
+	}
+	if in, out := meter.Totals(); in != 0 || out != 10 {
+		t.Fatalf("Totals %d/%d are different than expected: 0/10", in, out)
+	}
+}
@@ -0,0 +1,179 @@
+// Package certstore reads certificates cached by autocert.DirCache
+package certstore
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// Certificate is a certificate chain cached for the hostname
+type Certificate struct {
+	// Name is the cache key, which is the hostname with optional key type suffix, e.g. 'site.loophole.site+rsa'
+	Name string
+	// Directory is the ACME directory host certificate was obtained from, empty for the default one
+	Directory string
+	Path      string
+	Leaf      *x509.Certificate
+	Chain     []*x509.Certificate
+}
+
+// Hostnames returns names the certificate is valid for
+func (c *Certificate) Hostnames() []string {
+	return c.Leaf.DNSNames
+}
+
+// Issuer returns name of the certificate authority which issued the certificate
+func (c *Certificate) Issuer() string {
+	if len(c.Leaf.Issuer.Organization) > 0 {
+		return fmt.Sprintf("%s (%s)", c.Leaf.Issuer.CommonName, c.Leaf.Issuer.Organization[0])
+	}
+	return c.Leaf.Issuer.CommonName
+}
+
+// Expired returns whether the certificate is not valid anymore
+func (c *Certificate) Expired(now time.Time) bool {
+	return now.After(c.Leaf.NotAfter)
+}
+
+// List returns certificates cached in the directory and its subdirectories (used for other ACME directories),
+// sorted by name, files which are not certificates (e.g. ACME account keys) are skipped
+func List(directory string) ([]*Certificate, error) {
+	certificates := []*Certificate{}
+	err := filepath.Walk(directory, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || strings.HasPrefix(info.Name(), "acme_account") {
+			return nil
+		}
+		certificate, err := load(directory, path)
+		if err != nil {
+			return nil
+		}
+		certificates = append(certificates, certificate)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(certificates, func(i, j int) bool {
+		if certificates[i].Directory != certificates[j].Directory {
+			return certificates[i].Directory < certificates[j].Directory
+		}
+		return certificates[i].Name < certificates[j].Name
+	})
+	return certificates, nil
+}
+
+// Find returns cached certificates valid for the hostname
+func Find(directory string, hostname string) ([]*Certificate, error) {
+	certificates, err := List(directory)
+	if err != nil {
+		return nil, err
+	}
+	found := []*Certificate{}
+	for _, certificate := range certificates {
+		if certificate.Leaf.VerifyHostname(hostname) == nil {
+			found = append(found, certificate)
+		}
+	}
+	return found, nil
+}
+
+// Remove deletes the certificate from the cache, so that new one is obtained on the next start
+func Remove(certificate *Certificate) error {
+	return os.Remove(certificate.Path)
+}
+
+func load(directory string, path string) (*Certificate, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	chain, err := ParseChain(content)
+	if err != nil {
+		return nil, err
+	}
+	relativeDirectory, err := filepath.Rel(directory, filepath.Dir(path))
+	if err != nil || relativeDirectory == "." {
+		relativeDirectory = ""
+	}
+	return &Certificate{
+		Name:      filepath.Base(path),
+		Directory: filepath.ToSlash(relativeDirectory),
+		Path:      path,
+		Leaf:      chain[0],
+		Chain:     chain,
+	}, nil
+}
+
+// ParseChain parses all the PEM encoded certificates, skipping other blocks like private keys
+func ParseChain(content []byte) ([]*x509.Certificate, error) {
+	chain := []*x509.Certificate{}
+	for {
+		var block *pem.Block
+		block, content = pem.Decode(content)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, certificate)
+	}
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("No certificates found")
+	}
+	return chain, nil
+}
+
+// OCSPStatus asks the OCSP responder of the certificate about its revocation status,
+// returning 'good', 'revoked' or 'unknown'
+func OCSPStatus(client *http.Client, certificate *x509.Certificate, issuer *x509.Certificate) (string, error) {
+	if len(certificate.OCSPServer) == 0 {
+		return "", fmt.Errorf("Certificate doesn't specify OCSP responder")
+	}
+	request, err := ocsp.CreateRequest(certificate, issuer, nil)
+	if err != nil {
+		return "", err
+	}
+	response, err := client.Post(certificate.OCSPServer[0], "application/ocsp-request", bytes.NewReader(request))
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("OCSP responder returned status code %d", response.StatusCode)
+	}
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return "", err
+	}
+	ocspResponse, err := ocsp.ParseResponseForCert(body, certificate, issuer)
+	if err != nil {
+		return "", err
+	}
+	switch ocspResponse.Status {
+	case ocsp.Good:
+		return "good", nil
+	case ocsp.Revoked:
+		return "revoked", nil
+	default:
+		return "unknown", nil
+	}
+}
@@ -0,0 +1,130 @@
+// Package childprocess runs command alongside the tunnel, passing signals to it
+package childprocess
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// ForwardedSignals are passed to the child instead of stopping loophole
+var ForwardedSignals = []os.Signal{os.Interrupt, syscall.SIGTERM, syscall.SIGHUP}
+
+// Process is a running command sharing standard input and output with loophole
+type Process struct {
+	cmd  *exec.Cmd
+	done chan struct{}
+	err  error
+	// sharesTerminal is set when the process got loophole's terminal, which delivers Ctrl+C to both of them
+	sharesTerminal bool
+}
+
+// Start runs the command with the environment of loophole extended with env
+func Start(command []string, env []string) (*Process, error) {
+	if len(command) == 0 {
+		return nil, errors.New("Missing command to run")
+	}
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), env...)
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	process := &Process{
+		cmd:            cmd,
+		done:           make(chan struct{}),
+		sharesTerminal: term.IsTerminal(int(os.Stdin.Fd())),
+	}
+	go func() {
+		process.err = cmd.Wait()
+		close(process.done)
+	}()
+	return process, nil
+}
+
+// Done is closed when the process exits
+func (p *Process) Done() <-chan struct{} {
+	return p.done
+}
+
+// ExitCode returns status the process exited with, for processes killed by a signal it's 128 + signal number as in shells
+func (p *Process) ExitCode() int {
+	<-p.done
+	if p.err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(p.err, &exitErr) {
+		return 1
+	}
+	if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	if code := exitErr.ExitCode(); code >= 0 {
+		return code
+	}
+	return 1
+}
+
+// Signal sends the signal to the process, killing it on systems which can't deliver the signal, e.g. interrupt on Windows
+func (p *Process) Signal(sig os.Signal) error {
+	select {
+	case <-p.done:
+		return nil
+	default:
+	}
+	if err := p.cmd.Process.Signal(sig); err != nil {
+		return p.cmd.Process.Kill()
+	}
+	return nil
+}
+
+// ForwardSignals passes ForwardedSignals received by loophole to the process until stop is called,
+// interrupt is passed only when the process doesn't share the terminal with loophole
+func (p *Process) ForwardSignals() (stop func()) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, ForwardedSignals...)
+	stopped := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case sig := <-signals:
+				p.forward(sig)
+			case <-stopped:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(signals)
+		close(stopped)
+	}
+}
+
+// forward passes the signal to the process, except for interrupt from the terminal which the process already got,
+// as e.g. npm takes the second one as a request to kill the command right away
+func (p *Process) forward(sig os.Signal) {
+	if sig == os.Interrupt && p.sharesTerminal {
+		return
+	}
+	p.Signal(sig)
+}
+
+// Stop interrupts the process and kills it when it doesn't exit within the timeout
+func (p *Process) Stop(timeout time.Duration) {
+	p.Signal(os.Interrupt)
+	select {
+	case <-p.done:
+	case <-time.After(timeout):
+		p.cmd.Process.Kill()
+		<-p.done
+	}
+}
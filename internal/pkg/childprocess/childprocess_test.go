@@ -0,0 +1,121 @@
+package childprocess
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func skipOnWindows(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test relies on POSIX shell")
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	skipOnWindows(t)
+	for _, tc := range []struct {
+		script string
+		code   int
+	}{
+		{"exit 0", 0},
+		{"exit 3", 3},
+		{"kill -TERM $$", 128 + int(syscall.SIGTERM)},
+	} {
+		process, err := Start([]string{"sh", "-c", tc.script}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code := process.ExitCode(); code != tc.code {
+			t.Errorf("%q: expected exit code %d, got %d", tc.script, tc.code, code)
+		}
+	}
+}
+
+func TestStartPassesEnvironment(t *testing.T) {
+	skipOnWindows(t)
+	output := filepath.Join(t.TempDir(), "env")
+	process, err := Start([]string{"sh", "-c", `printf '%s %s' "$PORT" "$LOOPHOLE_URL" > "$0"`, output}, []string{"PORT=3000", "LOOPHOLE_URL=https://example.loophole.site"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := process.ExitCode(); code != 0 {
+		t.Fatalf("expected exit code 0, got %d", code)
+	}
+	content, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "3000 https://example.loophole.site" {
+		t.Errorf("unexpected environment: %q", content)
+	}
+}
+
+func TestStopKillsProcessIgnoringInterrupt(t *testing.T) {
+	skipOnWindows(t)
+	process, err := Start([]string{"sh", "-c", "trap '' INT; exec sleep 10"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	process.Stop(200 * time.Millisecond)
+	select {
+	case <-process.Done():
+	default:
+		t.Fatal("process still running after stop")
+	}
+	if code := process.ExitCode(); code != 128+int(syscall.SIGKILL) {
+		t.Errorf("expected process to be killed, got exit code %d", code)
+	}
+}
+
+func TestInterruptFromTerminalIsNotForwardedTwice(t *testing.T) {
+	skipOnWindows(t)
+	process, err := Start([]string{"sh", "-c", "trap 'exit 7' INT TERM; while true; do sleep 0.01; done"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer process.Stop(time.Second)
+	time.Sleep(100 * time.Millisecond)
+
+	process.sharesTerminal = true
+	process.forward(os.Interrupt)
+	select {
+	case <-process.Done():
+		t.Fatal("interrupt the process already got from the terminal was forwarded")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	process.forward(syscall.SIGTERM)
+	if code := process.ExitCode(); code != 7 {
+		t.Errorf("expected terminate to be forwarded, got exit code %d", code)
+	}
+}
+
+func TestInterruptIsForwardedWithoutTerminal(t *testing.T) {
+	skipOnWindows(t)
+	process, err := Start([]string{"sh", "-c", "trap 'exit 7' INT; while true; do sleep 0.01; done"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer process.Stop(time.Second)
+	time.Sleep(100 * time.Millisecond)
+
+	process.sharesTerminal = false
+	process.forward(os.Interrupt)
+	if code := process.ExitCode(); code != 7 {
+		t.Errorf("expected interrupt to be forwarded, got exit code %d", code)
+	}
+}
+
+func TestStartFailsForMissingCommand(t *testing.T) {
+	if _, err := Start([]string{"loophole-missing-command"}, nil); err == nil {
+		t.Error("expected error for missing command")
+	}
+	if _, err := Start(nil, nil); err == nil {
+		t.Error("expected error for empty command")
+	}
+}
@@ -6,33 +6,43 @@ import (
 	"syscall"
 
 	"github.com/loophole/cli/internal/pkg/communication"
-	"github.com/loophole/cli/internal/pkg/inpututil"
 	"golang.org/x/term"
 )
 
 var successfulConnectionOccured bool = false
 var terminalState *term.State = &term.State{}
 
-// SetupCloseHandler ensures that CTRL+C inputs are properly processed, restoring the terminal state from not displaying entered characters where necessary
-func SetupCloseHandler(feedbackFormURL string) {
-	var terminalState *term.State
-	c := make(chan os.Signal)
+// exit is replaced in tests, so that the handler can be observed without stopping the test binary
+var exit = os.Exit
+
+// SetupCloseHandler ensures that CTRL+C inputs are properly processed, restoring the terminal state from not displaying entered characters where necessary,
+// and letting the communication mechanisms, e.g. hooks, know about the application being stopped before it exits
+func SetupCloseHandler() {
+	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 
-	if !inpututil.IsUsingPipe() { //don't try to get terminal state if using a pipe
-		var err error
-		terminalState, err = term.GetState(int(os.Stdin.Fd()))
-		if err != nil {
-			communication.Warn("Error saving terminal state")
-			communication.Fatal(err.Error())
-		}
-	}
+	restoreTerminal := SaveTerminalState()
 	go func() {
 		<-c
-		if terminalState != nil {
-			term.Restore(int(os.Stdin.Fd()), terminalState)
-		}
+		restoreTerminal()
 		communication.ApplicationStop()
-		os.Exit(0)
+		communication.Flush()
+		exit(0)
 	}()
 }
+
+// SaveTerminalState remembers the terminal state, so that the returned function can restore it before exiting,
+// e.g. after a command run alongside the tunnel left it not displaying entered characters
+func SaveTerminalState() (restore func()) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) { //don't try to get terminal state if using a pipe or a file
+		return func() {}
+	}
+	terminalState, err := term.GetState(int(os.Stdin.Fd()))
+	if err != nil {
+		communication.Warn("Error saving terminal state")
+		communication.Fatal(err.Error())
+	}
+	return func() {
+		term.Restore(int(os.Stdin.Fd()), terminalState)
+	}
+}
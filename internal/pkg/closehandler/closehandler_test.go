@@ -0,0 +1,49 @@
+package closehandler
+
+import (
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/loophole/cli/internal/pkg/communication"
+)
+
+// stopRecorder is slow to handle the stop, as e.g. hooks delivering events are
+type stopRecorder struct {
+	communication.NoopMechanism
+	stopped int32
+}
+
+func (r *stopRecorder) ApplicationStop() {
+	time.Sleep(50 * time.Millisecond)
+	atomic.StoreInt32(&r.stopped, 1)
+}
+
+func TestInterruptStopsApplicationBeforeExit(t *testing.T) {
+	recorder := &stopRecorder{}
+	communication.SetSinks(communication.Sink{Mechanism: recorder, QueueSize: 8})
+	exitCodes := make(chan int, 1)
+	exit = func(code int) {
+		exitCodes <- code
+	}
+	defer func() { exit = os.Exit }()
+
+	SetupCloseHandler()
+	process, _ := os.FindProcess(os.Getpid())
+	if err := process.Signal(os.Interrupt); err != nil {
+		t.Skipf("Interrupt can't be sent on this platform: %v", err)
+	}
+
+	select {
+	case code := <-exitCodes:
+		if code != 0 {
+			t.Fatalf("Unexpected exit code %d", code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Application didn't exit on interrupt")
+	}
+	if atomic.LoadInt32(&recorder.stopped) != 1 {
+		t.Fatalf("Application exited before the stop was handled by queued mechanism")
+	}
+}
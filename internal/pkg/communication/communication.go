@@ -1,12 +1,14 @@
 package communication
 
 import (
+	"time"
+
 	coreModels "github.com/loophole/cli/internal/app/loophole/models"
 	authModels "github.com/loophole/cli/internal/pkg/token/models"
 )
 
-var defaultLogger = NewStdOutLogger()
-var communicationMechanism Mechanism = defaultLogger
+var defaultLogger = NewStdOutLogger(true)
+var communicationMechanism = newFanout(Sink{Mechanism: defaultLogger})
 
 // Mechanism is a type defining interface for loophole communication
 type Mechanism interface {
@@ -28,8 +30,13 @@ type Mechanism interface {
 
 	TunnelStartSuccess(remoteConfig coreModels.RemoteEndpointSpecs, localEndpoint string)
 	TunnelStartFailure(tunnelID string, err error)
+	TunnelRestart(tunnelID string)
 
 	TunnelStopSuccess(tunnelID string)
+	TunnelExpiration(tunnelID string, expiresAt time.Time)
+	TunnelThroughput(tunnelID string, stats coreModels.TrafficStats)
+	TunnelUpstreamStatus(tunnelID string, upstream string, healthy bool, reason string)
+	TunnelFirstVisitor(tunnelID string, remoteAddr string)
 
 	LoginStart(authModels.DeviceCodeSpec)
 	LoginSuccess(idToken string)
@@ -45,9 +52,23 @@ type Mechanism interface {
 	NewVersionAvailable(availableVersion string)
 }
 
-// SetCommunicationMechanism is communication mechanism switcher
-func SetCommunicationMechanism(mechanism Mechanism) {
-	communicationMechanism = mechanism
+// SetSinks replaces all the mechanisms communicates are broadcast to
+func SetSinks(sinks ...Sink) {
+	communicationMechanism.set(sinks...)
+}
+
+// AddSink registers another mechanism communicates are broadcast to, returning function unregistering it
+func AddSink(sink Sink) (remove func()) {
+	registered := communicationMechanism.add(sink)
+	return func() {
+		communicationMechanism.remove(registered)
+	}
+}
+
+// Flush waits for communicates queued for non-blocking sinks to be delivered, e.g. before the application exits,
+// returning false when they weren't delivered in time
+func Flush() bool {
+	return communicationMechanism.flush(flushTimeout)
 }
 
 // TunnelDebug is debug level logger in context of a tunnel
@@ -145,14 +166,36 @@ func TunnelStartFailure(tunnelID string, err error) {
 	communicationMechanism.TunnelStartFailure(tunnelID, err)
 }
 
-// TunnelRestart is the notification about tunnel being restarted
-func TunnelRestart(tunnelID string) {}
+// TunnelRestart is the notification about tunnel reconnecting after the connection to the gateway was dropped
+func TunnelRestart(tunnelID string) {
+	communicationMechanism.TunnelRestart(tunnelID)
+}
 
 // TunnelStopSuccess is the notification about tunnel being shut down
 func TunnelStopSuccess(tunnelID string) {
 	communicationMechanism.TunnelStopSuccess(tunnelID)
 }
 
+// TunnelExpiration is the notification about time when the tunnel is going to be shut down automatically
+func TunnelExpiration(tunnelID string, expiresAt time.Time) {
+	communicationMechanism.TunnelExpiration(tunnelID, expiresAt)
+}
+
+// TunnelThroughput is the periodic notification about current tunnel throughput
+func TunnelThroughput(tunnelID string, stats coreModels.TrafficStats) {
+	communicationMechanism.TunnelThroughput(tunnelID, stats)
+}
+
+// TunnelUpstreamStatus is the notification about local server going down or up
+func TunnelUpstreamStatus(tunnelID string, upstream string, healthy bool, reason string) {
+	communicationMechanism.TunnelUpstreamStatus(tunnelID, upstream, healthy, reason)
+}
+
+// TunnelFirstVisitor is the notification about the first client connecting to the tunnel
+func TunnelFirstVisitor(tunnelID string, remoteAddr string) {
+	communicationMechanism.TunnelFirstVisitor(tunnelID, remoteAddr)
+}
+
 // LoadingStart is the notification about some loading process being started
 func LoadingStart(tunnelID string, loaderMessage string) {
 	communicationMechanism.LoadingStart(tunnelID, loaderMessage)
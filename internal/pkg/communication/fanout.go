@@ -0,0 +1,339 @@
+package communication
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	coreModels "github.com/loophole/cli/internal/app/loophole/models"
+	authModels "github.com/loophole/cli/internal/pkg/token/models"
+	"github.com/rs/zerolog"
+)
+
+// flushTimeout is how long Flush waits for the queued communicates to be delivered
+const flushTimeout = 15 * time.Second
+
+// Sink is a mechanism receiving communicates broadcast by the fan-out
+type Sink struct {
+	Mechanism Mechanism
+	// Level is the minimum level of communicates delivered to the sink
+	Level zerolog.Level
+	// QueueSize makes the delivery non-blocking, debug, info and throughput communicates are dropped when the queue is full,
+	// while the other ones are queued over the size, so that lifecycle events are never lost; with zero they're delivered synchronously
+	QueueSize int
+}
+
+// registeredSink delivers queued communicates in its own goroutine, so that producers never wait for the mechanism
+type registeredSink struct {
+	Sink
+	queued bool
+	calls  []func(Mechanism)
+	// pending counts calls which are queued or being delivered, idle is closed whenever it drops to zero
+	pending int
+	idle    chan struct{}
+	dropped int
+	closed  bool
+	wake    chan struct{}
+	mutex   sync.Mutex
+}
+
+func newRegisteredSink(sink Sink) *registeredSink {
+	registered := &registeredSink{
+		Sink:   sink,
+		queued: sink.QueueSize > 0,
+		idle:   make(chan struct{}),
+		wake:   make(chan struct{}, 1),
+	}
+	close(registered.idle)
+	if registered.queued {
+		go registered.run()
+	}
+	return registered
+}
+
+// enqueue never blocks, droppable communicates are dropped when the queue is full,
+// the other ones are queued over its size
+func (s *registeredSink) enqueue(call func(Mechanism), droppable bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return
+	}
+	if droppable && len(s.calls) >= s.QueueSize {
+		s.dropped++
+		return
+	}
+	s.calls = append(s.calls, call)
+	if s.pending == 0 {
+		s.idle = make(chan struct{})
+	}
+	s.pending++
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *registeredSink) run() {
+	for {
+		s.mutex.Lock()
+		if len(s.calls) == 0 {
+			closed := s.closed
+			s.mutex.Unlock()
+			if closed {
+				return
+			}
+			<-s.wake
+			continue
+		}
+		call := s.calls[0]
+		s.calls[0] = nil
+		s.calls = s.calls[1:]
+		s.mutex.Unlock()
+
+		call(s.Mechanism)
+
+		s.mutex.Lock()
+		// dropped communicates are reported once the sink catches up
+		dropped := 0
+		if len(s.calls) == 0 {
+			dropped, s.dropped = s.dropped, 0
+		}
+		s.mutex.Unlock()
+		if dropped > 0 {
+			s.Mechanism.Warn(fmt.Sprintf("%d messages were dropped, as they couldn't be delivered fast enough", dropped))
+		}
+
+		s.mutex.Lock()
+		s.pending--
+		if s.pending == 0 {
+			close(s.idle)
+		}
+		s.mutex.Unlock()
+	}
+}
+
+// close stops accepting communicates, the already queued ones are still delivered
+func (s *registeredSink) close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.closed = true
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// wait blocks until the queued communicates are delivered, returning false when the deadline passed before
+func (s *registeredSink) wait(deadline time.Time) bool {
+	if !s.queued {
+		return true
+	}
+	s.mutex.Lock()
+	idle := s.idle
+	s.mutex.Unlock()
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	select {
+	case <-idle:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// fanout is a mechanism broadcasting each communicate to all the registered sinks
+type fanout struct {
+	sinks []*registeredSink
+	mutex sync.RWMutex
+}
+
+func newFanout(sinks ...Sink) *fanout {
+	f := &fanout{}
+	f.set(sinks...)
+	return f
+}
+
+func (f *fanout) add(sink Sink) *registeredSink {
+	registered := newRegisteredSink(sink)
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.sinks = append(f.sinks, registered)
+	return registered
+}
+
+func (f *fanout) remove(sink *registeredSink) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for i, registered := range f.sinks {
+		if registered == sink {
+			f.sinks = append(f.sinks[:i:i], f.sinks[i+1:]...)
+			sink.close()
+			return
+		}
+	}
+}
+
+func (f *fanout) set(sinks ...Sink) {
+	f.mutex.Lock()
+	previous := f.sinks
+	f.sinks = nil
+	f.mutex.Unlock()
+	for _, sink := range previous {
+		sink.close()
+	}
+	for _, sink := range sinks {
+		f.add(sink)
+	}
+}
+
+func (f *fanout) snapshot() []*registeredSink {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	return append([]*registeredSink{}, f.sinks...)
+}
+
+// flush waits for communicates queued for all the sinks, returning false when they weren't delivered in time
+func (f *fanout) flush(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	flushed := true
+	for _, sink := range f.snapshot() {
+		flushed = sink.wait(deadline) && flushed
+	}
+	return flushed
+}
+
+func (f *fanout) broadcast(level zerolog.Level, call func(Mechanism)) {
+	f.deliver(level, false, call)
+}
+
+// broadcastDroppable delivers communicates which are only informative, so they can be dropped by sinks which can't keep up
+func (f *fanout) broadcastDroppable(level zerolog.Level, call func(Mechanism)) {
+	f.deliver(level, true, call)
+}
+
+// deliver calls the sinks outside of the lock, so that slow synchronous sink doesn't hold off (un)registering others
+func (f *fanout) deliver(level zerolog.Level, droppable bool, call func(Mechanism)) {
+	for _, sink := range f.snapshot() {
+		if level < sink.Level {
+			continue
+		}
+		if !sink.queued {
+			call(sink.Mechanism)
+			continue
+		}
+		sink.enqueue(call, droppable)
+	}
+}
+
+// broadcastFinal delivers communicates after which sinks may stop the application, e.g. stdout in CLI mode,
+// so all the queued communicates are flushed first and then the sinks are called synchronously,
+// in reverse order of registration, leaving the primary sink for the end
+func (f *fanout) broadcastFinal(level zerolog.Level, call func(Mechanism)) {
+	f.flush(flushTimeout)
+	sinks := f.snapshot()
+	for i := len(sinks) - 1; i >= 0; i-- {
+		if level >= sinks[i].Level {
+			call(sinks[i].Mechanism)
+		}
+	}
+}
+
+func (f *fanout) Debug(message string) {
+	f.broadcastDroppable(zerolog.DebugLevel, func(m Mechanism) { m.Debug(message) })
+}
+func (f *fanout) Info(message string) {
+	f.broadcastDroppable(zerolog.InfoLevel, func(m Mechanism) { m.Info(message) })
+}
+func (f *fanout) Warn(message string) {
+	f.broadcast(zerolog.WarnLevel, func(m Mechanism) { m.Warn(message) })
+}
+func (f *fanout) Error(message string) {
+	f.broadcast(zerolog.ErrorLevel, func(m Mechanism) { m.Error(message) })
+}
+func (f *fanout) Fatal(message string) {
+	f.broadcastFinal(zerolog.FatalLevel, func(m Mechanism) { m.Fatal(message) })
+}
+
+func (f *fanout) TunnelDebug(tunnelID string, message string) {
+	f.broadcastDroppable(zerolog.DebugLevel, func(m Mechanism) { m.TunnelDebug(tunnelID, message) })
+}
+func (f *fanout) TunnelInfo(tunnelID string, message string) {
+	f.broadcastDroppable(zerolog.InfoLevel, func(m Mechanism) { m.TunnelInfo(tunnelID, message) })
+}
+func (f *fanout) TunnelWarn(tunnelID string, message string) {
+	f.broadcast(zerolog.WarnLevel, func(m Mechanism) { m.TunnelWarn(tunnelID, message) })
+}
+func (f *fanout) TunnelError(tunnelID string, message string) {
+	f.broadcast(zerolog.ErrorLevel, func(m Mechanism) { m.TunnelError(tunnelID, message) })
+}
+
+func (f *fanout) ApplicationStart(loggedIn bool, idToken string) {
+	f.broadcast(zerolog.InfoLevel, func(m Mechanism) { m.ApplicationStart(loggedIn, idToken) })
+}
+func (f *fanout) ApplicationStop() {
+	f.broadcast(zerolog.InfoLevel, func(m Mechanism) { m.ApplicationStop() })
+}
+
+func (f *fanout) TunnelStart(tunnelID string) {
+	f.broadcast(zerolog.InfoLevel, func(m Mechanism) { m.TunnelStart(tunnelID) })
+}
+func (f *fanout) TunnelStartSuccess(remoteConfig coreModels.RemoteEndpointSpecs, localEndpoint string) {
+	f.broadcast(zerolog.InfoLevel, func(m Mechanism) { m.TunnelStartSuccess(remoteConfig, localEndpoint) })
+}
+func (f *fanout) TunnelStartFailure(tunnelID string, err error) {
+	f.broadcastFinal(zerolog.ErrorLevel, func(m Mechanism) { m.TunnelStartFailure(tunnelID, err) })
+}
+func (f *fanout) TunnelRestart(tunnelID string) {
+	f.broadcast(zerolog.WarnLevel, func(m Mechanism) { m.TunnelRestart(tunnelID) })
+}
+func (f *fanout) TunnelStopSuccess(tunnelID string) {
+	f.broadcast(zerolog.InfoLevel, func(m Mechanism) { m.TunnelStopSuccess(tunnelID) })
+}
+func (f *fanout) TunnelExpiration(tunnelID string, expiresAt time.Time) {
+	f.broadcast(zerolog.InfoLevel, func(m Mechanism) { m.TunnelExpiration(tunnelID, expiresAt) })
+}
+func (f *fanout) TunnelThroughput(tunnelID string, stats coreModels.TrafficStats) {
+	f.broadcastDroppable(zerolog.InfoLevel, func(m Mechanism) { m.TunnelThroughput(tunnelID, stats) })
+}
+func (f *fanout) TunnelUpstreamStatus(tunnelID string, upstream string, healthy bool, reason string) {
+	level := zerolog.InfoLevel
+	if !healthy {
+		level = zerolog.WarnLevel
+	}
+	f.broadcast(level, func(m Mechanism) { m.TunnelUpstreamStatus(tunnelID, upstream, healthy, reason) })
+}
+func (f *fanout) TunnelFirstVisitor(tunnelID string, remoteAddr string) {
+	f.broadcast(zerolog.InfoLevel, func(m Mechanism) { m.TunnelFirstVisitor(tunnelID, remoteAddr) })
+}
+
+func (f *fanout) LoginStart(deviceCodeSpec authModels.DeviceCodeSpec) {
+	f.broadcast(zerolog.InfoLevel, func(m Mechanism) { m.LoginStart(deviceCodeSpec) })
+}
+func (f *fanout) LoginSuccess(idToken string) {
+	f.broadcast(zerolog.InfoLevel, func(m Mechanism) { m.LoginSuccess(idToken) })
+}
+func (f *fanout) LoginFailure(err error) {
+	f.broadcastFinal(zerolog.ErrorLevel, func(m Mechanism) { m.LoginFailure(err) })
+}
+
+func (f *fanout) LogoutSuccess() {
+	f.broadcast(zerolog.InfoLevel, func(m Mechanism) { m.LogoutSuccess() })
+}
+func (f *fanout) LogoutFailure(err error) {
+	f.broadcastFinal(zerolog.ErrorLevel, func(m Mechanism) { m.LogoutFailure(err) })
+}
+
+func (f *fanout) LoadingStart(tunnelID string, loaderMessage string) {
+	f.broadcast(zerolog.InfoLevel, func(m Mechanism) { m.LoadingStart(tunnelID, loaderMessage) })
+}
+func (f *fanout) LoadingSuccess(tunnelID string) {
+	f.broadcast(zerolog.InfoLevel, func(m Mechanism) { m.LoadingSuccess(tunnelID) })
+}
+func (f *fanout) LoadingFailure(tunnelID string, err error) {
+	f.broadcast(zerolog.ErrorLevel, func(m Mechanism) { m.LoadingFailure(tunnelID, err) })
+}
+
+func (f *fanout) NewVersionAvailable(availableVersion string) {
+	f.broadcast(zerolog.InfoLevel, func(m Mechanism) { m.NewVersionAvailable(availableVersion) })
+}
@@ -0,0 +1,189 @@
+package communication
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// recordingMechanism records log messages, optionally blocking until released
+type recordingMechanism struct {
+	NoopMechanism
+	messages []string
+	release  chan struct{}
+	mutex    sync.Mutex
+}
+
+func (m *recordingMechanism) record(message string) {
+	if m.release != nil {
+		<-m.release
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.messages = append(m.messages, message)
+}
+
+func (m *recordingMechanism) recorded() string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return strings.Join(m.messages, ",")
+}
+
+func (m *recordingMechanism) Debug(message string) { m.record("debug:" + message) }
+func (m *recordingMechanism) Info(message string)  { m.record("info:" + message) }
+func (m *recordingMechanism) Warn(message string)  { m.record("warn:" + message) }
+func (m *recordingMechanism) Fatal(message string) { m.record("fatal:" + message) }
+func (m *recordingMechanism) TunnelStopSuccess(tunnelID string) {
+	m.record("stopped:" + tunnelID)
+}
+func (m *recordingMechanism) ApplicationStop() { m.record("stop") }
+
+func TestFanoutFiltersLevels(t *testing.T) {
+	all := &recordingMechanism{}
+	warnings := &recordingMechanism{}
+	f := newFanout(Sink{Mechanism: all}, Sink{Mechanism: warnings, Level: zerolog.WarnLevel})
+
+	f.Debug("a")
+	f.Info("b")
+	f.Warn("c")
+
+	if all.recorded() != "debug:a,info:b,warn:c" || warnings.recorded() != "warn:c" {
+		t.Fatalf("Unexpected delivery: %s and %s", all.recorded(), warnings.recorded())
+	}
+}
+
+func TestFanoutDoesNotWaitForSlowSink(t *testing.T) {
+	fast := &recordingMechanism{}
+	slow := &recordingMechanism{release: make(chan struct{})}
+	f := newFanout(Sink{Mechanism: fast}, Sink{Mechanism: slow, QueueSize: 1})
+
+	done := make(chan struct{})
+	go func() {
+		// first is being delivered, second is queued, the rest is dropped
+		for _, message := range []string{"1", "2", "3", "4"} {
+			f.Info(message)
+			time.Sleep(10 * time.Millisecond)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Slow sink blocked the broadcast")
+	}
+	if fast.recorded() != "info:1,info:2,info:3,info:4" {
+		t.Fatalf("Unexpected delivery to fast sink: %s", fast.recorded())
+	}
+
+	close(slow.release)
+	if !f.flush(time.Second) {
+		t.Fatalf("Queue wasn't flushed")
+	}
+	if recorded := slow.recorded(); !strings.HasPrefix(recorded, "info:1,info:2,warn:2 messages were dropped") {
+		t.Fatalf("Unexpected delivery to slow sink: %s", recorded)
+	}
+}
+
+func TestFanoutQueuesLifecycleCommunicatesOverQueueSize(t *testing.T) {
+	slow := &recordingMechanism{release: make(chan struct{})}
+	f := newFanout(Sink{Mechanism: slow, QueueSize: 1})
+
+	done := make(chan struct{})
+	go func() {
+		// first is being delivered, second fills the queue and third is dropped
+		f.Info("1")
+		time.Sleep(10 * time.Millisecond)
+		f.Info("2")
+		f.Info("3")
+		f.TunnelStopSuccess("tunnel")
+		f.ApplicationStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Slow sink blocked the lifecycle communicates")
+	}
+	if f.flush(10 * time.Millisecond) {
+		t.Fatalf("Flush didn't wait for the slow sink")
+	}
+
+	close(slow.release)
+	if !f.flush(time.Second) {
+		t.Fatalf("Queue wasn't flushed")
+	}
+	if recorded := slow.recorded(); recorded != "info:1,info:2,stopped:tunnel,stop,warn:1 messages were dropped, as they couldn't be delivered fast enough" {
+		t.Fatalf("Unexpected delivery to slow sink: %s", recorded)
+	}
+}
+
+func TestRemovingBlockedSinkDoesNotWaitForIt(t *testing.T) {
+	slow := &recordingMechanism{release: make(chan struct{})}
+	defer close(slow.release)
+	f := newFanout()
+	registered := f.add(Sink{Mechanism: slow, QueueSize: 1})
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 10; i++ {
+			f.Warn("upstream down")
+		}
+		f.remove(registered)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Sink which doesn't drain blocked the broadcast or its removal")
+	}
+}
+
+func TestFanoutDeliversFinalCommunicatesAfterQueued(t *testing.T) {
+	var order []string
+	var mutex sync.Mutex
+	primary := &orderMechanism{name: "primary", order: &order, mutex: &mutex}
+	queued := &orderMechanism{name: "queued", order: &order, mutex: &mutex}
+	f := newFanout(Sink{Mechanism: primary}, Sink{Mechanism: queued, QueueSize: 10})
+
+	f.Info("before")
+	f.Fatal("stop")
+
+	expected := "primary:info,queued:info,queued:fatal,primary:fatal"
+	if strings.Join(order, ",") != expected {
+		t.Fatalf("Delivery order %v is different than expected: %s", order, expected)
+	}
+}
+
+type orderMechanism struct {
+	NoopMechanism
+	name  string
+	order *[]string
+	mutex *sync.Mutex
+}
+
+func (m *orderMechanism) add(kind string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	*m.order = append(*m.order, m.name+":"+kind)
+}
+
+func (m *orderMechanism) Info(message string)  { m.add("info") }
+func (m *orderMechanism) Fatal(message string) { m.add("fatal") }
+
+func TestRemovedSinkStopsReceiving(t *testing.T) {
+	sink := &recordingMechanism{}
+	f := newFanout()
+	registered := f.add(Sink{Mechanism: sink, QueueSize: 10})
+
+	f.Info("a")
+	f.flush(time.Second)
+	f.remove(registered)
+	f.Info("b")
+
+	if sink.recorded() != "info:a" {
+		t.Fatalf("Unexpected delivery: %s", sink.recorded())
+	}
+}
@@ -3,6 +3,7 @@ package communication
 import (
 	"fmt"
 	"io"
+	"os"
 	"sync"
 	"time"
 
@@ -10,23 +11,31 @@ import (
 	"github.com/logrusorgru/aurora"
 	"github.com/loophole/cli/config"
 	coreModels "github.com/loophole/cli/internal/app/loophole/models"
+	"github.com/loophole/cli/internal/pkg/bandwidth"
 	authModels "github.com/loophole/cli/internal/pkg/token/models"
 	"github.com/loophole/cli/internal/pkg/urlmaker"
 	"github.com/mattn/go-colorable"
 	"github.com/mdp/qrterminal"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"golang.org/x/term"
 )
 
 type stdoutLogger struct {
-	colorableOutput io.Writer
-	loader          *spinner.Spinner
-	messageMutex    sync.Mutex
+	colorableOutput   io.Writer
+	loader            *spinner.Spinner
+	messageMutex      sync.Mutex
+	isTerminal        bool
+	statusLineVisible bool
+	exitOnFailure     bool
 }
 
-// NewStdOutLogger is stdout mechanism constructor
-func NewStdOutLogger() Mechanism {
+// NewStdOutLogger is stdout mechanism constructor, with exitOnFailure tunnel, login and logout failures stop the application
+func NewStdOutLogger(exitOnFailure bool) Mechanism {
 	logger := stdoutLogger{
 		colorableOutput: colorable.NewColorableStdout(),
+		isTerminal:      term.IsTerminal(int(os.Stdout.Fd())),
+		exitOnFailure:   exitOnFailure,
 	}
 
 	logger.loader = spinner.New(spinner.CharSets[9], 100*time.Millisecond, spinner.WithWriter(logger.colorableOutput))
@@ -34,32 +43,49 @@ func NewStdOutLogger() Mechanism {
 	return &logger
 }
 
-func (l *stdoutLogger) TunnelDebug(tunnelID string, message string) {
+// failure returns event for failure communicates, stopping the application when it's sent if configured so
+func (l *stdoutLogger) failure() *zerolog.Event {
+	if l.exitOnFailure {
+		return log.Fatal()
+	}
+	return log.Error()
+}
+
+// lock acquires the message mutex and clears the status line, so that messages are not printed over it
+func (l *stdoutLogger) lock() {
 	l.messageMutex.Lock()
+	if l.statusLineVisible {
+		fmt.Fprint(l.colorableOutput, "\r\033[K")
+		l.statusLineVisible = false
+	}
+}
+
+func (l *stdoutLogger) TunnelDebug(tunnelID string, message string) {
+	l.lock()
 	defer l.messageMutex.Unlock()
 	if el := log.Debug(); el.Enabled() {
 		fmt.Println()
-		el.Msg(message)
+		el.Str("tunnelId", tunnelID).Msg(message)
 	}
 }
 func (l *stdoutLogger) TunnelInfo(tunnelID string, message string) {
-	l.messageMutex.Lock()
+	l.lock()
 	defer l.messageMutex.Unlock()
-	log.Info().Msg(message)
+	log.Info().Str("tunnelId", tunnelID).Msg(message)
 }
 func (l *stdoutLogger) TunnelWarn(tunnelID string, message string) {
-	l.messageMutex.Lock()
+	l.lock()
 	defer l.messageMutex.Unlock()
-	log.Warn().Msg(message)
+	log.Warn().Str("tunnelId", tunnelID).Msg(message)
 }
 func (l *stdoutLogger) TunnelError(tunnelID string, message string) {
-	l.messageMutex.Lock()
+	l.lock()
 	defer l.messageMutex.Unlock()
-	log.Error().Msg(message)
+	log.Error().Str("tunnelId", tunnelID).Msg(message)
 }
 
 func (l *stdoutLogger) Debug(message string) {
-	l.messageMutex.Lock()
+	l.lock()
 	defer l.messageMutex.Unlock()
 	if el := log.Debug(); el.Enabled() {
 		fmt.Println()
@@ -67,28 +93,28 @@ func (l *stdoutLogger) Debug(message string) {
 	}
 }
 func (l *stdoutLogger) Info(message string) {
-	l.messageMutex.Lock()
+	l.lock()
 	defer l.messageMutex.Unlock()
 	log.Info().Msg(message)
 }
 func (l *stdoutLogger) Warn(message string) {
-	l.messageMutex.Lock()
+	l.lock()
 	defer l.messageMutex.Unlock()
 	log.Warn().Msg(message)
 }
 func (l *stdoutLogger) Error(message string) {
-	l.messageMutex.Lock()
+	l.lock()
 	defer l.messageMutex.Unlock()
 	log.Error().Msg(message)
 }
 func (l *stdoutLogger) Fatal(message string) {
-	l.messageMutex.Lock()
+	l.lock()
 	defer l.messageMutex.Unlock()
 	log.Fatal().Msg(message)
 }
 
 func (l *stdoutLogger) ApplicationStart(loggedIn bool, idToken string) {
-	l.messageMutex.Lock()
+	l.lock()
 	defer l.messageMutex.Unlock()
 	fmt.Fprint(l.colorableOutput, aurora.Cyan("Loophole"))
 	fmt.Fprint(l.colorableOutput, aurora.Italic(" - End to end TLS encrypted TCP communication between you and your clients"))
@@ -96,7 +122,7 @@ func (l *stdoutLogger) ApplicationStart(loggedIn bool, idToken string) {
 	fmt.Fprintln(l.colorableOutput)
 }
 func (l *stdoutLogger) ApplicationStop() {
-	l.messageMutex.Lock()
+	l.lock()
 	defer l.messageMutex.Unlock()
 	l.divider()
 	fmt.Fprint(l.colorableOutput, "Goodbye")
@@ -105,13 +131,13 @@ func (l *stdoutLogger) ApplicationStop() {
 }
 
 func (l *stdoutLogger) TunnelStart(tunnelID string) {
-	l.messageMutex.Lock()
+	l.lock()
 	defer l.messageMutex.Unlock()
-	log.Debug().Msg("Tunnel starting up...")
+	log.Debug().Str("tunnelId", tunnelID).Msg("Tunnel starting up...")
 }
 
 func (l *stdoutLogger) TunnelStartSuccess(remoteConfig coreModels.RemoteEndpointSpecs, localEndpoint string) {
-	l.messageMutex.Lock()
+	l.lock()
 	defer l.messageMutex.Unlock()
 
 	fmt.Fprintln(l.colorableOutput)
@@ -136,47 +162,94 @@ func (l *stdoutLogger) TunnelStartSuccess(remoteConfig coreModels.RemoteEndpoint
 	fmt.Fprintln(l.colorableOutput)
 	fmt.Fprintln(l.colorableOutput, "Logs: ")
 
-	log.Info().Msg("Awaiting connections...")
+	log.Info().Str("tunnelId", remoteConfig.TunnelID).Msg("Awaiting connections...")
 }
 func (l *stdoutLogger) TunnelStartFailure(tunnelID string, err error) {
-	l.messageMutex.Lock()
+	l.lock()
+	defer l.messageMutex.Unlock()
+	l.failure().Str("tunnelId", tunnelID).Err(err).Msg("Tunnel startup error")
+}
+func (l *stdoutLogger) TunnelRestart(tunnelID string) {
+	l.lock()
 	defer l.messageMutex.Unlock()
-	log.Fatal().Str("tunnelId", tunnelID).Err(err).Msg("Tunnel startup error")
+	log.Info().Str("tunnelId", tunnelID).Msg("Connection to the gateway dropped, reconnecting...")
 }
 func (l *stdoutLogger) TunnelStopSuccess(tunnelID string) {
-	l.messageMutex.Lock()
+	l.lock()
 	defer l.messageMutex.Unlock()
 	log.Debug().Str("tunnelId", tunnelID).Msg("Tunnel shutdown")
 }
 
+func (l *stdoutLogger) TunnelExpiration(tunnelID string, expiresAt time.Time) {
+	l.lock()
+	defer l.messageMutex.Unlock()
+	log.Info().Str("tunnelId", tunnelID).Time("expiresAt", expiresAt).
+		Msgf("Tunnel will shut down in %s", time.Until(expiresAt).Round(time.Second))
+}
+
+func (l *stdoutLogger) TunnelUpstreamStatus(tunnelID string, upstream string, healthy bool, reason string) {
+	l.lock()
+	defer l.messageMutex.Unlock()
+	if healthy {
+		log.Info().Str("tunnelId", tunnelID).Msgf("Upstream %s is up", upstream)
+		return
+	}
+	log.Warn().Str("tunnelId", tunnelID).Msgf("Upstream %s is down: %s", upstream, reason)
+}
+
+func (l *stdoutLogger) TunnelFirstVisitor(tunnelID string, remoteAddr string) {
+	l.lock()
+	defer l.messageMutex.Unlock()
+	log.Info().Str("tunnelId", tunnelID).Msgf("First visitor connected from %s", remoteAddr)
+}
+
+func (l *stdoutLogger) TunnelThroughput(tunnelID string, stats coreModels.TrafficStats) {
+	l.lock()
+	defer l.messageMutex.Unlock()
+	status := fmt.Sprintf("Throughput: in %s/s, out %s/s, transferred %s",
+		bandwidth.FormatSize(stats.InPerSecond), bandwidth.FormatSize(stats.OutPerSecond), bandwidth.FormatSize(stats.Transferred))
+	if stats.Quota > 0 {
+		status += fmt.Sprintf(" of %s quota", bandwidth.FormatSize(stats.Quota))
+	}
+	if stats.RateLimitedRequests > 0 || stats.RejectedConnections > 0 {
+		status += fmt.Sprintf(", rejected %d requests and %d connections over limits", stats.RateLimitedRequests, stats.RejectedConnections)
+	}
+	if !l.isTerminal {
+		log.Debug().Str("tunnelId", tunnelID).Msg(status)
+		return
+	}
+	fmt.Fprint(l.colorableOutput, aurora.Faint(status))
+	l.statusLineVisible = true
+}
+
 func (l *stdoutLogger) LoginStart(deviceCodeSpec authModels.DeviceCodeSpec) {
-	l.messageMutex.Lock()
+	l.lock()
 	defer l.messageMutex.Unlock()
 	fmt.Fprintf(l.colorableOutput, "Please open %s and use %s code to log in", aurora.Yellow(deviceCodeSpec.VerificationURI), aurora.Yellow(deviceCodeSpec.UserCode))
 }
 func (l *stdoutLogger) LoginSuccess(idToken string) {
-	l.messageMutex.Lock()
+	l.lock()
 	defer l.messageMutex.Unlock()
 	log.Info().Msg("Logged in successfully")
 }
 func (l *stdoutLogger) LoginFailure(err error) {
-	l.messageMutex.Lock()
+	l.lock()
 	defer l.messageMutex.Unlock()
-	log.Fatal().Msg(err.Error())
+	l.failure().Msg(err.Error())
 }
 func (l *stdoutLogger) LogoutSuccess() {
-	l.messageMutex.Lock()
+	l.lock()
 	defer l.messageMutex.Unlock()
 	log.Info().Msg("Logged out successfully")
 }
 func (l *stdoutLogger) LogoutFailure(err error) {
-	l.messageMutex.Lock()
+	l.lock()
 	defer l.messageMutex.Unlock()
-	log.Fatal().Msg(err.Error())
+	l.failure().Msg(err.Error())
 }
 
 func (l *stdoutLogger) LoadingStart(tunnelID string, loaderMessage string) {
-	l.messageMutex.Lock()
+	l.lock()
 	defer l.messageMutex.Unlock()
 	if el := log.Debug(); !el.Enabled() {
 		l.loader.Prefix = fmt.Sprintf("%s ", loaderMessage)
@@ -187,7 +260,7 @@ func (l *stdoutLogger) LoadingStart(tunnelID string, loaderMessage string) {
 }
 
 func (l *stdoutLogger) LoadingSuccess(tunnelID string) {
-	l.messageMutex.Lock()
+	l.lock()
 	defer l.messageMutex.Unlock()
 	if el := log.Debug(); !el.Enabled() {
 		l.loader.FinalMSG = fmt.Sprintf("%s%s\n", l.loader.Prefix, aurora.Green("Success!"))
@@ -196,7 +269,7 @@ func (l *stdoutLogger) LoadingSuccess(tunnelID string) {
 }
 
 func (l *stdoutLogger) LoadingFailure(tunnelID string, err error) {
-	l.messageMutex.Lock()
+	l.lock()
 	defer l.messageMutex.Unlock()
 	if el := log.Debug(); !el.Enabled() {
 		l.loader.FinalMSG = fmt.Sprintf("%s%s %s\n", l.loader.Prefix, aurora.Red("Error!"), err.Error())
@@ -205,7 +278,7 @@ func (l *stdoutLogger) LoadingFailure(tunnelID string, err error) {
 }
 
 func (l *stdoutLogger) NewVersionAvailable(availableVersion string) {
-	l.messageMutex.Lock()
+	l.lock()
 	defer l.messageMutex.Unlock()
 	fmt.Fprint(l.colorableOutput, aurora.Cyan(fmt.Sprintf("There is new version available, to get it please visit %s",
 		fmt.Sprintf("https://github.com/loophole/cli/releases/tag/%s", availableVersion))))
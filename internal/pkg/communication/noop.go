@@ -0,0 +1,50 @@
+package communication
+
+import (
+	"time"
+
+	coreModels "github.com/loophole/cli/internal/app/loophole/models"
+	authModels "github.com/loophole/cli/internal/pkg/token/models"
+)
+
+// NoopMechanism ignores all the communicates, sinks interested only in some of them can embed it
+type NoopMechanism struct{}
+
+func (NoopMechanism) Debug(message string) {}
+func (NoopMechanism) Info(message string)  {}
+func (NoopMechanism) Warn(message string)  {}
+func (NoopMechanism) Error(message string) {}
+func (NoopMechanism) Fatal(message string) {}
+
+func (NoopMechanism) TunnelDebug(tunnelID string, message string) {}
+func (NoopMechanism) TunnelInfo(tunnelID string, message string)  {}
+func (NoopMechanism) TunnelWarn(tunnelID string, message string)  {}
+func (NoopMechanism) TunnelError(tunnelID string, message string) {}
+
+func (NoopMechanism) ApplicationStart(loggedIn bool, idToken string) {}
+func (NoopMechanism) ApplicationStop()                               {}
+
+func (NoopMechanism) TunnelStart(tunnelID string) {}
+func (NoopMechanism) TunnelStartSuccess(remoteConfig coreModels.RemoteEndpointSpecs, localEndpoint string) {
+}
+func (NoopMechanism) TunnelStartFailure(tunnelID string, err error)                   {}
+func (NoopMechanism) TunnelRestart(tunnelID string)                                   {}
+func (NoopMechanism) TunnelStopSuccess(tunnelID string)                               {}
+func (NoopMechanism) TunnelExpiration(tunnelID string, expiresAt time.Time)           {}
+func (NoopMechanism) TunnelThroughput(tunnelID string, stats coreModels.TrafficStats) {}
+func (NoopMechanism) TunnelUpstreamStatus(tunnelID string, upstream string, healthy bool, reason string) {
+}
+func (NoopMechanism) TunnelFirstVisitor(tunnelID string, remoteAddr string) {}
+
+func (NoopMechanism) LoginStart(authModels.DeviceCodeSpec) {}
+func (NoopMechanism) LoginSuccess(idToken string)          {}
+func (NoopMechanism) LoginFailure(err error)               {}
+
+func (NoopMechanism) LogoutSuccess()          {}
+func (NoopMechanism) LogoutFailure(err error) {}
+
+func (NoopMechanism) LoadingStart(tunnelID string, loaderMessage string) {}
+func (NoopMechanism) LoadingSuccess(tunnelID string)                     {}
+func (NoopMechanism) LoadingFailure(tunnelID string, err error)          {}
+
+func (NoopMechanism) NewVersionAvailable(availableVersion string) {}
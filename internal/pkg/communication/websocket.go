@@ -4,6 +4,7 @@ package communication
 
 import (
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/loophole/cli/config"
@@ -38,8 +39,13 @@ const (
 	MessageTypeTunnelStart        MessageType = "MT_TunnelStart"
 	MessageTypeTunnelStartSuccess MessageType = "MT_TunnelStartSuccess"
 	MessageTypeTunnelStartFailure MessageType = "MT_TunnelStartFailure"
+	MessageTypeTunnelRestart      MessageType = "MT_TunnelRestart"
 
-	MessageTypeTunnelStop MessageType = "MT_TunnelStop"
+	MessageTypeTunnelStop       MessageType = "MT_TunnelStop"
+	MessageTypeTunnelExpiration MessageType = "MT_TunnelExpiration"
+	MessageTypeTunnelThroughput MessageType = "MT_TunnelThroughput"
+	MessageTypeTunnelUpstream   MessageType = "MT_TunnelUpstreamStatus"
+	MessageTypeTunnelVisitor    MessageType = "MT_TunnelFirstVisitor"
 
 	MessageTypeLoadingStart   MessageType = "MT_LoadingStart"
 	MessageTypeLoadingSuccess MessageType = "MT_LoadingSuccess"
@@ -143,6 +149,37 @@ type tunnelStopSuccessMessage struct {
 	TunnelID string      `json:"tunnelId"`
 }
 
+type tunnelExpirationMessage struct {
+	Type      MessageType `json:"type"`
+	TunnelID  string      `json:"tunnelId"`
+	ExpiresAt time.Time   `json:"expiresAt"`
+}
+
+type tunnelThroughputMessage struct {
+	Type     MessageType             `json:"type"`
+	TunnelID string                  `json:"tunnelId"`
+	Stats    coreModels.TrafficStats `json:"stats"`
+}
+
+type tunnelUpstreamStatusMessage struct {
+	Type     MessageType `json:"type"`
+	TunnelID string      `json:"tunnelId"`
+	Upstream string      `json:"upstream"`
+	Healthy  bool        `json:"healthy"`
+	Reason   string      `json:"reason"`
+}
+
+type tunnelRestartMessage struct {
+	Type     MessageType `json:"type"`
+	TunnelID string      `json:"tunnelId"`
+}
+
+type tunnelFirstVisitorMessage struct {
+	Type       MessageType `json:"type"`
+	TunnelID   string      `json:"tunnelId"`
+	RemoteAddr string      `json:"remoteAddr"`
+}
+
 type loadingStartMessage struct {
 	Type     MessageType `json:"type"`
 	TunnelID string      `json:"tunnelId"`
@@ -298,6 +335,13 @@ func (l *websocketLogger) TunnelStartFailure(tunnelID string, err error) {
 	})
 }
 
+func (l *websocketLogger) TunnelRestart(tunnelID string) {
+	l.write(tunnelRestartMessage{
+		Type:     MessageTypeTunnelRestart,
+		TunnelID: tunnelID,
+	})
+}
+
 func (l *websocketLogger) TunnelStopSuccess(tunnelID string) {
 	l.write(tunnelStopSuccessMessage{
 		Type:     MessageTypeTunnelStop,
@@ -305,6 +349,40 @@ func (l *websocketLogger) TunnelStopSuccess(tunnelID string) {
 	})
 }
 
+func (l *websocketLogger) TunnelExpiration(tunnelID string, expiresAt time.Time) {
+	l.write(tunnelExpirationMessage{
+		Type:      MessageTypeTunnelExpiration,
+		TunnelID:  tunnelID,
+		ExpiresAt: expiresAt,
+	})
+}
+
+func (l *websocketLogger) TunnelThroughput(tunnelID string, stats coreModels.TrafficStats) {
+	l.write(tunnelThroughputMessage{
+		Type:     MessageTypeTunnelThroughput,
+		TunnelID: tunnelID,
+		Stats:    stats,
+	})
+}
+
+func (l *websocketLogger) TunnelUpstreamStatus(tunnelID string, upstream string, healthy bool, reason string) {
+	l.write(tunnelUpstreamStatusMessage{
+		Type:     MessageTypeTunnelUpstream,
+		TunnelID: tunnelID,
+		Upstream: upstream,
+		Healthy:  healthy,
+		Reason:   reason,
+	})
+}
+
+func (l *websocketLogger) TunnelFirstVisitor(tunnelID string, remoteAddr string) {
+	l.write(tunnelFirstVisitorMessage{
+		Type:       MessageTypeTunnelVisitor,
+		TunnelID:   tunnelID,
+		RemoteAddr: remoteAddr,
+	})
+}
+
 func (l *websocketLogger) LoginStart(deviceCodeSpec authModels.DeviceCodeSpec) {
 	l.write(loginMessage{
 		Type:                    MessageTypeLogin,
@@ -0,0 +1,191 @@
+// Package devca implements local certificate authority issuing certificates for development builds
+package devca
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// CertificateFile is the name of PEM encoded CA certificate in the CA directory
+	CertificateFile = "ca.pem"
+	// KeyFile is the name of PEM encoded CA private key in the CA directory
+	KeyFile = "ca-key.pem"
+
+	caValidFor = 10 * 365 * 24 * time.Hour
+	// leafValidFor stays below 398 days, which is the longest validity accepted by browsers
+	leafValidFor = 365 * 24 * time.Hour
+	// clockSkew is how far back certificates are valid, so that clocks slightly behind accept them
+	clockSkew = time.Hour
+)
+
+// CA is a certificate authority persisted on disk, so that it has to be trusted only once
+type CA struct {
+	Certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+}
+
+// LoadOrCreate reads the CA from the directory, generating new one if it doesn't exist yet
+func LoadOrCreate(directory string) (*CA, error) {
+	certificatePath := filepath.Join(directory, CertificateFile)
+	keyPath := filepath.Join(directory, KeyFile)
+
+	ca, err := load(certificatePath, keyPath)
+	if err == nil {
+		return ca, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("Failed to load development CA from '%s': %v", directory, err)
+	}
+
+	ca, err = create(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(directory, 0700); err != nil {
+		return nil, err
+	}
+	keyDer, err := x509.MarshalECPrivateKey(ca.key)
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(certificatePath, ca.CertificatePEM(), 0644); err != nil {
+		return nil, err
+	}
+	return ca, nil
+}
+
+func load(certificatePath string, keyPath string) (*CA, error) {
+	certificateContent, err := ioutil.ReadFile(certificatePath)
+	if err != nil {
+		return nil, err
+	}
+	keyContent, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	certificateBlock, _ := pem.Decode(certificateContent)
+	if certificateBlock == nil {
+		return nil, fmt.Errorf("No certificate found in '%s'", certificatePath)
+	}
+	certificate, err := x509.ParseCertificate(certificateBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	keyBlock, _ := pem.Decode(keyContent)
+	if keyBlock == nil {
+		return nil, fmt.Errorf("No private key found in '%s'", keyPath)
+	}
+	key, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	return &CA{Certificate: certificate, key: key}, nil
+}
+
+func create(now time.Time) (*CA, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serialNumber, err := newSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+	hostname, _ := os.Hostname()
+	template := &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject: pkix.Name{
+			CommonName:   fmt.Sprintf("Loophole Development CA (%s)", hostname),
+			Organization: []string{"Loophole development"},
+		},
+		NotBefore:             now.Add(-clockSkew),
+		NotAfter:              now.Add(caValidFor),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &CA{Certificate: certificate, key: key}, nil
+}
+
+// CertificatePEM returns PEM encoded CA certificate, which can be imported to trust stores
+func (ca *CA) CertificatePEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Certificate.Raw})
+}
+
+// Issue creates leaf certificate for the hosts (hostnames or IP addresses) signed by the CA
+func (ca *CA) Issue(now time.Time, hosts ...string) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serialNumber, err := newSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject: pkix.Name{
+			CommonName:   hosts[0],
+			Organization: []string{"Loophole development"},
+		},
+		NotBefore:             now.Add(-clockSkew),
+		NotAfter:              now.Add(leafValidFor),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	if template.NotAfter.After(ca.Certificate.NotAfter) {
+		template.NotAfter = ca.Certificate.NotAfter
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.Certificate, &key.PublicKey, ca.key)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Certificate{
+		Certificate: [][]byte{der, ca.Certificate.Raw},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}, nil
+}
+
+func newSerialNumber() (*big.Int, error) {
+	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
+	return rand.Int(rand.Reader, serialNumberLimit)
+}
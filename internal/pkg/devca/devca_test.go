@@ -0,0 +1,51 @@
+package devca
+
+import (
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestLoadOrCreatePersistsCA(t *testing.T) {
+	directory, err := ioutil.TempDir("", "loophole-dev-ca")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+
+	created, err := LoadOrCreate(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadOrCreate(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !created.Certificate.Equal(loaded.Certificate) {
+		t.Fatalf("Loaded CA is different than the created one")
+	}
+}
+
+func TestIssuedCertificateIsTrustedByCA(t *testing.T) {
+	ca, err := create(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := ca.Issue(time.Now(), "site.loophole.site", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Certificate)
+	for _, host := range []string{"site.loophole.site", "127.0.0.1"} {
+		if _, err := certificate.Leaf.Verify(x509.VerifyOptions{DNSName: host, Roots: roots}); err != nil {
+			t.Fatalf("Certificate for '%s' is not trusted: %v", host, err)
+		}
+	}
+	if _, err := certificate.Leaf.Verify(x509.VerifyOptions{DNSName: "other.loophole.site", Roots: roots}); err == nil {
+		t.Fatalf("Certificate should not be valid for other hostname")
+	}
+}
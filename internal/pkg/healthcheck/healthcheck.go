@@ -0,0 +1,174 @@
+// Package healthcheck actively checks whether local server is available
+package healthcheck
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	lm "github.com/loophole/cli/internal/app/loophole/models"
+)
+
+const (
+	defaultInterval           = 5 * time.Second
+	defaultTimeout            = 2 * time.Second
+	defaultHealthyThreshold   = 1
+	defaultUnhealthyThreshold = 2
+
+	// waitInterval is how often the endpoint is checked while waiting for it, so that tunnel starts soon after the server
+	waitInterval = time.Second
+)
+
+// Checker periodically checks the endpoint, changing its state after consecutive successes or failures
+// reach the threshold, so that single slow response doesn't mark the server as down
+type Checker struct {
+	endpoint  lm.Endpoint
+	specs     lm.HealthCheckSpecs
+	client    *http.Client
+	dialer    *net.Dialer
+	onChange  func(healthy bool, err error)
+	healthy   bool
+	successes int
+	failures  int
+	mutex     sync.RWMutex
+}
+
+// New creates checker of the endpoint, onChange is called whenever the server goes down or up,
+// the server is considered healthy until checked; HTTP checks are sent over the transport,
+// so that they speak the same protocol as proxied requests, default HTTP/1 transport is used when nil
+func New(endpoint lm.Endpoint, specs lm.HealthCheckSpecs, transport http.RoundTripper, onChange func(healthy bool, err error)) *Checker {
+	if specs.Interval <= 0 {
+		specs.Interval = defaultInterval
+	}
+	if specs.Timeout <= 0 {
+		specs.Timeout = defaultTimeout
+	}
+	if specs.HealthyThreshold <= 0 {
+		specs.HealthyThreshold = defaultHealthyThreshold
+	}
+	if specs.UnhealthyThreshold <= 0 {
+		specs.UnhealthyThreshold = defaultUnhealthyThreshold
+	}
+	dialer := &net.Dialer{Timeout: specs.Timeout}
+	checker := &Checker{
+		endpoint: endpoint,
+		specs:    specs,
+		dialer:   dialer,
+		onChange: onChange,
+		healthy:  true,
+	}
+	if transport == nil {
+		transport = &http.Transport{
+			DialContext:     checker.dial,
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		}
+	}
+	checker.client = &http.Client{
+		Timeout:   specs.Timeout,
+		Transport: transport,
+		// redirect means the server answers, it doesn't have to be followed
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return checker
+}
+
+func (c *Checker) dial(ctx context.Context, network string, address string) (net.Conn, error) {
+	if c.endpoint.Socket != "" {
+		return c.dialer.DialContext(ctx, "unix", c.endpoint.Socket)
+	}
+	return c.dialer.DialContext(ctx, network, address)
+}
+
+// Check connects to the endpoint once, returning error when the server isn't available
+func (c *Checker) Check() error {
+	if c.specs.Path == "" {
+		conn, err := c.dial(context.Background(), "tcp", c.endpoint.Hostname())
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	url := fmt.Sprintf("%s://%s%s", c.endpoint.Protocol, c.endpoint.Hostname(), c.specs.Path)
+	response, err := c.client.Get(url)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 400 {
+		return fmt.Errorf("%s responded with status code %d", c.specs.Path, response.StatusCode)
+	}
+	return nil
+}
+
+// Healthy returns whether the server is considered available
+func (c *Checker) Healthy() bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.healthy
+}
+
+// record updates the state with the check result, returning whether the state has changed
+func (c *Checker) record(err error) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err == nil {
+		c.successes++
+		c.failures = 0
+		if !c.healthy && c.successes >= c.specs.HealthyThreshold {
+			c.healthy = true
+			return true
+		}
+		return false
+	}
+	c.failures++
+	c.successes = 0
+	if c.healthy && c.failures >= c.specs.UnhealthyThreshold {
+		c.healthy = false
+		return true
+	}
+	return false
+}
+
+// Run checks the endpoint periodically until stop channel is closed
+func (c *Checker) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(c.specs.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			err := c.Check()
+			if c.record(err) && c.onChange != nil {
+				c.onChange(c.Healthy(), err)
+			}
+		}
+	}
+}
+
+// WaitUntilHealthy checks the endpoint until it answers, returning false when stopped before that
+func (c *Checker) WaitUntilHealthy(stop <-chan bool) bool {
+	ticker := time.NewTicker(waitInterval)
+	defer ticker.Stop()
+	for {
+		if err := c.Check(); err == nil {
+			c.mutex.Lock()
+			c.healthy = true
+			c.mutex.Unlock()
+			return true
+		}
+		select {
+		case <-stop:
+			return false
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package healthcheck
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	lm "github.com/loophole/cli/internal/app/loophole/models"
+)
+
+func endpointOf(t *testing.T, rawURL string) lm.Endpoint {
+	serverURL, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, _ := strconv.Atoi(serverURL.Port())
+	return lm.Endpoint{Protocol: serverURL.Scheme, Host: serverURL.Hostname(), Port: int32(port)}
+}
+
+func TestCheckerThresholds(t *testing.T) {
+	checker := New(lm.Endpoint{}, lm.HealthCheckSpecs{HealthyThreshold: 2, UnhealthyThreshold: 3}, nil, nil)
+	failure := errors.New("connection refused")
+
+	steps := []struct {
+		err             error
+		expectedHealthy bool
+		expectedChange  bool
+	}{
+		{failure, true, false},
+		{failure, true, false},
+		{nil, true, false},
+		{failure, true, false},
+		{failure, true, false},
+		{failure, false, true},
+		{nil, false, false},
+		{failure, false, false},
+		{nil, false, false},
+		{nil, true, true},
+	}
+	for i, step := range steps {
+		changed := checker.record(step.err)
+		if changed != step.expectedChange || checker.Healthy() != step.expectedHealthy {
+			t.Fatalf("Step %d: healthy %t (changed %t) is different than expected: %t (changed %t)", i, checker.Healthy(), changed, step.expectedHealthy, step.expectedChange)
+		}
+	}
+}
+
+func TestHTTPCheck(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	endpoint := endpointOf(t, server.URL)
+
+	if err := New(endpoint, lm.HealthCheckSpecs{Path: "/healthz"}, nil, nil).Check(); err != nil {
+		t.Fatalf("Healthy server failed the check: %v", err)
+	}
+	if err := New(endpoint, lm.HealthCheckSpecs{Path: "/other"}, nil, nil).Check(); err == nil {
+		t.Fatalf("Server responding with 503 passed the check")
+	}
+}
+
+func TestTCPCheck(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	endpoint := endpointOf(t, "tcp://"+listener.Addr().String())
+
+	if err := New(endpoint, lm.HealthCheckSpecs{}, nil, nil).Check(); err != nil {
+		t.Fatalf("Listening server failed the check: %v", err)
+	}
+	listener.Close()
+	if err := New(endpoint, lm.HealthCheckSpecs{}, nil, nil).Check(); err == nil {
+		t.Fatalf("Closed server passed the check")
+	}
+}
@@ -0,0 +1,71 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const commandTimeout = 30 * time.Second
+
+// commandSink runs the command in the shell, passing the event in LOOPHOLE_* environment variables
+type commandSink struct {
+	command string
+}
+
+func newCommandSink(command string) *commandSink {
+	return &commandSink{
+		command: command,
+	}
+}
+
+func (s *commandSink) Send(event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", s.command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", s.command)
+	}
+	cmd.Env = append(os.Environ(), eventEnvironment(event)...)
+	cmd.Env = append(cmd.Env, "LOOPHOLE_EVENT_JSON="+string(payload))
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		if trimmed := strings.TrimSpace(string(output)); trimmed != "" {
+			return fmt.Errorf("%s: %s", err.Error(), trimmed)
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *commandSink) String() string {
+	return fmt.Sprintf("command '%s'", s.command)
+}
+
+func eventEnvironment(event Event) []string {
+	return []string{
+		"LOOPHOLE_EVENT=" + event.Type,
+		"LOOPHOLE_EVENT_ID=" + event.ID,
+		"LOOPHOLE_EVENT_TIME=" + event.Time.Format(time.RFC3339),
+		"LOOPHOLE_EVENT_TEXT=" + event.Text,
+		"LOOPHOLE_TUNNEL_ID=" + event.TunnelID,
+		"LOOPHOLE_SITE_ID=" + event.SiteID,
+		"LOOPHOLE_SITE_URL=" + event.URL,
+		"LOOPHOLE_LOCAL_ENDPOINT=" + event.LocalEndpoint,
+		"LOOPHOLE_REMOTE_ADDR=" + event.RemoteAddr,
+		"LOOPHOLE_ERROR=" + event.Error,
+	}
+}
@@ -0,0 +1,161 @@
+// Package hooks notifies webhooks and local commands about tunnel lifecycle events
+package hooks
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/beevik/guid"
+	lm "github.com/loophole/cli/internal/app/loophole/models"
+	"github.com/loophole/cli/internal/pkg/communication"
+)
+
+// Tunnel lifecycle events
+const (
+	EventTunnelStarted      = "tunnel.started"
+	EventTunnelStopped      = "tunnel.stopped"
+	EventTunnelReconnecting = "tunnel.reconnecting"
+	EventTunnelFailed       = "tunnel.failed"
+	EventFirstVisitor       = "tunnel.first_visitor"
+)
+
+// EventTypes lists all the events hooks can be notified about
+var EventTypes = []string{EventTunnelStarted, EventTunnelStopped, EventTunnelReconnecting, EventTunnelFailed, EventFirstVisitor}
+
+// retryDelay is the delay before the first retry, doubled with each next one
+var retryDelay = time.Second
+
+// Event is the payload sent to the hooks, Text makes it usable with Slack compatible incoming webhooks
+type Event struct {
+	ID            string    `json:"id"`
+	Type          string    `json:"event"`
+	Time          time.Time `json:"time"`
+	Text          string    `json:"text"`
+	TunnelID      string    `json:"tunnelId"`
+	SiteID        string    `json:"siteId,omitempty"`
+	URL           string    `json:"url,omitempty"`
+	LocalEndpoint string    `json:"localEndpoint,omitempty"`
+	RemoteAddr    string    `json:"remoteAddr,omitempty"`
+	Error         string    `json:"error,omitempty"`
+}
+
+// permanentError is delivery failure which won't go away by retrying, e.g. webhook rejecting the request
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+// Sink delivers events to single destination
+type Sink interface {
+	Send(event Event) error
+	String() string
+}
+
+// Dispatcher delivers events to all the sinks in background, retrying failed deliveries
+type Dispatcher struct {
+	sinks   []Sink
+	events  map[string]bool
+	retries int
+	pending sync.WaitGroup
+}
+
+// NewDispatcher creates dispatcher with sinks for webhooks and commands from the specs
+func NewDispatcher(specs lm.HooksSpecs) (*Dispatcher, error) {
+	if specs.Retries < 0 {
+		return nil, fmt.Errorf("Invalid number of hook retries %d", specs.Retries)
+	}
+	dispatcher := &Dispatcher{
+		retries: specs.Retries,
+	}
+	for _, webhook := range specs.Webhooks {
+		webhookURL, err := url.Parse(webhook)
+		if err != nil || (webhookURL.Scheme != "http" && webhookURL.Scheme != "https") || webhookURL.Host == "" {
+			return nil, fmt.Errorf("Invalid webhook URL '%s', expected http or https URL", webhook)
+		}
+		dispatcher.sinks = append(dispatcher.sinks, newWebhookSink(webhook, specs.WebhookSecret))
+	}
+	for _, command := range specs.Commands {
+		dispatcher.sinks = append(dispatcher.sinks, newCommandSink(command))
+	}
+	if len(specs.Events) > 0 {
+		dispatcher.events = map[string]bool{}
+		for _, eventType := range specs.Events {
+			if !knownEvent(eventType) {
+				return nil, fmt.Errorf("Unknown hook event '%s', expected one of: %s", eventType, strings.Join(EventTypes, ", "))
+			}
+			dispatcher.events[eventType] = true
+		}
+	}
+	return dispatcher, nil
+}
+
+func knownEvent(eventType string) bool {
+	for _, known := range EventTypes {
+		if eventType == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Dispatch sends the event to all the sinks in background, unless the event type is filtered out
+func (d *Dispatcher) Dispatch(event Event) {
+	if d.events != nil && !d.events[event.Type] {
+		return
+	}
+	if event.ID == "" {
+		event.ID = guid.NewString()
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	for _, sink := range d.sinks {
+		d.pending.Add(1)
+		go func(sink Sink) {
+			defer d.pending.Done()
+			d.deliver(sink, event)
+		}(sink)
+	}
+}
+
+func (d *Dispatcher) deliver(sink Sink, event Event) {
+	delay := retryDelay
+	for attempt := 0; ; attempt++ {
+		err := sink.Send(event)
+		if err == nil {
+			communication.TunnelDebug(event.TunnelID, fmt.Sprintf("Event %s delivered to %s", event.Type, sink))
+			return
+		}
+		var permanent *permanentError
+		if attempt >= d.retries || errors.As(err, &permanent) {
+			communication.TunnelWarn(event.TunnelID, fmt.Sprintf("Failed to deliver event %s to %s: %s", event.Type, sink, err.Error()))
+			return
+		}
+		communication.TunnelDebug(event.TunnelID, fmt.Sprintf("Failed to deliver event %s to %s, retrying in %s: %s", event.Type, sink, delay, err.Error()))
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// Wait blocks until all the dispatched events are delivered or the timeout passes,
+// returning whether everything was delivered
+func (d *Dispatcher) Wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		d.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
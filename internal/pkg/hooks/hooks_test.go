@@ -0,0 +1,201 @@
+package hooks
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	lm "github.com/loophole/cli/internal/app/loophole/models"
+)
+
+func init() {
+	retryDelay = time.Millisecond
+}
+
+type receivedWebhook struct {
+	headers http.Header
+	event   Event
+	body    []byte
+}
+
+func newWebhookReceiver(t *testing.T, failures int) (*httptest.Server, func() []receivedWebhook) {
+	return newFailingWebhookReceiver(t, failures, http.StatusServiceUnavailable)
+}
+
+// newFailingWebhookReceiver responds to the first failures requests with given status
+func newFailingWebhookReceiver(t *testing.T, failures int, status int) (*httptest.Server, func() []receivedWebhook) {
+	var mutex sync.Mutex
+	received := []receivedWebhook{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if failures > 0 {
+			failures--
+			w.WriteHeader(status)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		var event Event
+		if err := json.Unmarshal(body, &event); err != nil {
+			t.Errorf("Webhook payload is not JSON: %v", err)
+		}
+		received = append(received, receivedWebhook{headers: r.Header, event: event, body: body})
+	}))
+	return server, func() []receivedWebhook {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return received
+	}
+}
+
+func TestWebhookIsSignedAndRetried(t *testing.T) {
+	server, received := newWebhookReceiver(t, 2)
+	defer server.Close()
+	dispatcher, err := NewDispatcher(lm.HooksSpecs{Webhooks: []string{server.URL}, WebhookSecret: "secret", Retries: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dispatcher.Dispatch(Event{Type: EventTunnelStarted, TunnelID: "tunnel", URL: "https://demo.loophole.site"})
+	if !dispatcher.Wait(time.Second) {
+		t.Fatalf("Event wasn't delivered in time")
+	}
+
+	webhooks := received()
+	if len(webhooks) != 1 {
+		t.Fatalf("Expected single delivery after retries, got %d", len(webhooks))
+	}
+	webhook := webhooks[0]
+	if webhook.headers.Get(SignatureHeader) != Sign("secret", webhook.body) {
+		t.Fatalf("Invalid signature %s", webhook.headers.Get(SignatureHeader))
+	}
+	if webhook.headers.Get(EventHeader) != EventTunnelStarted || webhook.event.ID == "" || webhook.event.URL != "https://demo.loophole.site" {
+		t.Fatalf("Unexpected webhook %v: %+v", webhook.headers, webhook.event)
+	}
+}
+
+func TestRejectedWebhookIsNotRetried(t *testing.T) {
+	server, received := newFailingWebhookReceiver(t, 1, http.StatusBadRequest)
+	defer server.Close()
+	dispatcher, err := NewDispatcher(lm.HooksSpecs{Webhooks: []string{server.URL}, Retries: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dispatcher.Dispatch(Event{Type: EventTunnelStarted, TunnelID: "tunnel"})
+	if !dispatcher.Wait(time.Second) {
+		t.Fatalf("Delivery didn't finish in time")
+	}
+
+	if webhooks := received(); len(webhooks) != 0 {
+		t.Fatalf("Event rejected by the webhook was retried: %+v", webhooks)
+	}
+}
+
+func TestDispatcherFiltersEvents(t *testing.T) {
+	server, received := newWebhookReceiver(t, 0)
+	defer server.Close()
+	if _, err := NewDispatcher(lm.HooksSpecs{Webhooks: []string{server.URL}, Events: []string{"tunnel.exploded"}}); err == nil {
+		t.Fatalf("Expected error for unknown event")
+	}
+	if _, err := NewDispatcher(lm.HooksSpecs{Webhooks: []string{"ftp://example.com"}}); err == nil {
+		t.Fatalf("Expected error for non HTTP webhook")
+	}
+	dispatcher, err := NewDispatcher(lm.HooksSpecs{Webhooks: []string{server.URL}, Events: []string{EventTunnelStopped}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dispatcher.Dispatch(Event{Type: EventTunnelStarted})
+	dispatcher.Dispatch(Event{Type: EventTunnelStopped})
+	dispatcher.Wait(time.Second)
+
+	if webhooks := received(); len(webhooks) != 1 || webhooks[0].event.Type != EventTunnelStopped {
+		t.Fatalf("Unexpected deliveries: %+v", webhooks)
+	}
+}
+
+func TestCommandGetsEventEnvironment(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Command uses POSIX shell")
+	}
+	directory, err := ioutil.TempDir("", "loophole-hooks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+	output := filepath.Join(directory, "event")
+
+	sink := newCommandSink(`echo "$LOOPHOLE_EVENT $LOOPHOLE_SITE_URL $LOOPHOLE_REMOTE_ADDR" > ` + output)
+	err = sink.Send(Event{Type: EventFirstVisitor, URL: "https://demo.loophole.site", RemoteAddr: "203.0.113.7:4321"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, _ := ioutil.ReadFile(output)
+	if strings.TrimSpace(string(content)) != "tunnel.first_visitor https://demo.loophole.site 203.0.113.7:4321" {
+		t.Fatalf("Unexpected command output: %s", content)
+	}
+	if err := newCommandSink("echo failure; exit 3").Send(Event{}); err == nil || !strings.Contains(err.Error(), "failure") {
+		t.Fatalf("Expected error with command output, got %v", err)
+	}
+}
+
+func TestNotifierDispatchesTunnelEvents(t *testing.T) {
+	server, received := newWebhookReceiver(t, 0)
+	defer server.Close()
+	dispatcher, err := NewDispatcher(lm.HooksSpecs{Webhooks: []string{server.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	notifier := NewNotifier(dispatcher)
+
+	notifier.TunnelStartSuccess(lm.RemoteEndpointSpecs{TunnelID: "tunnel", SiteID: "demo", Domain: "loophole.site"}, "http://127.0.0.1:3000")
+	notifier.TunnelStartFailure("other", errors.New("gateway unreachable"))
+	notifier.TunnelStopSuccess("tunnel")
+
+	events := map[string]Event{}
+	for _, webhook := range received() {
+		events[webhook.event.Type] = webhook.event
+	}
+	if events[EventTunnelStopped].URL != "https://demo.loophole.site" || events[EventTunnelStopped].LocalEndpoint != "http://127.0.0.1:3000" {
+		t.Fatalf("Stop event is missing details of the started tunnel: %+v", events[EventTunnelStopped])
+	}
+	if events[EventTunnelFailed].Error != "gateway unreachable" || events[EventTunnelFailed].Text == "" {
+		t.Fatalf("Unexpected failure event: %+v", events[EventTunnelFailed])
+	}
+}
+
+func TestNotifierStopsRunningTunnelsOnApplicationStop(t *testing.T) {
+	server, received := newWebhookReceiver(t, 0)
+	defer server.Close()
+	dispatcher, err := NewDispatcher(lm.HooksSpecs{Webhooks: []string{server.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	notifier := NewNotifier(dispatcher)
+
+	notifier.TunnelStartSuccess(lm.RemoteEndpointSpecs{TunnelID: "running", SiteID: "running", Domain: "loophole.site"}, "http://127.0.0.1:3000")
+	notifier.TunnelStartSuccess(lm.RemoteEndpointSpecs{TunnelID: "stopped", SiteID: "stopped", Domain: "loophole.site"}, "http://127.0.0.1:4000")
+	notifier.TunnelStopSuccess("stopped")
+	notifier.ApplicationStop()
+
+	stopped := []string{}
+	for _, webhook := range received() {
+		if webhook.event.Type == EventTunnelStopped {
+			stopped = append(stopped, webhook.event.TunnelID)
+		}
+	}
+	if strings.Join(stopped, ",") != "stopped,running" {
+		t.Fatalf("Expected single stop event for each tunnel, got %v", stopped)
+	}
+}
@@ -0,0 +1,120 @@
+package hooks
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	lm "github.com/loophole/cli/internal/app/loophole/models"
+	"github.com/loophole/cli/internal/pkg/communication"
+	"github.com/loophole/cli/internal/pkg/urlmaker"
+)
+
+// flushTimeout is how long final events are given to be delivered before the tunnel goes away
+const flushTimeout = 10 * time.Second
+
+// Notifier is communication mechanism dispatching tunnel lifecycle events, other communicates are ignored
+type Notifier struct {
+	communication.NoopMechanism
+	dispatcher *Dispatcher
+	// tunnels keeps details of started tunnels, so that they can be included in their later events
+	tunnels map[string]Event
+	mutex   sync.Mutex
+}
+
+// NewNotifier creates mechanism dispatching events, to be registered as communication sink
+func NewNotifier(dispatcher *Dispatcher) *Notifier {
+	return &Notifier{
+		dispatcher: dispatcher,
+		tunnels:    map[string]Event{},
+	}
+}
+
+// tunnelEvent returns event of given type with details of the tunnel
+func (n *Notifier) tunnelEvent(eventType string, tunnelID string) Event {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	event, ok := n.tunnels[tunnelID]
+	if !ok {
+		event = Event{TunnelID: tunnelID}
+	}
+	event.Type = eventType
+	return event
+}
+
+// tunnelName describes the tunnel in event texts
+func tunnelName(event Event) string {
+	if event.URL != "" {
+		return event.URL
+	}
+	return fmt.Sprintf("Tunnel %s", event.TunnelID)
+}
+
+func (n *Notifier) TunnelStartSuccess(remoteConfig lm.RemoteEndpointSpecs, localEndpoint string) {
+	event := Event{
+		Type:          EventTunnelStarted,
+		TunnelID:      remoteConfig.TunnelID,
+		SiteID:        remoteConfig.SiteID,
+		URL:           urlmaker.GetSiteURL("https", remoteConfig.SiteID, remoteConfig.Domain),
+		LocalEndpoint: localEndpoint,
+	}
+	n.mutex.Lock()
+	n.tunnels[remoteConfig.TunnelID] = event
+	n.mutex.Unlock()
+
+	event.Text = fmt.Sprintf("%s is up, forwarding to %s", event.URL, localEndpoint)
+	n.dispatcher.Dispatch(event)
+}
+
+// TunnelStartFailure waits for the event to be delivered, as other mechanisms may stop the application
+func (n *Notifier) TunnelStartFailure(tunnelID string, err error) {
+	event := n.tunnelEvent(EventTunnelFailed, tunnelID)
+	event.Error = err.Error()
+	event.Text = fmt.Sprintf("%s failed: %s", tunnelName(event), event.Error)
+	n.dispatcher.Dispatch(event)
+	n.dispatcher.Wait(flushTimeout)
+}
+
+func (n *Notifier) TunnelRestart(tunnelID string) {
+	event := n.tunnelEvent(EventTunnelReconnecting, tunnelID)
+	event.Text = fmt.Sprintf("%s lost connection to the gateway, reconnecting", tunnelName(event))
+	n.dispatcher.Dispatch(event)
+}
+
+// TunnelStopSuccess waits for the event to be delivered, as the application usually exits right after
+func (n *Notifier) TunnelStopSuccess(tunnelID string) {
+	n.dispatchStopped(tunnelID)
+	n.dispatcher.Wait(flushTimeout)
+}
+
+// ApplicationStop notifies about tunnels which are still running, as the application is being interrupted
+func (n *Notifier) ApplicationStop() {
+	n.mutex.Lock()
+	tunnelIDs := []string{}
+	for tunnelID := range n.tunnels {
+		tunnelIDs = append(tunnelIDs, tunnelID)
+	}
+	n.mutex.Unlock()
+
+	for _, tunnelID := range tunnelIDs {
+		n.dispatchStopped(tunnelID)
+	}
+	n.dispatcher.Wait(flushTimeout)
+}
+
+func (n *Notifier) dispatchStopped(tunnelID string) {
+	event := n.tunnelEvent(EventTunnelStopped, tunnelID)
+	event.Text = fmt.Sprintf("%s is down", tunnelName(event))
+	n.dispatcher.Dispatch(event)
+
+	n.mutex.Lock()
+	delete(n.tunnels, tunnelID)
+	n.mutex.Unlock()
+}
+
+func (n *Notifier) TunnelFirstVisitor(tunnelID string, remoteAddr string) {
+	event := n.tunnelEvent(EventFirstVisitor, tunnelID)
+	event.RemoteAddr = remoteAddr
+	event.Text = fmt.Sprintf("%s got its first visitor from %s", tunnelName(event), remoteAddr)
+	n.dispatcher.Dispatch(event)
+}
@@ -0,0 +1,80 @@
+package hooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// Headers sent with each webhook request
+const (
+	EventHeader     = "X-Loophole-Event"
+	DeliveryHeader  = "X-Loophole-Delivery"
+	SignatureHeader = "X-Loophole-Signature"
+)
+
+const webhookTimeout = 10 * time.Second
+
+// webhookSink posts events as JSON, signed with HMAC-SHA256 of the body when the secret is set
+type webhookSink struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+func newWebhookSink(url string, secret string) *webhookSink {
+	return &webhookSink{
+		url:    url,
+		secret: secret,
+		client: &http.Client{Timeout: webhookTimeout},
+	}
+}
+
+func (s *webhookSink) Send(event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(EventHeader, event.Type)
+	request.Header.Set(DeliveryHeader, event.ID)
+	if s.secret != "" {
+		request.Header.Set(SignatureHeader, Sign(s.secret, body))
+	}
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	io.Copy(ioutil.Discard, response.Body)
+	if response.StatusCode >= 500 {
+		return fmt.Errorf("Webhook responded with %s", response.Status)
+	}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return &permanentError{err: fmt.Errorf("Webhook responded with %s", response.Status)}
+	}
+	return nil
+}
+
+func (s *webhookSink) String() string {
+	return fmt.Sprintf("webhook %s", s.url)
+}
+
+// Sign returns value of the signature header for the body, so that receivers can verify it came from the tunnel
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,220 @@
+package httpserver
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	lm "github.com/loophole/cli/internal/app/loophole/models"
+	"github.com/loophole/cli/internal/pkg/communication"
+)
+
+const accessLogContextKey contextKey = "accessLog"
+
+const commonLogTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// accessLogEntry describes single served request, its fields are available to custom access log templates
+type accessLogEntry struct {
+	Time       time.Time     `json:"time"`
+	ClientIP   string        `json:"clientIp"`
+	User       string        `json:"user,omitempty"`
+	Method     string        `json:"method"`
+	Host       string        `json:"host"`
+	Path       string        `json:"path"`
+	Protocol   string        `json:"protocol"`
+	Status     int           `json:"status"`
+	Bytes      int64         `json:"bytes"`
+	Duration   time.Duration `json:"-"`
+	DurationMs float64       `json:"durationMs"`
+	UserAgent  string        `json:"userAgent,omitempty"`
+	Referer    string        `json:"referer,omitempty"`
+	RequestID  string        `json:"requestId,omitempty"`
+}
+
+type accessLogFormatter func(entry *accessLogEntry) ([]byte, error)
+
+// accessLog writes an entry for each request after it's served
+type accessLog struct {
+	writer io.Writer
+	format accessLogFormatter
+}
+
+func newAccessLog(specs lm.AccessLogSpecs) (*accessLog, error) {
+	format, err := newAccessLogFormatter(specs.Format)
+	if err != nil {
+		return nil, err
+	}
+	var writer io.Writer = os.Stdout
+	if specs.File != lm.AccessLogStdout {
+		writer, err = newRotatingFile(specs.File, specs.MaxSize, specs.MaxBackups)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to open access log: %v", err)
+		}
+	}
+	return &accessLog{
+		writer: writer,
+		format: format,
+	}, nil
+}
+
+func newAccessLogFormatter(format string) (accessLogFormatter, error) {
+	switch format {
+	case "", lm.AccessLogFormatCombined:
+		return formatCombinedLog, nil
+	case lm.AccessLogFormatCommon:
+		return formatCommonLog, nil
+	case lm.AccessLogFormatJSON:
+		return formatJSONLog, nil
+	}
+	logTemplate, err := template.New("accessLog").Parse(format)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid access log format: %v", err)
+	}
+	return func(entry *accessLogEntry) ([]byte, error) {
+		var line bytes.Buffer
+		if err := logTemplate.Execute(&line, entry); err != nil {
+			return nil, err
+		}
+		if !bytes.HasSuffix(line.Bytes(), []byte("\n")) {
+			line.WriteByte('\n')
+		}
+		return line.Bytes(), nil
+	}, nil
+}
+
+func (l *accessLog) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		entry := &accessLogEntry{
+			Time:      start,
+			ClientIP:  clientIP(r).String(),
+			Method:    r.Method,
+			Host:      r.Host,
+			Path:      r.URL.RequestURI(),
+			Protocol:  r.Proto,
+			UserAgent: r.UserAgent(),
+			Referer:   r.Referer(),
+			RequestID: requestIDFromRequest(r),
+		}
+		recorder := &accessLogResponseWriter{ResponseWriter: w}
+
+		// entry is passed in the context, so that authentication handlers can fill in the user
+		next.ServeHTTP(recorder, r.WithContext(context.WithValue(r.Context(), accessLogContextKey, entry)))
+
+		entry.Status = recorder.status
+		if entry.Status == 0 {
+			entry.Status = http.StatusOK
+		}
+		entry.Bytes = recorder.bytes
+		entry.Duration = time.Since(start)
+		entry.DurationMs = float64(entry.Duration.Microseconds()) / 1000
+		l.write(entry)
+	})
+}
+
+func (l *accessLog) write(entry *accessLogEntry) {
+	line, err := l.format(entry)
+	if err == nil {
+		_, err = l.writer.Write(line)
+	}
+	if err != nil {
+		communication.Debug(fmt.Sprintf("Failed to write access log: %v", err))
+	}
+}
+
+func formatCommonLog(entry *accessLogEntry) ([]byte, error) {
+	size := "-"
+	if entry.Bytes > 0 {
+		size = strconv.FormatInt(entry.Bytes, 10)
+	}
+	return []byte(fmt.Sprintf("%s - %s [%s] %s %d %s\n",
+		entry.ClientIP,
+		commonLogField(entry.User),
+		entry.Time.Format(commonLogTimeFormat),
+		strconv.Quote(fmt.Sprintf("%s %s %s", entry.Method, entry.Path, entry.Protocol)),
+		entry.Status,
+		size,
+	)), nil
+}
+
+func formatCombinedLog(entry *accessLogEntry) ([]byte, error) {
+	line, _ := formatCommonLog(entry)
+	return []byte(fmt.Sprintf("%s %s %s\n",
+		bytes.TrimSuffix(line, []byte("\n")),
+		strconv.Quote(entry.Referer),
+		strconv.Quote(entry.UserAgent),
+	)), nil
+}
+
+func formatJSONLog(entry *accessLogEntry) ([]byte, error) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+	return append(line, '\n'), nil
+}
+
+// commonLogField replaces empty values with dash and keeps user controlled value in single field
+func commonLogField(value string) string {
+	if value == "" {
+		return "-"
+	}
+	quoted := strconv.QuoteToASCII(value)
+	return strings.ReplaceAll(quoted[1:len(quoted)-1], " ", "%20")
+}
+
+// accessLogResponseWriter records status code and size of the response
+type accessLogResponseWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *accessLogResponseWriter) WriteHeader(statusCode int) {
+	// informational responses can be followed by the final one
+	if w.status < http.StatusOK {
+		w.status = statusCode
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *accessLogResponseWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func (w *accessLogResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack is used by the proxy to pass protocol upgrades, e.g. WebSockets
+func (w *accessLogResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("Connection doesn't support hijacking")
+	}
+	if w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return hijacker.Hijack()
+}
+
+func (w *accessLogResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,103 @@
+package httpserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	lm "github.com/loophole/cli/internal/app/loophole/models"
+)
+
+func serveLogged(t *testing.T, format string, request *http.Request) string {
+	formatter, err := newAccessLogFormatter(format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var output bytes.Buffer
+	log := &accessLog{writer: &output, format: formatter}
+	handler := requestIDHandler(log.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = withUser(r, "alice")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello"))
+	})))
+
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+	return output.String()
+}
+
+func TestAccessLogCombinedFormat(t *testing.T) {
+	request := httptest.NewRequest(http.MethodPost, "/items?id=1", nil)
+	request.RemoteAddr = "203.0.113.7:4321"
+	request.Header.Set("User-Agent", `curl "quoted"`)
+	request.Header.Set("Referer", "https://example.com/")
+
+	line := serveLogged(t, lm.AccessLogFormatCombined, request)
+
+	expected := regexp.MustCompile(`^203\.0\.113\.7 - alice \[[^\]]+\] "POST /items\?id=1 HTTP/1\.1" 201 5 "https://example.com/" "curl \\"quoted\\""\n$`)
+	if !expected.MatchString(line) {
+		t.Fatalf("Unexpected access log line: %s", line)
+	}
+}
+
+func TestAccessLogJSONFormat(t *testing.T) {
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set(RequestIDHeader, "trace-1")
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(serveLogged(t, lm.AccessLogFormatJSON, request)), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry["user"] != "alice" || entry["status"] != float64(201) || entry["bytes"] != float64(5) || entry["requestId"] != "trace-1" {
+		t.Fatalf("Unexpected access log entry: %v", entry)
+	}
+	if _, ok := entry["durationMs"]; !ok {
+		t.Fatalf("Access log entry is missing duration: %v", entry)
+	}
+}
+
+func TestAccessLogTemplateFormat(t *testing.T) {
+	line := serveLogged(t, "{{ .Method }} {{ .Path }} {{ .Status }}", httptest.NewRequest(http.MethodGet, "/page", nil))
+
+	if line != "GET /page 201\n" {
+		t.Fatalf("Unexpected access log line: %q", line)
+	}
+	if _, err := newAccessLogFormatter("{{ .Method"); err == nil {
+		t.Fatalf("Expected error for invalid template")
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	directory, err := ioutil.TempDir("", "loophole-access-log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+	path := filepath.Join(directory, "access.log")
+
+	file, err := newRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := file.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	file.Close()
+
+	for suffix, expected := range map[string]string{"": "fourth\n", ".1": "third\n", ".2": "second\n"} {
+		content, err := ioutil.ReadFile(path + suffix)
+		if err != nil || string(content) != expected {
+			t.Fatalf("File %s contains %q, expected %q (%v)", path+suffix, content, expected, err)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Fatalf("Expected only two backups to be kept")
+	}
+}
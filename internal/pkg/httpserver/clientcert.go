@@ -0,0 +1,57 @@
+package httpserver
+
+import (
+	"net/http"
+)
+
+// ClientCertSubjectHeader carries subject of the verified client certificate to the upstream
+const ClientCertSubjectHeader = "X-Client-Cert-Subject"
+
+// clientCertGate passes subject of verified client certificate to the upstream,
+// and rejects requests without one for paths where certificate is required
+type clientCertGate struct {
+	requiredPaths []string
+}
+
+func newClientCertGate(requiredPaths []string) *clientCertGate {
+	return &clientCertGate{
+		requiredPaths: requiredPaths,
+	}
+}
+
+func (g *clientCertGate) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// value sent by the client can't be trusted
+		r.Header.Del(ClientCertSubjectHeader)
+
+		if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+			subject := r.TLS.VerifiedChains[0][0].Subject
+			r.Header.Set(ClientCertSubjectHeader, subject.String())
+			if userFromRequest(r) == "" {
+				r = withUser(r, subject.CommonName)
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if g.isRequired(r.URL.Path) {
+			writeForbiddenPage(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isRequired returns whether client certificate is required for the path, which is every path
+// unless only specific ones were configured, and every path with '..' segments the upstream might resolve differently
+func (g *clientCertGate) isRequired(path string) bool {
+	if len(g.requiredPaths) == 0 {
+		return true
+	}
+	for _, requiredPath := range g.requiredPaths {
+		if matches, ok := matchesCleanPathPrefix(path, requiredPath); matches || !ok {
+			return true
+		}
+	}
+	return false
+}
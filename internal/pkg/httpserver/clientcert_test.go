@@ -0,0 +1,58 @@
+package httpserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientCertGate(t *testing.T) {
+	verified := &tls.ConnectionState{
+		VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: "webhook-sender", Organization: []string{"Example"}}}}},
+	}
+	testCases := []struct {
+		name            string
+		requiredPaths   []string
+		path            string
+		connectionState *tls.ConnectionState
+		expectedStatus  int
+		expectedSubject string
+	}{
+		{"certificate required everywhere", nil, "/", nil, http.StatusForbidden, ""},
+		{"verified certificate", nil, "/", verified, http.StatusOK, "CN=webhook-sender,O=Example"},
+		{"optional certificate", []string{"/hooks"}, "/index.html", nil, http.StatusOK, ""},
+		{"certificate required for the path", []string{"/hooks"}, "/hooks/github", nil, http.StatusForbidden, ""},
+		{"verified certificate for the path", []string{"/hooks"}, "/hooks/github", verified, http.StatusOK, "CN=webhook-sender,O=Example"},
+		{"path with doubled slash", []string{"/hooks"}, "//hooks/github", nil, http.StatusForbidden, ""},
+		{"path with dot segment", []string{"/hooks"}, "/hooks/./github", nil, http.StatusForbidden, ""},
+		{"path escaping other directory", []string{"/hooks"}, "/static/../hooks/github", nil, http.StatusForbidden, ""},
+		{"path with parent segment", []string{"/hooks"}, "/static/../index.html", nil, http.StatusForbidden, ""},
+	}
+
+	for _, testCase := range testCases {
+		var subject, user string
+		handler := newClientCertGate(testCase.requiredPaths).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			subject = r.Header.Get(ClientCertSubjectHeader)
+			user = userFromRequest(r)
+		}))
+		request := httptest.NewRequest(http.MethodGet, testCase.path, nil)
+		request.Header.Set(ClientCertSubjectHeader, "CN=spoofed")
+		request.TLS = testCase.connectionState
+		recorder := httptest.NewRecorder()
+
+		handler.ServeHTTP(recorder, request)
+
+		if recorder.Code != testCase.expectedStatus {
+			t.Fatalf("%s: status code %d is different than expected: %d", testCase.name, recorder.Code, testCase.expectedStatus)
+		}
+		if subject != testCase.expectedSubject {
+			t.Fatalf("%s: subject '%s' is different than expected: '%s'", testCase.name, subject, testCase.expectedSubject)
+		}
+		if testCase.expectedSubject != "" && user != "webhook-sender" {
+			t.Fatalf("%s: user '%s' is different than expected: 'webhook-sender'", testCase.name, user)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package httpserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	_ "embed" // default error page and logo are embedded, so that they work offline
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/loophole/cli/internal/pkg/communication"
+)
+
+// logoPath is where the embedded logo is served from, used by the error pages
+const logoPath = "/.loophole/logo.png"
+
+const errorPagesContextKey contextKey = "errorPages"
+
+// Error categories describe what went wrong without revealing details of the local setup
+const (
+	errorCategoryForbidden         = "forbidden"
+	errorCategoryUpstreamDown      = "upstream_down"
+	errorCategoryConnectionRefused = "connection_refused"
+	errorCategoryTimeout           = "upstream_timeout"
+	errorCategoryHostNotFound      = "host_not_found"
+	errorCategoryTLS               = "upstream_tls_error"
+	errorCategoryUnavailable       = "upstream_unavailable"
+)
+
+var errorMessages = map[string]string{
+	errorCategoryForbidden:         "You are not allowed to access this site.",
+	errorCategoryUpstreamDown:      "The site is temporarily unavailable, this page will reload automatically once it's back.",
+	errorCategoryConnectionRefused: "it looks like the application you're trying to expose is not running.",
+	errorCategoryTimeout:           "it looks like the application you're trying to expose didn't respond in time.",
+	errorCategoryHostNotFound:      "it looks like the host of the application you're trying to expose can't be found.",
+	errorCategoryTLS:               "it looks like the secure connection to the application you're trying to expose failed.",
+	errorCategoryUnavailable:       "it looks like the application you're trying to expose is not available.",
+}
+
+//go:embed assets/logo.png
+var logo []byte
+
+//go:embed assets/error.html
+var defaultErrorTemplateSource string
+
+var defaultErrorTemplate = template.Must(template.New("error").Parse(defaultErrorTemplateSource))
+
+// errorPage is the data error templates are executed with
+type errorPage struct {
+	StatusCode int
+	StatusText string
+	Category   string
+	Message    string
+	RequestID  string
+	LogoURL    string
+	ProxyError bool
+}
+
+// errorPages renders error responses with user provided template, reloaded whenever it changes
+type errorPages struct {
+	file     *reloadableFile
+	template *template.Template
+	mutex    sync.RWMutex
+}
+
+func newErrorPages(templateFile string) (*errorPages, error) {
+	pages := &errorPages{
+		template: defaultErrorTemplate,
+	}
+	if templateFile == "" {
+		return pages, nil
+	}
+	var err error
+	pages.file, err = newReloadableFile(templateFile, pages.load)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load error template '%s': %v", templateFile, err)
+	}
+	return pages, nil
+}
+
+func (p *errorPages) load(path string) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	parsed, err := template.New("error").Parse(string(content))
+	if err != nil {
+		return err
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.template = parsed
+	return nil
+}
+
+func (p *errorPages) currentTemplate() *template.Template {
+	if p.file != nil {
+		reloaded, err := p.file.reloadIfChanged()
+		if err != nil {
+			communication.Warn(fmt.Sprintf("Failed to reload error template from '%s', keeping previous version: %s", p.file.path, err.Error()))
+		} else if reloaded {
+			communication.Info(fmt.Sprintf("Error template reloaded from '%s'", p.file.path))
+		}
+	}
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.template
+}
+
+// Handler serves the embedded logo and makes the pages available to handlers writing errors
+func (p *errorPages) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == logoPath && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+			w.Header().Set("Content-Type", "image/png")
+			w.Header().Set("Cache-Control", "public, max-age=86400")
+			w.Write(logo)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), errorPagesContextKey, p)))
+	})
+}
+
+// prefersJSON returns whether the client asked for JSON rather than HTML
+func prefersJSON(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "application/json") && !strings.Contains(accept, "text/html")
+}
+
+// writeErrorPage responds with the error rendered as JSON or with the error template
+func writeErrorPage(w http.ResponseWriter, r *http.Request, page errorPage) {
+	page.StatusText = http.StatusText(page.StatusCode)
+	page.RequestID = requestIDFromRequest(r)
+	page.LogoURL = logoPath
+	if page.Message == "" {
+		page.Message = errorMessages[page.Category]
+	}
+
+	if prefersJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(page.StatusCode)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":    page.StatusCode,
+			"error":     page.StatusText,
+			"category":  page.Category,
+			"requestId": page.RequestID,
+		})
+		return
+	}
+
+	errorTemplate := defaultErrorTemplate
+	if pages, ok := r.Context().Value(errorPagesContextKey).(*errorPages); ok {
+		errorTemplate = pages.currentTemplate()
+	}
+	var body bytes.Buffer
+	if err := errorTemplate.Execute(&body, page); err != nil {
+		communication.Warn(fmt.Sprintf("Failed to render error template, using default one: %s", err.Error()))
+		body.Reset()
+		defaultErrorTemplate.Execute(&body, page)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(page.StatusCode)
+	w.Write(body.Bytes())
+}
+
+func writeForbiddenPage(w http.ResponseWriter, r *http.Request) {
+	writeErrorPage(w, r, errorPage{
+		StatusCode: http.StatusForbidden,
+		Category:   errorCategoryForbidden,
+	})
+}
+
+// writeMaintenancePage responds with 503 status, plain text one is used when proxy error page is disabled
+func writeMaintenancePage(w http.ResponseWriter, r *http.Request, plain bool) {
+	w.Header().Set("Retry-After", maintenanceRetryAfter)
+	if plain {
+		http.Error(w, "Upstream is down", http.StatusServiceUnavailable)
+		return
+	}
+	writeErrorPage(w, r, errorPage{
+		StatusCode: http.StatusServiceUnavailable,
+		Category:   errorCategoryUpstreamDown,
+	})
+}
+
+func proxyErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	category, statusCode := categorizeProxyError(err)
+	communication.Warn(fmt.Sprintf("Proxying %s %s failed (request ID %s): %s", r.Method, r.URL.Path, requestIDFromRequest(r), err.Error()))
+	writeErrorPage(w, r, errorPage{
+		StatusCode: statusCode,
+		Category:   category,
+		ProxyError: true,
+	})
+}
+
+// categorizeProxyError maps error of the reverse proxy to category safe to show to visitors and status code
+func categorizeProxyError(err error) (string, int) {
+	var netErr net.Error
+	var dnsErr *net.DNSError
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var certificateErr x509.CertificateInvalidError
+	var recordHeaderErr tls.RecordHeaderError
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()):
+		return errorCategoryTimeout, http.StatusGatewayTimeout
+	case errors.As(err, &dnsErr):
+		return errorCategoryHostNotFound, http.StatusBadGateway
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return errorCategoryConnectionRefused, http.StatusBadGateway
+	case errors.As(err, &unknownAuthorityErr) || errors.As(err, &hostnameErr) || errors.As(err, &certificateErr) || errors.As(err, &recordHeaderErr):
+		return errorCategoryTLS, http.StatusBadGateway
+	default:
+		return errorCategoryUnavailable, http.StatusBadGateway
+	}
+}
@@ -0,0 +1,103 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	lm "github.com/loophole/cli/internal/app/loophole/models"
+)
+
+// closedPortEndpoint returns endpoint nothing listens on
+func closedPortEndpoint(t *testing.T) lm.Endpoint {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+	return lm.Endpoint{Protocol: "http", Host: "127.0.0.1", Port: int32(port)}
+}
+
+func proxyWithErrorPages(t *testing.T, templateFile string) http.Handler {
+	pages, err := newErrorPages(templateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	psb := &proxyServerBuilder{serverBuilder: &serverBuilder{siteID: "site", domain: "loophole.site"}}
+	return requestIDHandler(pages.Handler(psb.newReverseProxy(closedPortEndpoint(t), "", false, "")))
+}
+
+func TestProxyErrorPageHidesErrorDetails(t *testing.T) {
+	handler := proxyWithErrorPages(t, "")
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set(RequestIDHeader, "trace-123")
+	recorder := httptest.NewRecorder()
+
+	handler.ServeHTTP(recorder, request)
+
+	body := recorder.Body.String()
+	if recorder.Code != http.StatusBadGateway {
+		t.Fatalf("Status code %d is different than expected: %d", recorder.Code, http.StatusBadGateway)
+	}
+	if strings.Contains(body, "127.0.0.1") || strings.Contains(body, "dial tcp") {
+		t.Fatalf("Error page reveals details of the local setup: %s", body)
+	}
+	if !strings.Contains(body, "not running") || !strings.Contains(body, "trace-123") || !strings.Contains(body, logoPath) {
+		t.Fatalf("Error page doesn't describe the error with request ID and embedded logo: %s", body)
+	}
+}
+
+func TestProxyErrorAsJSON(t *testing.T) {
+	handler := proxyWithErrorPages(t, "")
+	request := httptest.NewRequest(http.MethodGet, "/api", nil)
+	request.Header.Set("Accept", "application/json")
+	recorder := httptest.NewRecorder()
+
+	handler.ServeHTTP(recorder, request)
+
+	var response map[string]interface{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Response is not JSON: %v", err)
+	}
+	if recorder.Code != http.StatusBadGateway || response["category"] != errorCategoryConnectionRefused || response["requestId"] != recorder.Header().Get(RequestIDHeader) {
+		t.Fatalf("Unexpected JSON error response %d: %v", recorder.Code, response)
+	}
+}
+
+func TestCustomErrorTemplate(t *testing.T) {
+	directory, err := ioutil.TempDir("", "loophole-error-template")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+	templateFile := filepath.Join(directory, "error.html")
+	ioutil.WriteFile(templateFile, []byte("<p>{{ .StatusCode }} {{ .Category }} {{ .Message }}</p>"), 0600)
+
+	if _, err := newErrorPages(filepath.Join(directory, "missing.html")); err == nil {
+		t.Fatalf("Expected error for missing template")
+	}
+	recorder := httptest.NewRecorder()
+	proxyWithErrorPages(t, templateFile).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if !strings.HasPrefix(recorder.Body.String(), "<p>502 connection_refused it looks like") {
+		t.Fatalf("Custom template wasn't used: %s", recorder.Body.String())
+	}
+}
+
+func TestEmbeddedLogoIsServed(t *testing.T) {
+	pages, _ := newErrorPages("")
+	recorder := httptest.NewRecorder()
+
+	pages.Handler(namedHandler("site")).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, logoPath, nil))
+
+	if recorder.Header().Get("Content-Type") != "image/png" || recorder.Body.Len() != len(logo) {
+		t.Fatalf("Logo wasn't served: %s, %d bytes", recorder.Header().Get("Content-Type"), recorder.Body.Len())
+	}
+}
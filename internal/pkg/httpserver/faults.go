@@ -0,0 +1,49 @@
+package httpserver
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	lm "github.com/loophole/cli/internal/app/loophole/models"
+	"github.com/loophole/cli/internal/pkg/communication"
+)
+
+// faultInjector responds with configured error status instead of proxying
+// a percentage of requests, the first matching rule which fires wins
+type faultInjector struct {
+	rules  []lm.FaultRule
+	random func() float64
+}
+
+func newFaultInjector(rules []lm.FaultRule) *faultInjector {
+	source := rand.New(rand.NewSource(time.Now().UnixNano()))
+	mutex := sync.Mutex{}
+	return &faultInjector{
+		rules: rules,
+		random: func() float64 {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return source.Float64()
+		},
+	}
+}
+
+func (f *faultInjector) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, rule := range f.rules {
+			if !matchesPathPrefix(r.URL.Path, rule.Prefix) {
+				continue
+			}
+			if f.random()*100 < rule.Percentage {
+				communication.Debug(fmt.Sprintf("Injecting %d fault for %s %s", rule.StatusCode, r.Method, r.URL.Path))
+				w.Header().Set("X-Loophole-Fault", "injected")
+				http.Error(w, http.StatusText(rule.StatusCode), rule.StatusCode)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,38 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	lm "github.com/loophole/cli/internal/app/loophole/models"
+)
+
+func TestFaultInjector(t *testing.T) {
+	injector := newFaultInjector([]lm.FaultRule{
+		{Prefix: "/api/orders", StatusCode: http.StatusServiceUnavailable, Percentage: 20},
+		{Prefix: "/api", StatusCode: http.StatusInternalServerError, Percentage: 100},
+	})
+	handler := injector.Handler(namedHandler("backend"))
+
+	testCases := []struct {
+		path         string
+		random       float64
+		expectedCode int
+	}{
+		{"/api/orders/1", 0.1, http.StatusServiceUnavailable},
+		{"/api/orders/1", 0.5, http.StatusInternalServerError},
+		{"/api/users", 0.99, http.StatusInternalServerError},
+		{"/static/app.js", 0, http.StatusOK},
+	}
+
+	for _, testCase := range testCases {
+		random := testCase.random
+		injector.random = func() float64 { return random }
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, testCase.path, nil))
+		if recorder.Code != testCase.expectedCode {
+			t.Fatalf("Status code %d for %s is different than expected: %d", recorder.Code, testCase.path, testCase.expectedCode)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package httpserver
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+
+	lm "github.com/loophole/cli/internal/app/loophole/models"
+)
+
+func applyHeaderRules(header http.Header, rules []lm.HeaderRule) {
+	for _, rule := range rules {
+		switch rule.Action {
+		case lm.HeaderActionSet:
+			header.Set(rule.Name, rule.Value)
+		case lm.HeaderActionAdd:
+			header.Add(rule.Name, rule.Value)
+		case lm.HeaderActionRemove:
+			header.Del(rule.Name)
+		}
+	}
+}
+
+// forwardedHeader produces RFC 7239 Forwarded header value for the client address
+func forwardedHeader(remoteAddr string, host string) string {
+	return fmt.Sprintf("for=%s;host=%s;proto=https", forwardedNode(remoteAddr), host)
+}
+
+func forwardedNode(remoteAddr string) string {
+	clientIP, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		clientIP = remoteAddr
+	}
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return "unknown"
+	}
+	if ip.To4() == nil {
+		// IPv6 addresses have to be quoted and enclosed in square brackets
+		return fmt.Sprintf("\"[%s]\"", ip.String())
+	}
+	return ip.String()
+}
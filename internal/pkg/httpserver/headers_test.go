@@ -0,0 +1,73 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	lm "github.com/loophole/cli/internal/app/loophole/models"
+)
+
+func TestApplyHeaderRules(t *testing.T) {
+	header := http.Header{}
+	header.Set("X-Powered-By", "Express")
+	header.Set("X-Env", "dev")
+
+	applyHeaderRules(header, []lm.HeaderRule{
+		{Action: lm.HeaderActionRemove, Name: "X-Powered-By"},
+		{Action: lm.HeaderActionSet, Name: "X-Env", Value: "staging"},
+		{Action: lm.HeaderActionAdd, Name: "X-Tag", Value: "a"},
+		{Action: lm.HeaderActionAdd, Name: "X-Tag", Value: "b"},
+	})
+
+	if header.Get("X-Powered-By") != "" {
+		t.Fatalf("Header X-Powered-By should be removed")
+	}
+	if header.Get("X-Env") != "staging" {
+		t.Fatalf("Header X-Env '%s' is different than expected: 'staging'", header.Get("X-Env"))
+	}
+	if len(header.Values("X-Tag")) != 2 {
+		t.Fatalf("Header X-Tag should have two values, got: %v", header.Values("X-Tag"))
+	}
+}
+
+func TestForwardedHeader(t *testing.T) {
+	cases := map[string]string{
+		"203.0.113.7:51234": "for=203.0.113.7;host=site.loophole.site;proto=https",
+		"[2001:db8::1]:443": "for=\"[2001:db8::1]\";host=site.loophole.site;proto=https",
+		"not-an-address":    "for=unknown;host=site.loophole.site;proto=https",
+		"198.51.100.1":      "for=198.51.100.1;host=site.loophole.site;proto=https",
+	}
+	for remoteAddr, expected := range cases {
+		if result := forwardedHeader(remoteAddr, "site.loophole.site"); result != expected {
+			t.Fatalf("Forwarded header '%s' is different than expected: '%s'", result, expected)
+		}
+	}
+}
+
+func TestReverseProxyHostHeaderModes(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host))
+	}))
+	defer upstream.Close()
+	upstreamURL, _ := url.Parse(upstream.URL)
+	port, _ := strconv.Atoi(upstreamURL.Port())
+	endpoint := lm.Endpoint{Protocol: "http", Host: "127.0.0.1", Port: int32(port)}
+
+	cases := map[string]string{
+		lm.HostHeaderRewrite:  upstreamURL.Host,
+		lm.HostHeaderPreserve: "demo.loophole.site",
+		"app.internal":        "app.internal",
+	}
+	for mode, expected := range cases {
+		psb := &proxyServerBuilder{serverBuilder: &serverBuilder{siteID: "demo", domain: "loophole.site"}, hostHeader: mode}
+		recorder := httptest.NewRecorder()
+		psb.newReverseProxy(endpoint, "", false, "").ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "https://demo.loophole.site/", nil))
+
+		if recorder.Body.String() != expected {
+			t.Fatalf("Host header mode '%s' sent '%s' instead of '%s'", mode, recorder.Body.String(), expected)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package httpserver
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	auth "github.com/abbot/go-http-auth"
+	"github.com/loophole/cli/internal/pkg/communication"
+)
+
+// htpasswdFile provides password hashes (bcrypt, SHA or MD5) of users listed in htpasswd file,
+// the file is reloaded whenever it changes
+type htpasswdFile struct {
+	file  *reloadableFile
+	users map[string]string
+	mutex sync.RWMutex
+}
+
+func newHtpasswdFile(path string) (*htpasswdFile, error) {
+	htpasswd := &htpasswdFile{}
+	file, err := newReloadableFile(path, htpasswd.load)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read htpasswd file '%s': %v", path, err)
+	}
+	htpasswd.file = file
+	return htpasswd, nil
+}
+
+func (h *htpasswdFile) load(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	users := map[string]string{}
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("line %d: expected '<user>:<password hash>'", lineNumber)
+		}
+		users[parts[0]] = parts[1]
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.users = users
+	return nil
+}
+
+// SecretProvider returns password hash of the user
+func (h *htpasswdFile) SecretProvider(user string, realm string) string {
+	reloaded, err := h.file.reloadIfChanged()
+	if err != nil {
+		communication.Warn(fmt.Sprintf("Failed to reload htpasswd file '%s', keeping previous version: %s", h.file.path, err.Error()))
+	} else if reloaded {
+		communication.Info(fmt.Sprintf("Users reloaded from htpasswd file '%s'", h.file.path))
+	}
+
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return h.users[user]
+}
+
+// getBasicAuthSecrets combines user provided via command line with users from htpasswd file
+func getBasicAuthSecrets(username string, password string, htpasswdFilePath string) (auth.SecretProvider, error) {
+	providers := []auth.SecretProvider{}
+	if username != "" && password != "" {
+		hashedPassword, err := bcryptHash(password)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, getBasicAuthSecretParser(username, hashedPassword))
+	}
+	if htpasswdFilePath != "" {
+		htpasswd, err := newHtpasswdFile(htpasswdFilePath)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, htpasswd.SecretProvider)
+	}
+
+	return func(user string, realm string) string {
+		for _, provider := range providers {
+			if secret := provider(user, realm); secret != "" {
+				return secret
+			}
+		}
+		return ""
+	}, nil
+}
@@ -0,0 +1,104 @@
+package httpserver
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeHtpasswdFile(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "htpasswd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bcryptHash, err := bcryptHash("alice-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	shaHash := sha1.Sum([]byte("bob-password"))
+	content := fmt.Sprintf("# users\nalice:%s\nbob:{SHA}%s\n", bcryptHash, base64.StdEncoding.EncodeToString(shaHash[:]))
+
+	path := filepath.Join(dir, "users")
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestHtpasswdUsersCanAuthenticate(t *testing.T) {
+	path := writeHtpasswdFile(t)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	secrets, err := getBasicAuthSecrets("", "", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := getBasicAuthHandler("site", "loophole.site", secrets, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(userFromRequest(r)))
+	})
+
+	cases := []struct {
+		user     string
+		password string
+		status   int
+	}{
+		{"alice", "alice-password", http.StatusOK},
+		{"bob", "bob-password", http.StatusOK},
+		{"bob", "alice-password", http.StatusUnauthorized},
+		{"carol", "carol-password", http.StatusUnauthorized},
+	}
+	for _, c := range cases {
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		request.SetBasicAuth(c.user, c.password)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+
+		if recorder.Code != c.status {
+			t.Fatalf("Status code %d for user '%s' is different than expected: %d", recorder.Code, c.user, c.status)
+		}
+		if c.status == http.StatusOK && recorder.Body.String() != c.user {
+			t.Fatalf("Authenticated user '%s' is different than expected: '%s'", recorder.Body.String(), c.user)
+		}
+	}
+}
+
+func TestReadOnlyUsersCannotModifyFiles(t *testing.T) {
+	handler := readOnlyUsersHandler([]string{"bob"}, namedHandler("webdav"))
+
+	cases := []struct {
+		user   string
+		method string
+		status int
+	}{
+		{"bob", "PROPFIND", http.StatusOK},
+		{"bob", http.MethodGet, http.StatusOK},
+		{"bob", http.MethodPut, http.StatusForbidden},
+		{"bob", "MKCOL", http.StatusForbidden},
+		{"alice", http.MethodPut, http.StatusOK},
+	}
+	for _, c := range cases {
+		request := withUser(httptest.NewRequest(c.method, "/file.txt", nil), c.user)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+
+		if recorder.Code != c.status {
+			t.Fatalf("Status code %d for %s by '%s' is different than expected: %d", recorder.Code, c.method, c.user, c.status)
+		}
+	}
+}
+
+func TestReadOnlyUsersRequireAuthentication(t *testing.T) {
+	_, err := New().WithSiteID("site").WithDomain("loophole.site").ServeWebdav().
+		FromDirectory(t.TempDir()).
+		WithReadOnlyUsers([]string{"bob"}).
+		Build()
+	if err == nil {
+		t.Fatal("Read-only users were accepted without basic auth")
+	}
+}
@@ -2,27 +2,34 @@ package httpserver
 
 import (
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"time"
 
 	auth "github.com/abbot/go-http-auth"
 	lm "github.com/loophole/cli/internal/app/loophole/models"
+	"github.com/loophole/cli/internal/pkg/communication"
+	"github.com/loophole/cli/internal/pkg/healthcheck"
+	"github.com/loophole/cli/internal/pkg/sharelink"
 	"github.com/loophole/cli/internal/pkg/urlmaker"
 	"golang.org/x/crypto/bcrypt"
 	"golang.org/x/net/webdav"
 )
 
-const (
-	logoURL = "https://raw.githubusercontent.com/loophole/website/master/static/img/logo.png"
-)
-
 type ServerBuilder interface {
 	WithSiteID(string) ServerBuilder
 	WithDomain(string) ServerBuilder
 	DisableOldCiphers(bool) ServerBuilder
+	WithIPFilter(allowedCIDRs []string, deniedCIDRs []string, accessListFile string) ServerBuilder
+	WithOIDC(lm.OIDCSpecs) ServerBuilder
+	WithRateLimit(lm.RateLimitSpecs) ServerBuilder
+	WithTLS(lm.TLSSpecs) ServerBuilder
+	WithErrorTemplate(string) ServerBuilder
+	WithAccessLog(lm.AccessLogSpecs) ServerBuilder
 	Proxy() ProxyServerBuilder
 	ServeStatic() StaticServerBuilder
 	ServeWebdav() WebdavServerBuilder
@@ -32,6 +39,14 @@ type serverBuilder struct {
 	siteID            string
 	domain            string
 	disableOldCiphers bool
+	allowedCIDRs      []string
+	deniedCIDRs       []string
+	accessListFile    string
+	oidc              lm.OIDCSpecs
+	rateLimit         lm.RateLimitSpecs
+	tls               lm.TLSSpecs
+	errorTemplateFile string
+	accessLog         lm.AccessLogSpecs
 }
 
 func (sb *serverBuilder) WithSiteID(siteID string) ServerBuilder {
@@ -48,6 +63,38 @@ func (sb *serverBuilder) DisableOldCiphers(setting bool) ServerBuilder {
 	return sb
 }
 
+func (sb *serverBuilder) WithIPFilter(allowedCIDRs []string, deniedCIDRs []string, accessListFile string) ServerBuilder {
+	sb.allowedCIDRs = allowedCIDRs
+	sb.deniedCIDRs = deniedCIDRs
+	sb.accessListFile = accessListFile
+	return sb
+}
+
+func (sb *serverBuilder) WithOIDC(oidc lm.OIDCSpecs) ServerBuilder {
+	sb.oidc = oidc
+	return sb
+}
+
+func (sb *serverBuilder) WithRateLimit(rateLimit lm.RateLimitSpecs) ServerBuilder {
+	sb.rateLimit = rateLimit
+	return sb
+}
+
+func (sb *serverBuilder) WithTLS(tls lm.TLSSpecs) ServerBuilder {
+	sb.tls = tls
+	return sb
+}
+
+func (sb *serverBuilder) WithErrorTemplate(errorTemplateFile string) ServerBuilder {
+	sb.errorTemplateFile = errorTemplateFile
+	return sb
+}
+
+func (sb *serverBuilder) WithAccessLog(accessLog lm.AccessLogSpecs) ServerBuilder {
+	sb.accessLog = accessLog
+	return sb
+}
+
 func (sb *serverBuilder) Proxy() ProxyServerBuilder {
 	return &proxyServerBuilder{
 		serverBuilder: sb,
@@ -68,7 +115,16 @@ func (sb *serverBuilder) ServeWebdav() WebdavServerBuilder {
 // ProxyServerBuilder is used to proxy to already running server
 type ProxyServerBuilder interface {
 	ToEndpoint(lm.Endpoint) ProxyServerBuilder
+	WithRoutes([]lm.Route) ProxyServerBuilder
+	WithHostHeader(string) ProxyServerBuilder
+	WithRequestHeaders([]lm.HeaderRule) ProxyServerBuilder
+	WithResponseHeaders([]lm.HeaderRule) ProxyServerBuilder
 	WithBasicAuth(string, string) ProxyServerBuilder
+	WithHtpasswdFile(string) ProxyServerBuilder
+	WithFaults([]lm.FaultRule) ProxyServerBuilder
+	WithUpstreamProtocol(string) ProxyServerBuilder
+	WithUpstreams(upstreams []lm.Endpoint, policy string) ProxyServerBuilder
+	WithHealthChecks([]*healthcheck.Checker) ProxyServerBuilder
 	DisableProxyErrorPage() ProxyServerBuilder
 	EnableInsecureHTTPSBackend() ProxyServerBuilder
 	Build() (*http.Server, error)
@@ -76,9 +132,19 @@ type ProxyServerBuilder interface {
 type proxyServerBuilder struct {
 	serverBuilder         *serverBuilder
 	endpoint              lm.Endpoint
+	routes                []lm.Route
+	hostHeader            string
+	requestHeaders        []lm.HeaderRule
+	responseHeaders       []lm.HeaderRule
 	basicAuthEnabled      bool
 	basicAuthUsername     string
 	basicAuthPassword     string
+	htpasswdFile          string
+	faults                []lm.FaultRule
+	upstreamProtocol      string
+	upstreams             []lm.Endpoint
+	loadBalancing         string
+	healthChecks          []*healthcheck.Checker
 	disableProxyErrorPage bool
 	disableCertCheck      bool
 }
@@ -88,6 +154,26 @@ func (psb *proxyServerBuilder) ToEndpoint(endpoint lm.Endpoint) ProxyServerBuild
 	return psb
 }
 
+func (psb *proxyServerBuilder) WithRoutes(routes []lm.Route) ProxyServerBuilder {
+	psb.routes = routes
+	return psb
+}
+
+func (psb *proxyServerBuilder) WithHostHeader(hostHeader string) ProxyServerBuilder {
+	psb.hostHeader = hostHeader
+	return psb
+}
+
+func (psb *proxyServerBuilder) WithRequestHeaders(rules []lm.HeaderRule) ProxyServerBuilder {
+	psb.requestHeaders = rules
+	return psb
+}
+
+func (psb *proxyServerBuilder) WithResponseHeaders(rules []lm.HeaderRule) ProxyServerBuilder {
+	psb.responseHeaders = rules
+	return psb
+}
+
 func (psb *proxyServerBuilder) WithBasicAuth(username string, password string) ProxyServerBuilder {
 	psb.basicAuthEnabled = true
 	psb.basicAuthUsername = username
@@ -95,6 +181,33 @@ func (psb *proxyServerBuilder) WithBasicAuth(username string, password string) P
 	return psb
 }
 
+func (psb *proxyServerBuilder) WithHtpasswdFile(htpasswdFile string) ProxyServerBuilder {
+	psb.htpasswdFile = htpasswdFile
+	return psb
+}
+
+func (psb *proxyServerBuilder) WithFaults(faults []lm.FaultRule) ProxyServerBuilder {
+	psb.faults = faults
+	return psb
+}
+
+func (psb *proxyServerBuilder) WithUpstreamProtocol(protocol string) ProxyServerBuilder {
+	psb.upstreamProtocol = protocol
+	return psb
+}
+
+func (psb *proxyServerBuilder) WithUpstreams(upstreams []lm.Endpoint, policy string) ProxyServerBuilder {
+	psb.upstreams = upstreams
+	psb.loadBalancing = policy
+	return psb
+}
+
+// WithHealthChecks sets checkers of the endpoint followed by the upstreams, in the same order
+func (psb *proxyServerBuilder) WithHealthChecks(checkers []*healthcheck.Checker) ProxyServerBuilder {
+	psb.healthChecks = checkers
+	return psb
+}
+
 func (psb *proxyServerBuilder) DisableProxyErrorPage() ProxyServerBuilder {
 	psb.disableProxyErrorPage = true
 	return psb
@@ -106,12 +219,79 @@ func (psb *proxyServerBuilder) EnableInsecureHTTPSBackend() ProxyServerBuilder {
 }
 
 func (psb *proxyServerBuilder) Build() (*http.Server, error) {
+	proxy := psb.newRoutingProxy()
+
+	if len(psb.faults) > 0 {
+		proxy = newFaultInjector(psb.faults).Handler(proxy)
+	}
+
+	handler := proxy
+
+	if psb.basicAuthEnabled || psb.htpasswdFile != "" {
+		secrets, err := getBasicAuthSecrets(psb.basicAuthUsername, psb.basicAuthPassword, psb.htpasswdFile)
+		if err != nil {
+			return nil, err
+		}
+		handler = getBasicAuthHandler(psb.serverBuilder.siteID, psb.serverBuilder.domain, secrets, proxy.ServeHTTP)
+	}
+
+	return psb.serverBuilder.build(handler)
+}
+
+// newRoutingProxy proxies requests to the routes matching their path, or to the main endpoint;
+// upstream protocol applies only to the main endpoint and its replicas, routes are proxied over HTTP/1
+func (psb *proxyServerBuilder) newRoutingProxy() http.Handler {
+	if len(psb.routes) == 0 {
+		return psb.newEndpointProxy()
+	}
+	router := newPathRouter()
+	for _, route := range psb.routes {
+		stripPrefix := ""
+		if route.StripPrefix {
+			stripPrefix = route.Prefix
+		}
+		router.Handle(route.Prefix, psb.newReverseProxy(route.Endpoint, stripPrefix, route.InsecureSkipVerify, ""))
+	}
+	if !router.HasRoute("/") {
+		router.Handle("/", psb.newEndpointProxy())
+	}
+	return router
+}
+
+// newEndpointProxy proxies to the main endpoint, or balances across it and the upstreams,
+// showing maintenance page while health checks fail
+func (psb *proxyServerBuilder) newEndpointProxy() http.Handler {
+	if len(psb.upstreams) == 0 {
+		var proxy http.Handler = psb.newReverseProxy(psb.endpoint, "", psb.disableCertCheck, psb.upstreamProtocol)
+		if healthy := psb.healthCheckOf(0); healthy != nil {
+			proxy = maintenanceHandler(healthy, psb.disableProxyErrorPage, proxy)
+		}
+		return proxy
+	}
+
+	balancer := newLoadBalancer(psb.loadBalancing, psb.disableProxyErrorPage)
+	for index, endpoint := range append([]lm.Endpoint{psb.endpoint}, psb.upstreams...) {
+		balancer.Add(psb.newReverseProxy(endpoint, "", psb.disableCertCheck, psb.upstreamProtocol), psb.healthCheckOf(index))
+	}
+	return balancer
+}
+
+func (psb *proxyServerBuilder) healthCheckOf(index int) func() bool {
+	if index >= len(psb.healthChecks) || psb.healthChecks[index] == nil {
+		return nil
+	}
+	return psb.healthChecks[index].Healthy
+}
+
+// newReverseProxy proxies to the endpoint speaking given protocol (HTTP/1 when empty),
+// certificate of HTTPS endpoint is verified unless disableCertCheck is set
+func (psb *proxyServerBuilder) newReverseProxy(endpoint lm.Endpoint, stripPrefix string, disableCertCheck bool, protocol string) *httputil.ReverseProxy {
 	target := &url.URL{
-		Scheme: psb.endpoint.Protocol,
-		Host:   psb.endpoint.Hostname(),
+		Scheme: endpoint.Protocol,
+		Host:   endpoint.Hostname(),
 	}
-	if psb.endpoint.Path != "" {
-		target.Path = psb.endpoint.Path
+	if endpoint.Path != "" {
+		target.Path = endpoint.Path
 	}
 
 	proxy := httputil.NewSingleHostReverseProxy(target)
@@ -119,61 +299,75 @@ func (psb *proxyServerBuilder) Build() (*http.Server, error) {
 	defaultDirector := proxy.Director
 
 	proxy.Director = func(req *http.Request) {
+		if stripPrefix != "" {
+			stripPathPrefix(req.URL, stripPrefix)
+		}
 		defaultDirector(req)
 
-		addr := net.ParseIP(target.Host)
-		if addr == nil {
+		switch psb.hostHeader {
+		case "":
+			addr := net.ParseIP(target.Host)
+			if addr == nil {
+				req.Host = target.Host
+			}
+		case lm.HostHeaderRewrite:
 			req.Host = target.Host
+		case lm.HostHeaderPreserve:
+			// keep the public hostname requested by the client
+		default:
+			req.Host = psb.hostHeader
 		}
 
-		req.Header.Set("X-Forwarded-Host", urlmaker.GetSiteFQDN(psb.serverBuilder.siteID, psb.serverBuilder.domain))
+		siteFQDN := urlmaker.GetSiteFQDN(psb.serverBuilder.siteID, psb.serverBuilder.domain)
+		req.Header.Set("X-Forwarded-Host", siteFQDN)
 		req.Header.Set("X-Forwarded-Proto", "https")
-	}
+		// loophole is the first trusted hop, so values sent by the client are dropped;
+		// reverse proxy fills X-Forwarded-For with the client address reported by the gateway
+		req.Header.Del("X-Forwarded-For")
+		req.Header.Set("Forwarded", forwardedHeader(req.RemoteAddr, siteFQDN))
 
-	if !psb.disableProxyErrorPage {
-		proxy.ErrorHandler = proxyErrorHandler
+		applyHeaderRules(req.Header, psb.requestHeaders)
 	}
 
-	if psb.disableCertCheck {
-		proxy.Transport = &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	if len(psb.responseHeaders) > 0 {
+		proxy.ModifyResponse = func(res *http.Response) error {
+			applyHeaderRules(res.Header, psb.responseHeaders)
+			return nil
 		}
 	}
 
-	var server *http.Server
-
-	if psb.basicAuthEnabled {
-		proxyWithAuth, err := getBasicAuthHandler(psb.serverBuilder.siteID, psb.serverBuilder.domain, psb.basicAuthUsername, psb.basicAuthPassword, proxy.ServeHTTP)
-		if err != nil {
-			return nil, err
-		}
+	if !psb.disableProxyErrorPage {
+		proxy.ErrorHandler = proxyErrorHandler
+	}
 
-		server = &http.Server{
-			Handler:   proxyWithAuth,
-			TLSConfig: getTLSConfig(psb.serverBuilder.siteID, psb.serverBuilder.domain, psb.serverBuilder.disableOldCiphers),
-		}
-	} else {
-		server = &http.Server{
-			Handler:   proxy,
-			TLSConfig: getTLSConfig(psb.serverBuilder.siteID, psb.serverBuilder.domain, psb.serverBuilder.disableOldCiphers),
-		}
+	if transport := NewUpstreamTransport(endpoint, disableCertCheck, protocol); transport != nil {
+		proxy.Transport = transport
+	}
+	if isHTTP2Upstream(protocol) {
+		// gRPC and other streaming responses have to reach the client as soon as they are written
+		proxy.FlushInterval = -1
 	}
 
-	return server, nil
+	return proxy
 }
 
 // StaticServerBuilder is used to create server which expose local directory
 type StaticServerBuilder interface {
 	FromDirectory(string) StaticServerBuilder
 	WithBasicAuth(string, string) StaticServerBuilder
+	WithHtpasswdFile(string) StaticServerBuilder
+	WithShareLinks(key []byte, downloads *sharelink.Downloads) StaticServerBuilder
 	Build() (*http.Server, error)
 }
 type staticServerBuilder struct {
-	serverBuilder     *serverBuilder
-	directory         string
-	basicAuthEnabled  bool
-	basicAuthUsername string
-	basicAuthPassword string
+	serverBuilder      *serverBuilder
+	directory          string
+	basicAuthEnabled   bool
+	basicAuthUsername  string
+	basicAuthPassword  string
+	htpasswdFile       string
+	shareLinkKey       []byte
+	shareLinkDownloads *sharelink.Downloads
 }
 
 func (ssb *staticServerBuilder) FromDirectory(directory string) StaticServerBuilder {
@@ -188,43 +382,55 @@ func (ssb *staticServerBuilder) WithBasicAuth(username string, password string)
 	return ssb
 }
 
+func (ssb *staticServerBuilder) WithHtpasswdFile(htpasswdFile string) StaticServerBuilder {
+	ssb.htpasswdFile = htpasswdFile
+	return ssb
+}
+
+func (ssb *staticServerBuilder) WithShareLinks(key []byte, downloads *sharelink.Downloads) StaticServerBuilder {
+	ssb.shareLinkKey = key
+	ssb.shareLinkDownloads = downloads
+	return ssb
+}
+
 func (ssb *staticServerBuilder) Build() (*http.Server, error) {
 	fs := http.FileServer(http.Dir(ssb.directory))
 
-	var server *http.Server
+	handler := fs
 
-	if ssb.basicAuthEnabled {
-		handler, err := getBasicAuthHandler(ssb.serverBuilder.siteID, ssb.serverBuilder.domain, ssb.basicAuthUsername, ssb.basicAuthPassword, fs.ServeHTTP)
+	if ssb.basicAuthEnabled || ssb.htpasswdFile != "" {
+		secrets, err := getBasicAuthSecrets(ssb.basicAuthUsername, ssb.basicAuthPassword, ssb.htpasswdFile)
 		if err != nil {
 			return nil, err
 		}
-
-		server = &http.Server{
-			Handler:   handler,
-			TLSConfig: getTLSConfig(ssb.serverBuilder.siteID, ssb.serverBuilder.domain, ssb.serverBuilder.disableOldCiphers),
-		}
-	} else {
-		server = &http.Server{
-			Handler:   fs,
-			TLSConfig: getTLSConfig(ssb.serverBuilder.siteID, ssb.serverBuilder.domain, ssb.serverBuilder.disableOldCiphers),
-		}
+		handler = getBasicAuthHandler(ssb.serverBuilder.siteID, ssb.serverBuilder.domain, secrets, fs.ServeHTTP)
+	}
+	if ssb.shareLinkKey != nil {
+		handler = newShareLinkGate(ssb.shareLinkKey, ssb.shareLinkDownloads, ssb.directory).Handler(handler)
 	}
 
-	return server, nil
+	return ssb.serverBuilder.build(handler)
 }
 
 // WebdavServerBuilder is used to create server which expose local directory
 type WebdavServerBuilder interface {
 	FromDirectory(string) WebdavServerBuilder
 	WithBasicAuth(string, string) WebdavServerBuilder
+	WithHtpasswdFile(string) WebdavServerBuilder
+	WithShareLinks(key []byte, downloads *sharelink.Downloads) WebdavServerBuilder
+	WithReadOnlyUsers([]string) WebdavServerBuilder
 	Build() (*http.Server, error)
 }
 type webdavServerBuilder struct {
-	serverBuilder     *serverBuilder
-	directory         string
-	basicAuthEnabled  bool
-	basicAuthUsername string
-	basicAuthPassword string
+	serverBuilder      *serverBuilder
+	directory          string
+	basicAuthEnabled   bool
+	basicAuthUsername  string
+	basicAuthPassword  string
+	htpasswdFile       string
+	readOnlyUsers      []string
+	shareLinkKey       []byte
+	shareLinkDownloads *sharelink.Downloads
 }
 
 func (wsb *webdavServerBuilder) FromDirectory(directory string) WebdavServerBuilder {
@@ -239,6 +445,22 @@ func (wsb *webdavServerBuilder) WithBasicAuth(username string, password string)
 	return wsb
 }
 
+func (wsb *webdavServerBuilder) WithHtpasswdFile(htpasswdFile string) WebdavServerBuilder {
+	wsb.htpasswdFile = htpasswdFile
+	return wsb
+}
+
+func (wsb *webdavServerBuilder) WithReadOnlyUsers(users []string) WebdavServerBuilder {
+	wsb.readOnlyUsers = users
+	return wsb
+}
+
+func (wsb *webdavServerBuilder) WithShareLinks(key []byte, downloads *sharelink.Downloads) WebdavServerBuilder {
+	wsb.shareLinkKey = key
+	wsb.shareLinkDownloads = downloads
+	return wsb
+}
+
 func (wsb *webdavServerBuilder) Build() (*http.Server, error) {
 	wdHandler := &webdav.Handler{
 		Prefix:     "/",
@@ -246,26 +468,26 @@ func (wsb *webdavServerBuilder) Build() (*http.Server, error) {
 		LockSystem: webdav.NewMemLS(),
 	}
 
-	var server *http.Server
+	var handler http.Handler = wdHandler
+	if len(wsb.readOnlyUsers) > 0 {
+		if !wsb.basicAuthEnabled && wsb.htpasswdFile == "" {
+			return nil, errors.New("Read-only users require basic auth or htpasswd file")
+		}
+		handler = readOnlyUsersHandler(wsb.readOnlyUsers, handler)
+	}
 
-	if wsb.basicAuthEnabled {
-		handler, err := getBasicAuthHandler(wsb.serverBuilder.siteID, wsb.serverBuilder.domain, wsb.basicAuthUsername, wsb.basicAuthPassword, wdHandler.ServeHTTP)
+	if wsb.basicAuthEnabled || wsb.htpasswdFile != "" {
+		secrets, err := getBasicAuthSecrets(wsb.basicAuthUsername, wsb.basicAuthPassword, wsb.htpasswdFile)
 		if err != nil {
 			return nil, err
 		}
-
-		server = &http.Server{
-			Handler:   handler,
-			TLSConfig: getTLSConfig(wsb.serverBuilder.siteID, wsb.serverBuilder.domain, wsb.serverBuilder.disableOldCiphers),
-		}
-	} else {
-		server = &http.Server{
-			Handler:   wdHandler,
-			TLSConfig: getTLSConfig(wsb.serverBuilder.siteID, wsb.serverBuilder.domain, wsb.serverBuilder.disableOldCiphers),
-		}
+		handler = getBasicAuthHandler(wsb.serverBuilder.siteID, wsb.serverBuilder.domain, secrets, handler.ServeHTTP)
+	}
+	if wsb.shareLinkKey != nil {
+		handler = newShareLinkGate(wsb.shareLinkKey, wsb.shareLinkDownloads, wsb.directory).Handler(handler)
 	}
 
-	return server, nil
+	return wsb.serverBuilder.build(handler)
 }
 
 // New starts creation of new server
@@ -273,16 +495,91 @@ func New() ServerBuilder {
 	return &serverBuilder{}
 }
 
-func getBasicAuthHandler(siteID string, domain string, username string, password string, handler http.HandlerFunc) (http.HandlerFunc, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+// build applies settings common for all the server types to the handler
+// keepAliveTimeout closes client connections waiting for the next request, so that they don't stay open forever
+const keepAliveTimeout = 2 * time.Minute
+
+func (sb *serverBuilder) build(handler http.Handler) (*http.Server, error) {
+	if sb.oidc.Enabled() {
+		gate, err := newOIDCGate(sb.oidc, urlmaker.GetSiteURL("https", sb.siteID, sb.domain))
+		if err != nil {
+			return nil, err
+		}
+		handler = gate.Handler(handler)
+	}
+	if sb.tls.ClientCAFile != "" {
+		handler = newClientCertGate(sb.tls.ClientCertPaths).Handler(handler)
+	}
+	if sb.rateLimit.Enabled() {
+		handler = newRateLimiter(sb.siteID, sb.rateLimit).Handler(handler)
+	}
+	if len(sb.allowedCIDRs) > 0 || len(sb.deniedCIDRs) > 0 || sb.accessListFile != "" {
+		filter, err := newIPFilter(sb.allowedCIDRs, sb.deniedCIDRs, sb.accessListFile)
+		if err != nil {
+			return nil, err
+		}
+		handler = filter.Handler(handler)
+	}
+	if sb.tls.HSTSMaxAge > 0 {
+		handler = hstsHandler(sb.tls.HSTSMaxAge, handler)
+	}
+	errorPages, err := newErrorPages(sb.errorTemplateFile)
 	if err != nil {
 		return nil, err
 	}
+	handler = errorPages.Handler(handler)
+	if sb.accessLog.Enabled() {
+		accessLog, err := newAccessLog(sb.accessLog)
+		if err != nil {
+			return nil, err
+		}
+		handler = accessLog.Handler(handler)
+	}
+	handler = requestIDHandler(handler)
+
+	tlsConfig, err := getTLSConfig(tlsOptions{
+		siteID:            sb.siteID,
+		domain:            sb.domain,
+		disableOldCiphers: sb.disableOldCiphers,
+		certificate:       sb.tls,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	server := &http.Server{
+		Handler:     handler,
+		TLSConfig:   tlsConfig,
+		IdleTimeout: keepAliveTimeout,
+	}
+	if sb.tls.DisableHTTP2 {
+		// non-nil map stops the server from configuring HTTP/2 on its own
+		server.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+	}
+	return server, nil
+}
 
-	secret := getBasicAuthSecretParser(username, string(hashedPassword))
+func getBasicAuthHandler(siteID string, domain string, secrets auth.SecretProvider, handler http.HandlerFunc) http.HandlerFunc {
+	authenticator := auth.NewBasicAuthenticator(urlmaker.GetSiteFQDN(siteID, domain), secrets)
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := authenticator.CheckAuth(r)
+		if user == "" {
+			if username, _, ok := r.BasicAuth(); ok {
+				communication.Debug(fmt.Sprintf("Rejected credentials of user '%s' for %s %s", username, r.Method, r.URL.Path))
+			}
+			authenticator.RequireAuth(w, r)
+			return
+		}
+		handler(w, withUser(r, user))
+	}
+}
 
-	authenticator := auth.NewBasicAuthenticator(urlmaker.GetSiteFQDN(siteID, domain), secret)
-	return auth.JustCheck(authenticator, handler), nil
+func bcryptHash(password string) (string, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashedPassword), nil
 }
 
 func getBasicAuthSecretParser(username string, hashedPassword string) auth.SecretProvider {
@@ -294,6 +591,21 @@ func getBasicAuthSecretParser(username string, hashedPassword string) auth.Secre
 	}
 }
 
-func proxyErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
-	w.Write([]byte(fmt.Sprintf(proxyErrorTemplate, logoURL, err.Error())))
+// readOnlyUsersHandler rejects WebDav requests modifying files when they're made by read-only users
+func readOnlyUsersHandler(readOnlyUsers []string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, "PROPFIND":
+			handler.ServeHTTP(w, r)
+			return
+		}
+		user := userFromRequest(r)
+		for _, readOnlyUser := range readOnlyUsers {
+			if user == readOnlyUser {
+				http.Error(w, fmt.Sprintf("User '%s' has read-only access", user), http.StatusForbidden)
+				return
+			}
+		}
+		handler.ServeHTTP(w, r)
+	})
 }
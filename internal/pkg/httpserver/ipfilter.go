@@ -0,0 +1,185 @@
+package httpserver
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/loophole/cli/internal/pkg/communication"
+)
+
+type accessList struct {
+	allowed []*net.IPNet
+	denied  []*net.IPNet
+}
+
+// ipFilter decides whether client can access the site based on CIDR allow and deny lists,
+// entries from access list file are reloaded whenever the file changes
+type ipFilter struct {
+	static accessList
+
+	file     *reloadableFile
+	fileList accessList
+	mutex    sync.RWMutex
+}
+
+func newIPFilter(allowedCIDRs []string, deniedCIDRs []string, accessListFile string) (*ipFilter, error) {
+	allowed, err := parseCIDRs(allowedCIDRs)
+	if err != nil {
+		return nil, err
+	}
+	denied, err := parseCIDRs(deniedCIDRs)
+	if err != nil {
+		return nil, err
+	}
+	filter := &ipFilter{
+		static: accessList{
+			allowed: allowed,
+			denied:  denied,
+		},
+	}
+	if accessListFile != "" {
+		filter.file, err = newReloadableFile(accessListFile, filter.loadAccessListFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return filter, nil
+}
+
+// Handler rejects requests from clients not permitted by the filter with 403
+func (f *ipFilter) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !f.Allowed(clientIP(r)) {
+			writeForbiddenPage(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Allowed checks the ip against deny list first, then against allow list if it's not empty
+func (f *ipFilter) Allowed(ip net.IP) bool {
+	if f.file != nil {
+		reloaded, err := f.file.reloadIfChanged()
+		if err != nil {
+			communication.Warn(fmt.Sprintf("Failed to reload access list from '%s', keeping previous version: %s", f.file.path, err.Error()))
+		} else if reloaded {
+			communication.Info(fmt.Sprintf("Access list reloaded from '%s'", f.file.path))
+		}
+	}
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	if ip == nil {
+		return len(f.static.allowed) == 0 && len(f.fileList.allowed) == 0
+	}
+	if containsIP(f.static.denied, ip) || containsIP(f.fileList.denied, ip) {
+		return false
+	}
+	if len(f.static.allowed) == 0 && len(f.fileList.allowed) == 0 {
+		return true
+	}
+	return containsIP(f.static.allowed, ip) || containsIP(f.fileList.allowed, ip)
+}
+
+func (f *ipFilter) loadAccessListFile(path string) error {
+	list, err := readAccessListFile(path)
+	if err != nil {
+		return err
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.fileList = list
+	return nil
+}
+
+// readAccessListFile reads file with 'allow <cidr>' and 'deny <cidr>' lines, lines starting with '#' are ignored
+func readAccessListFile(fileName string) (accessList, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return accessList{}, err
+	}
+	defer file.Close()
+
+	list := accessList{}
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return accessList{}, fmt.Errorf("line %d: expected '<allow|deny> <cidr>'", lineNumber)
+		}
+		network, err := parseCIDR(fields[1])
+		if err != nil {
+			return accessList{}, fmt.Errorf("line %d: %v", lineNumber, err)
+		}
+		switch fields[0] {
+		case "allow":
+			list.allowed = append(list.allowed, network)
+		case "deny":
+			list.denied = append(list.denied, network)
+		default:
+			return accessList{}, fmt.Errorf("line %d: unknown rule '%s'", lineNumber, fields[0])
+		}
+	}
+	return list, scanner.Err()
+}
+
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	networks := []*net.IPNet{}
+	for _, cidr := range cidrs {
+		network, err := parseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// parseCIDR accepts CIDR notation or single IP address
+func parseCIDR(cidr string) (*net.IPNet, error) {
+	if !strings.Contains(cidr, "/") {
+		ip := net.ParseIP(cidr)
+		if ip == nil {
+			return nil, fmt.Errorf("Invalid IP address '%s'", cidr)
+		}
+		if ip.To4() != nil {
+			return &net.IPNet{IP: ip.To4(), Mask: net.CIDRMask(32, 32)}, nil
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+	}
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid CIDR '%s'", cidr)
+	}
+	return network, nil
+}
+
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns address of the client, as reported by the gateway
+func clientIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
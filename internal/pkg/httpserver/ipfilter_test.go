@@ -0,0 +1,98 @@
+package httpserver
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestIPFilterDenyListWinsOverAllowList(t *testing.T) {
+	filter, err := newIPFilter([]string{"10.0.0.0/8"}, []string{"10.0.0.13"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]bool{
+		"10.1.2.3":    true,
+		"10.0.0.13":   false,
+		"192.168.1.1": false,
+	}
+	for ip, expected := range cases {
+		if result := filter.Allowed(net.ParseIP(ip)); result != expected {
+			t.Fatalf("Address '%s' allowed: %t, expected: %t", ip, result, expected)
+		}
+	}
+}
+
+func TestIPFilterAllowsEveryoneWithOnlyDenyList(t *testing.T) {
+	filter, err := newIPFilter(nil, []string{"2001:db8::/32"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !filter.Allowed(net.ParseIP("198.51.100.1")) {
+		t.Fatalf("Address outside of deny list should be allowed")
+	}
+	if filter.Allowed(net.ParseIP("2001:db8::1")) {
+		t.Fatalf("Address from deny list should not be allowed")
+	}
+}
+
+func TestIPFilterRejectsInvalidCIDR(t *testing.T) {
+	_, err := newIPFilter([]string{"10.0.0.0/33"}, nil, "")
+	if err == nil {
+		t.Fatalf("Expected error for invalid CIDR")
+	}
+}
+
+func TestIPFilterReloadsAccessListFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ipfilter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	listFile := filepath.Join(dir, "access-list")
+	if err := ioutil.WriteFile(listFile, []byte("# office\nallow 203.0.113.0/24\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	filter, err := newIPFilter(nil, nil, listFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !filter.Allowed(net.ParseIP("203.0.113.10")) {
+		t.Fatalf("Address from access list file should be allowed")
+	}
+
+	if err := ioutil.WriteFile(listFile, []byte("deny 203.0.113.10\nallow 203.0.113.0/24\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Now().Add(time.Minute)
+	os.Chtimes(listFile, modTime, modTime)
+	filter.file.lastChecked = time.Time{}
+
+	if filter.Allowed(net.ParseIP("203.0.113.10")) {
+		t.Fatalf("Address denied in reloaded access list file should not be allowed")
+	}
+}
+
+func TestIPFilterHandlerRespondsWithForbidden(t *testing.T) {
+	filter, err := newIPFilter([]string{"10.0.0.0/8"}, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := filter.Handler(namedHandler("site"))
+
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.RemoteAddr = "192.0.2.1:4321"
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+
+	if recorder.Code != http.StatusForbidden {
+		t.Fatalf("Status code %d is different than expected: %d", recorder.Code, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,111 @@
+package httpserver
+
+import (
+	"net/http"
+	"strconv"
+	"sync/atomic"
+
+	lm "github.com/loophole/cli/internal/app/loophole/models"
+)
+
+const upstreamCookieName = "loophole_upstream"
+
+type upstream struct {
+	handler http.Handler
+	healthy func() bool
+	active  int64
+}
+
+// loadBalancer spreads requests across healthy upstreams, showing maintenance page when all of them are down
+type loadBalancer struct {
+	upstreams []*upstream
+	policy    string
+	plain     bool
+	next      uint64
+}
+
+func newLoadBalancer(policy string, plain bool) *loadBalancer {
+	if policy == "" {
+		policy = lm.LoadBalancingRoundRobin
+	}
+	return &loadBalancer{
+		policy: policy,
+		plain:  plain,
+	}
+}
+
+// Add registers upstream, healthy can be nil when upstream isn't health checked
+func (lb *loadBalancer) Add(handler http.Handler, healthy func() bool) {
+	if healthy == nil {
+		healthy = func() bool { return true }
+	}
+	lb.upstreams = append(lb.upstreams, &upstream{
+		handler: handler,
+		healthy: healthy,
+	})
+}
+
+// pick returns index of the upstream to handle the request, -1 when none is healthy
+func (lb *loadBalancer) pick(r *http.Request) int {
+	switch lb.policy {
+	case lm.LoadBalancingLeastConnections:
+		return lb.pickLeastConnections()
+	case lm.LoadBalancingStickyCookie:
+		if cookie, err := r.Cookie(upstreamCookieName); err == nil {
+			if index, err := strconv.Atoi(cookie.Value); err == nil && index >= 0 && index < len(lb.upstreams) && lb.upstreams[index].healthy() {
+				return index
+			}
+		}
+	}
+	return lb.pickRoundRobin()
+}
+
+func (lb *loadBalancer) pickRoundRobin() int {
+	start := int(atomic.AddUint64(&lb.next, 1) - 1)
+	for i := 0; i < len(lb.upstreams); i++ {
+		index := (start + i) % len(lb.upstreams)
+		if lb.upstreams[index].healthy() {
+			return index
+		}
+	}
+	return -1
+}
+
+func (lb *loadBalancer) pickLeastConnections() int {
+	picked := -1
+	var pickedActive int64
+	for index, upstream := range lb.upstreams {
+		if !upstream.healthy() {
+			continue
+		}
+		active := atomic.LoadInt64(&upstream.active)
+		if picked == -1 || active < pickedActive {
+			picked = index
+			pickedActive = active
+		}
+	}
+	return picked
+}
+
+func (lb *loadBalancer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	index := lb.pick(r)
+	if index == -1 {
+		writeMaintenancePage(w, r, lb.plain)
+		return
+	}
+	if lb.policy == lm.LoadBalancingStickyCookie {
+		http.SetCookie(w, &http.Cookie{
+			Name:     upstreamCookieName,
+			Value:    strconv.Itoa(index),
+			Path:     "/",
+			Secure:   true,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+
+	upstream := lb.upstreams[index]
+	atomic.AddInt64(&upstream.active, 1)
+	defer atomic.AddInt64(&upstream.active, -1)
+	upstream.handler.ServeHTTP(w, r)
+}
@@ -0,0 +1,85 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	lm "github.com/loophole/cli/internal/app/loophole/models"
+)
+
+func serve(handler http.Handler, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, cookie := range cookies {
+		request.AddCookie(cookie)
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestRoundRobinSkipsUnhealthyUpstreams(t *testing.T) {
+	healthy := map[string]bool{"a": true, "b": true, "c": true}
+	balancer := newLoadBalancer(lm.LoadBalancingRoundRobin, false)
+	for _, name := range []string{"a", "b", "c"} {
+		name := name
+		balancer.Add(namedHandler(name), func() bool { return healthy[name] })
+	}
+
+	responses := ""
+	for i := 0; i < 3; i++ {
+		responses += serve(balancer).Body.String()
+	}
+	if responses != "abc" {
+		t.Fatalf("Requests were balanced as '%s' instead of 'abc'", responses)
+	}
+
+	healthy["b"] = false
+	responses = ""
+	for i := 0; i < 4; i++ {
+		responses += serve(balancer).Body.String()
+	}
+	if responses != "acca" {
+		t.Fatalf("Requests were balanced as '%s' instead of 'acca' with unhealthy upstream", responses)
+	}
+
+	healthy["a"], healthy["c"] = false, false
+	if recorder := serve(balancer); recorder.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Status code %d is different than expected when all upstreams are down: %d", recorder.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestLeastConnectionsPicksIdleUpstream(t *testing.T) {
+	balancer := newLoadBalancer(lm.LoadBalancingLeastConnections, false)
+	balancer.Add(namedHandler("a"), nil)
+	balancer.Add(namedHandler("b"), nil)
+	balancer.upstreams[0].active = 2
+
+	if body := serve(balancer).Body.String(); body != "b" {
+		t.Fatalf("Request was sent to '%s' instead of idle upstream 'b'", body)
+	}
+}
+
+func TestStickyCookieKeepsClientOnUpstream(t *testing.T) {
+	healthy := true
+	balancer := newLoadBalancer(lm.LoadBalancingStickyCookie, false)
+	balancer.Add(namedHandler("a"), nil)
+	balancer.Add(namedHandler("b"), func() bool { return healthy })
+	balancer.next = 1
+
+	first := serve(balancer)
+	cookies := first.Result().Cookies()
+	if first.Body.String() != "b" || len(cookies) != 1 {
+		t.Fatalf("First request was sent to '%s' with %d cookies", first.Body.String(), len(cookies))
+	}
+	for i := 0; i < 3; i++ {
+		if body := serve(balancer, cookies[0]).Body.String(); body != "b" {
+			t.Fatalf("Request with sticky cookie was sent to '%s' instead of 'b'", body)
+		}
+	}
+
+	healthy = false
+	if body := serve(balancer, cookies[0]).Body.String(); body != "a" {
+		t.Fatalf("Request with sticky cookie of unhealthy upstream was sent to '%s' instead of 'a'", body)
+	}
+}
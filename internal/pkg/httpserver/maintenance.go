@@ -0,0 +1,19 @@
+package httpserver
+
+import (
+	"net/http"
+)
+
+// maintenanceRetryAfter is the number of seconds clients are asked to wait before retrying
+const maintenanceRetryAfter = "10"
+
+// maintenanceHandler responds with maintenance page instead of proxying while the upstream is down
+func maintenanceHandler(healthy func() bool, plain bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if healthy() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		writeMaintenancePage(w, r, plain)
+	})
+}
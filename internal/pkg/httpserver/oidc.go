@@ -0,0 +1,530 @@
+package httpserver
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	lm "github.com/loophole/cli/internal/app/loophole/models"
+)
+
+const (
+	// OIDCCallbackPath is the path OIDC provider redirects to after login,
+	// https://<site>/.loophole/oidc/callback has to be registered as redirect URL with the provider
+	OIDCCallbackPath = "/.loophole/oidc/callback"
+	// OIDCLogoutPath is the path which removes the session cookie
+	OIDCLogoutPath = "/.loophole/oidc/logout"
+
+	oidcSessionCookieName = "loophole_session"
+	oidcStateCookieName   = "loophole_oidc_state"
+	oidcSessionDuration   = 12 * time.Hour
+	oidcStateDuration     = 10 * time.Minute
+	oidcClockSkew         = time.Minute
+)
+
+type oidcProviderMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type oidcState struct {
+	State     string `json:"state"`
+	Nonce     string `json:"nonce"`
+	ReturnTo  string `json:"returnTo"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+type oidcSession struct {
+	Email     string `json:"email"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+type idTokenClaims struct {
+	Issuer        string          `json:"iss"`
+	Audience      json.RawMessage `json:"aud"`
+	ExpiresAt     int64           `json:"exp"`
+	IssuedAt      int64           `json:"iat"`
+	Nonce         string          `json:"nonce"`
+	Email         string          `json:"email"`
+	EmailVerified *bool           `json:"email_verified"`
+}
+
+// oidcGate lets through only visitors who logged in with OpenID Connect provider
+// using one of allowed email addresses or domains
+type oidcGate struct {
+	config      lm.OIDCSpecs
+	redirectURL string
+	metadata    oidcProviderMetadata
+	httpClient  *http.Client
+	cookieKey   []byte
+
+	keysMutex sync.Mutex
+	keys      map[string]crypto.PublicKey
+}
+
+func newOIDCGate(config lm.OIDCSpecs, siteURL string) (*oidcGate, error) {
+	if config.ClientID == "" {
+		return nil, errors.New("OIDC client ID has to be provided")
+	}
+	if len(config.AllowedEmails) == 0 && len(config.AllowedDomains) == 0 {
+		return nil, errors.New("At least one allowed email address or domain has to be provided for OIDC")
+	}
+	cookieKey := make([]byte, 32)
+	if _, err := rand.Read(cookieKey); err != nil {
+		return nil, err
+	}
+	gate := &oidcGate{
+		config:      config,
+		redirectURL: strings.TrimSuffix(siteURL, "/") + OIDCCallbackPath,
+		httpClient:  &http.Client{Timeout: 30 * time.Second},
+		cookieKey:   cookieKey,
+		keys:        map[string]crypto.PublicKey{},
+	}
+	if err := gate.discover(); err != nil {
+		return nil, fmt.Errorf("OIDC discovery failed: %v", err)
+	}
+	return gate, nil
+}
+
+func (g *oidcGate) discover() error {
+	discoveryURL := strings.TrimSuffix(g.config.IssuerURL, "/") + "/.well-known/openid-configuration"
+	res, err := g.httpClient.Get(discoveryURL)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned status code %d", discoveryURL, res.StatusCode)
+	}
+	if err := json.NewDecoder(res.Body).Decode(&g.metadata); err != nil {
+		return err
+	}
+	if g.metadata.Issuer != strings.TrimSuffix(g.config.IssuerURL, "/") && g.metadata.Issuer != g.config.IssuerURL {
+		return fmt.Errorf("issuer '%s' doesn't match configured issuer '%s'", g.metadata.Issuer, g.config.IssuerURL)
+	}
+	if g.metadata.AuthorizationEndpoint == "" || g.metadata.TokenEndpoint == "" || g.metadata.JWKSURI == "" {
+		return errors.New("provider metadata is incomplete")
+	}
+	return nil
+}
+
+// Handler puts the gate in front of the handler
+func (g *oidcGate) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case OIDCCallbackPath:
+			g.handleCallback(w, r)
+			return
+		case OIDCLogoutPath:
+			http.SetCookie(w, g.expiredCookie(oidcSessionCookieName))
+			w.Write([]byte("Logged out"))
+			return
+		}
+
+		var session oidcSession
+		if cookie, err := r.Cookie(oidcSessionCookieName); err == nil && g.verify(cookie.Value, &session) == nil {
+			if time.Now().Unix() < session.ExpiresAt && g.emailAllowed(session.Email) {
+				next.ServeHTTP(w, withUser(r, session.Email))
+				return
+			}
+		}
+		g.startLogin(w, r)
+	})
+}
+
+func (g *oidcGate) startLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+	state := oidcState{
+		State:     randomToken(),
+		Nonce:     randomToken(),
+		ReturnTo:  r.URL.RequestURI(),
+		ExpiresAt: time.Now().Add(oidcStateDuration).Unix(),
+	}
+	signedState, err := g.sign(state)
+	if err != nil {
+		http.Error(w, "Failed to start authentication", http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookieName,
+		Value:    signedState,
+		Path:     OIDCCallbackPath,
+		Expires:  time.Unix(state.ExpiresAt, 0),
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	authorizationURL, err := url.Parse(g.metadata.AuthorizationEndpoint)
+	if err != nil {
+		http.Error(w, "Failed to start authentication", http.StatusInternalServerError)
+		return
+	}
+	query := authorizationURL.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", g.config.ClientID)
+	query.Set("redirect_uri", g.redirectURL)
+	query.Set("scope", "openid email")
+	query.Set("state", state.State)
+	query.Set("nonce", state.Nonce)
+	authorizationURL.RawQuery = query.Encode()
+
+	http.Redirect(w, r, authorizationURL.String(), http.StatusFound)
+}
+
+func (g *oidcGate) handleCallback(w http.ResponseWriter, r *http.Request) {
+	var state oidcState
+	cookie, err := r.Cookie(oidcStateCookieName)
+	if err != nil || g.verify(cookie.Value, &state) != nil || time.Now().Unix() > state.ExpiresAt {
+		http.Error(w, "Authentication session expired, please try again", http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, g.expiredCookie(oidcStateCookieName))
+
+	query := r.URL.Query()
+	if subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(state.State)) != 1 {
+		http.Error(w, "Invalid authentication state", http.StatusBadRequest)
+		return
+	}
+	if query.Get("error") != "" {
+		http.Error(w, fmt.Sprintf("Authentication failed: %s", query.Get("error")), http.StatusUnauthorized)
+		return
+	}
+
+	claims, err := g.exchangeCode(query.Get("code"), state.Nonce)
+	if err != nil {
+		http.Error(w, "Authentication failed", http.StatusUnauthorized)
+		return
+	}
+	if !g.emailAllowed(claims.Email) {
+		writeForbiddenPage(w, r)
+		return
+	}
+
+	session := oidcSession{
+		Email:     claims.Email,
+		ExpiresAt: time.Now().Add(oidcSessionDuration).Unix(),
+	}
+	signedSession, err := g.sign(session)
+	if err != nil {
+		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcSessionCookieName,
+		Value:    signedSession,
+		Path:     "/",
+		Expires:  time.Unix(session.ExpiresAt, 0),
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	returnTo := state.ReturnTo
+	if !strings.HasPrefix(returnTo, "/") || strings.HasPrefix(returnTo, "//") {
+		returnTo = "/"
+	}
+	http.Redirect(w, r, returnTo, http.StatusFound)
+}
+
+func (g *oidcGate) exchangeCode(code string, nonce string) (*idTokenClaims, error) {
+	if code == "" {
+		return nil, errors.New("authorization code is missing")
+	}
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", g.redirectURL)
+
+	req, err := http.NewRequest(http.MethodPost, g.metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(g.config.ClientID), url.QueryEscape(g.config.ClientSecret))
+
+	res, err := g.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint returned status code %d", res.StatusCode)
+	}
+	var tokenResponse struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &tokenResponse); err != nil {
+		return nil, err
+	}
+	return g.verifyIDToken(tokenResponse.IDToken, nonce)
+}
+
+func (g *oidcGate) verifyIDToken(idToken string, nonce string) (*idTokenClaims, error) {
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed ID token")
+	}
+	var header struct {
+		Algorithm string `json:"alg"`
+		KeyID     string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, err
+	}
+	key, err := g.publicKey(header.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyJWTSignature(header.Algorithm, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var claims idTokenClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	switch {
+	case claims.Issuer != g.metadata.Issuer:
+		return nil, errors.New("ID token issuer mismatch")
+	case !audienceContains(claims.Audience, g.config.ClientID):
+		return nil, errors.New("ID token audience mismatch")
+	case now.After(time.Unix(claims.ExpiresAt, 0).Add(oidcClockSkew)):
+		return nil, errors.New("ID token expired")
+	case subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1:
+		return nil, errors.New("ID token nonce mismatch")
+	case claims.Email == "":
+		return nil, errors.New("ID token doesn't contain email")
+	case claims.EmailVerified != nil && !*claims.EmailVerified:
+		return nil, errors.New("email address is not verified")
+	}
+	return &claims, nil
+}
+
+// publicKey returns signing key with given ID, refreshing provider keys if it's unknown
+func (g *oidcGate) publicKey(keyID string) (crypto.PublicKey, error) {
+	g.keysMutex.Lock()
+	defer g.keysMutex.Unlock()
+
+	if key, ok := g.keys[keyID]; ok {
+		return key, nil
+	}
+	keys, err := fetchJWKS(g.httpClient, g.metadata.JWKSURI)
+	if err != nil {
+		return nil, err
+	}
+	g.keys = keys
+	if key, ok := g.keys[keyID]; ok {
+		return key, nil
+	}
+	if len(g.keys) == 1 && keyID == "" {
+		for _, key := range g.keys {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("signing key '%s' not found", keyID)
+}
+
+func (g *oidcGate) emailAllowed(email string) bool {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return false
+	}
+	for _, allowedEmail := range g.config.AllowedEmails {
+		if strings.ToLower(allowedEmail) == email {
+			return true
+		}
+	}
+	for _, allowedDomain := range g.config.AllowedDomains {
+		if strings.HasSuffix(email, "@"+strings.ToLower(strings.TrimPrefix(allowedDomain, "@"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// sign serializes value and signs it with HMAC, producing '<payload>.<signature>' string
+func (g *oidcGate) sign(value interface{}) (string, error) {
+	payload, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	encodedPayload := base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, g.cookieKey)
+	mac.Write([]byte(encodedPayload))
+	return encodedPayload + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+func (g *oidcGate) verify(signedValue string, value interface{}) error {
+	parts := strings.Split(signedValue, ".")
+	if len(parts) != 2 {
+		return errors.New("malformed signed value")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return err
+	}
+	mac := hmac.New(sha256.New, g.cookieKey)
+	mac.Write([]byte(parts[0]))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return errors.New("invalid signature")
+	}
+	return decodeSegment(parts[0], value)
+}
+
+func (g *oidcGate) expiredCookie(name string) *http.Cookie {
+	path := "/"
+	if name == oidcStateCookieName {
+		path = OIDCCallbackPath
+	}
+	return &http.Cookie{
+		Name:     name,
+		Value:    "",
+		Path:     path,
+		MaxAge:   -1,
+		Secure:   true,
+		HttpOnly: true,
+	}
+}
+
+func fetchJWKS(client *http.Client, jwksURI string) (map[string]crypto.PublicKey, error) {
+	res, err := client.Get(jwksURI)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned status code %d", jwksURI, res.StatusCode)
+	}
+	var jwks struct {
+		Keys []struct {
+			KeyType string `json:"kty"`
+			KeyID   string `json:"kid"`
+			N       string `json:"n"`
+			E       string `json:"e"`
+			Curve   string `json:"crv"`
+			X       string `json:"x"`
+			Y       string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&jwks); err != nil {
+		return nil, err
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, jwk := range jwks.Keys {
+		switch jwk.KeyType {
+		case "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(jwk.N)
+			e, errE := base64.RawURLEncoding.DecodeString(jwk.E)
+			if errN != nil || errE != nil {
+				continue
+			}
+			keys[jwk.KeyID] = &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(new(big.Int).SetBytes(e).Int64()),
+			}
+		case "EC":
+			if jwk.Curve != "P-256" {
+				continue
+			}
+			x, errX := base64.RawURLEncoding.DecodeString(jwk.X)
+			y, errY := base64.RawURLEncoding.DecodeString(jwk.Y)
+			if errX != nil || errY != nil {
+				continue
+			}
+			keys[jwk.KeyID] = &ecdsa.PublicKey{
+				Curve: elliptic.P256(),
+				X:     new(big.Int).SetBytes(x),
+				Y:     new(big.Int).SetBytes(y),
+			}
+		}
+	}
+	return keys, nil
+}
+
+func verifyJWTSignature(algorithm string, key crypto.PublicKey, signedContent string, signature []byte) error {
+	digest := sha256.Sum256([]byte(signedContent))
+	switch algorithm {
+	case "RS256":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return errors.New("key type doesn't match RS256 algorithm")
+		}
+		return rsa.VerifyPKCS1v15(rsaKey, crypto.SHA256, digest[:], signature)
+	case "ES256":
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(signature) != 64 {
+			return errors.New("key type doesn't match ES256 algorithm")
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(ecKey, digest[:], r, s) {
+			return errors.New("invalid ES256 signature")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported signing algorithm '%s'", algorithm)
+	}
+}
+
+// audienceContains handles both single string and array forms of 'aud' claim
+func audienceContains(audience json.RawMessage, clientID string) bool {
+	var single string
+	if err := json.Unmarshal(audience, &single); err == nil {
+		return single == clientID
+	}
+	var multiple []string
+	if err := json.Unmarshal(audience, &multiple); err == nil {
+		for _, aud := range multiple {
+			if aud == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func decodeSegment(segment string, value interface{}) error {
+	decoded, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(decoded, value)
+}
+
+func randomToken() string {
+	token := make([]byte, 24)
+	rand.Read(token)
+	return base64.RawURLEncoding.EncodeToString(token)
+}
@@ -0,0 +1,206 @@
+package httpserver
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	lm "github.com/loophole/cli/internal/app/loophole/models"
+)
+
+// oidcProviderMock is a stand-in OIDC provider, issuing ID token for configured email with the last seen nonce
+type oidcProviderMock struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	email  string
+	nonce  string
+}
+
+func newOIDCProviderMock(t *testing.T, email string) *oidcProviderMock {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := &oidcProviderMock{key: key, email: email}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 provider.server.URL,
+			"authorization_endpoint": provider.server.URL + "/authorize",
+			"token_endpoint":         provider.server.URL + "/token",
+			"jwks_uri":               provider.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test-key",
+				"n":   base64.RawURLEncoding.EncodeToString(key.PublicKey.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.PublicKey.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		clientID, clientSecret, ok := r.BasicAuth()
+		if !ok || clientID != "client-id" || clientSecret != "client-secret" || r.FormValue("code") != "valid-code" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"id_token": provider.idToken(t),
+		})
+	})
+	provider.server = httptest.NewServer(mux)
+	return provider
+}
+
+func (p *oidcProviderMock) idToken(t *testing.T) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test-key"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":            p.server.URL,
+		"aud":            "client-id",
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          p.nonce,
+		"email":          p.email,
+		"email_verified": true,
+	})
+	signedContent := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signedContent))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signedContent + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// login goes through the whole authorization code flow and returns the callback response
+func login(t *testing.T, provider *oidcProviderMock, handler http.Handler, path string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+	if recorder.Code != http.StatusFound {
+		t.Fatalf("Status code %d is different than expected: %d", recorder.Code, http.StatusFound)
+	}
+	authorizationURL, err := url.Parse(recorder.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if authorizationURL.Path != "/authorize" || authorizationURL.Query().Get("redirect_uri") != "https://site.loophole.site"+OIDCCallbackPath {
+		t.Fatalf("Unexpected authorization URL: %s", authorizationURL.String())
+	}
+	provider.nonce = authorizationURL.Query().Get("nonce")
+
+	callbackRequest := httptest.NewRequest(http.MethodGet,
+		fmt.Sprintf("%s?code=valid-code&state=%s", OIDCCallbackPath, url.QueryEscape(authorizationURL.Query().Get("state"))), nil)
+	for _, cookie := range recorder.Result().Cookies() {
+		callbackRequest.AddCookie(cookie)
+	}
+	callbackRecorder := httptest.NewRecorder()
+	handler.ServeHTTP(callbackRecorder, callbackRequest)
+	return callbackRecorder
+}
+
+func TestOIDCGateLetsAllowedUserThrough(t *testing.T) {
+	provider := newOIDCProviderMock(t, "alice@example.com")
+	defer provider.server.Close()
+
+	gate, err := newOIDCGate(lm.OIDCSpecs{
+		IssuerURL:      provider.server.URL,
+		ClientID:       "client-id",
+		ClientSecret:   "client-secret",
+		AllowedDomains: []string{"example.com"},
+	}, "https://site.loophole.site")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := gate.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(userFromRequest(r)))
+	}))
+
+	callbackRecorder := login(t, provider, handler, "/dashboard?tab=1")
+	if callbackRecorder.Code != http.StatusFound || callbackRecorder.Header().Get("Location") != "/dashboard?tab=1" {
+		t.Fatalf("Callback should redirect to original location, got %d to '%s'", callbackRecorder.Code, callbackRecorder.Header().Get("Location"))
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/dashboard?tab=1", nil)
+	for _, cookie := range callbackRecorder.Result().Cookies() {
+		request.AddCookie(cookie)
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+
+	if recorder.Code != http.StatusOK || recorder.Body.String() != "alice@example.com" {
+		t.Fatalf("Authenticated request ended with %d and user '%s'", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestOIDCGateRejectsNotAllowedUser(t *testing.T) {
+	provider := newOIDCProviderMock(t, "mallory@evil.example")
+	defer provider.server.Close()
+
+	gate, err := newOIDCGate(lm.OIDCSpecs{
+		IssuerURL:     provider.server.URL,
+		ClientID:      "client-id",
+		ClientSecret:  "client-secret",
+		AllowedEmails: []string{"alice@example.com"},
+	}, "https://site.loophole.site")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := gate.Handler(namedHandler("dashboard"))
+
+	callbackRecorder := login(t, provider, handler, "/")
+	if callbackRecorder.Code != http.StatusForbidden {
+		t.Fatalf("Status code %d is different than expected: %d", callbackRecorder.Code, http.StatusForbidden)
+	}
+}
+
+func TestOIDCGateRejectsForgedSession(t *testing.T) {
+	provider := newOIDCProviderMock(t, "alice@example.com")
+	defer provider.server.Close()
+
+	gate, err := newOIDCGate(lm.OIDCSpecs{
+		IssuerURL:     provider.server.URL,
+		ClientID:      "client-id",
+		AllowedEmails: []string{"alice@example.com"},
+	}, "https://site.loophole.site")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := gate.Handler(namedHandler("dashboard"))
+
+	session, _ := json.Marshal(oidcSession{Email: "alice@example.com", ExpiresAt: time.Now().Add(time.Hour).Unix()})
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.AddCookie(&http.Cookie{
+		Name:  oidcSessionCookieName,
+		Value: base64.RawURLEncoding.EncodeToString(session) + ".forged",
+	})
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+
+	if recorder.Code != http.StatusFound {
+		t.Fatalf("Forged session should redirect to login, got status code %d", recorder.Code)
+	}
+}
+
+func TestOIDCGateRequiresAllowList(t *testing.T) {
+	_, err := newOIDCGate(lm.OIDCSpecs{
+		IssuerURL: "http://127.0.0.1:0",
+		ClientID:  "client-id",
+	}, "https://site.loophole.site")
+	if err == nil {
+		t.Fatalf("Expected error when no allowed emails or domains are configured")
+	}
+}
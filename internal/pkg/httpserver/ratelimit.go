@@ -0,0 +1,68 @@
+package httpserver
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	lm "github.com/loophole/cli/internal/app/loophole/models"
+	"github.com/loophole/cli/internal/pkg/communication"
+	"github.com/loophole/cli/internal/pkg/metrics"
+	"github.com/loophole/cli/internal/pkg/ratelimit"
+)
+
+// RateLimitedRequestsMetric is the name of per site counter of requests rejected because of rate limits
+const RateLimitedRequestsMetric = "http_requests_rate_limited"
+
+// rateLimiter rejects requests over the per client or global rate with 429 status code
+type rateLimiter struct {
+	perClient *ratelimit.KeyedLimiter
+	global    *ratelimit.Bucket
+	rejected  *metrics.Counter
+}
+
+func newRateLimiter(siteID string, specs lm.RateLimitSpecs) *rateLimiter {
+	limiter := &rateLimiter{
+		rejected: metrics.GetSiteCounter(RateLimitedRequestsMetric, siteID),
+	}
+	if specs.Rate > 0 {
+		limiter.perClient = ratelimit.NewKeyedLimiter(specs.Rate, specs.Burst)
+	}
+	if specs.GlobalRate > 0 {
+		limiter.global = ratelimit.NewBucket(specs.GlobalRate, specs.GlobalBurst, time.Now())
+	}
+	return limiter
+}
+
+func (l *rateLimiter) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+		ip := clientIP(r)
+		if l.perClient != nil && ip != nil {
+			if ok, retryAfter := l.perClient.Take(ip.String(), now); !ok {
+				l.reject(w, r, retryAfter, fmt.Sprintf("Rate limit exceeded by %s", ip))
+				return
+			}
+		}
+		if l.global != nil {
+			if ok, retryAfter := l.global.Take(now); !ok {
+				// the client isn't over its own limit, so it's not charged for the rejected request
+				if l.perClient != nil && ip != nil {
+					l.perClient.Refund(ip.String())
+				}
+				l.reject(w, r, retryAfter, "Global rate limit exceeded")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (l *rateLimiter) reject(w http.ResponseWriter, r *http.Request, retryAfter time.Duration, reason string) {
+	l.rejected.Inc()
+	communication.Debug(fmt.Sprintf("%s, rejecting %s %s", reason, r.Method, r.URL.Path))
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+}
@@ -0,0 +1,64 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	lm "github.com/loophole/cli/internal/app/loophole/models"
+	"github.com/loophole/cli/internal/pkg/ratelimit"
+)
+
+func TestRateLimiterRejectsRequestsOverLimit(t *testing.T) {
+	handler := newRateLimiter("ratelimit-test", lm.RateLimitSpecs{Rate: 1, Burst: 2}).Handler(namedHandler("site"))
+
+	request := func(remoteAddr string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = remoteAddr
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, r)
+		return recorder
+	}
+
+	for i := 0; i < 2; i++ {
+		if recorder := request("203.0.113.1:1234"); recorder.Code != http.StatusOK {
+			t.Fatalf("Request %d within burst ended with status code %d", i+1, recorder.Code)
+		}
+	}
+	recorder := request("203.0.113.1:1234")
+	if recorder.Code != http.StatusTooManyRequests {
+		t.Fatalf("Status code %d is different than expected: %d", recorder.Code, http.StatusTooManyRequests)
+	}
+	if recorder.Header().Get("Retry-After") != "1" {
+		t.Fatalf("Retry-After '%s' is different than expected: 1", recorder.Header().Get("Retry-After"))
+	}
+	if recorder := request("203.0.113.2:1234"); recorder.Code != http.StatusOK {
+		t.Fatalf("Request of another client ended with status code %d", recorder.Code)
+	}
+}
+
+func TestGlobalRateLimitDoesNotChargeClient(t *testing.T) {
+	limiter := newRateLimiter("ratelimit-global-test", lm.RateLimitSpecs{Rate: 0.001, Burst: 1, GlobalRate: 0.001, GlobalBurst: 1})
+	handler := limiter.Handler(namedHandler("site"))
+	request := func(remoteAddr string) int {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = remoteAddr
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, r)
+		return recorder.Code
+	}
+
+	if code := request("203.0.113.1:1234"); code != http.StatusOK {
+		t.Fatalf("First request ended with status code %d", code)
+	}
+	if code := request("203.0.113.2:1234"); code != http.StatusTooManyRequests {
+		t.Fatalf("Request over the global limit ended with status code %d", code)
+	}
+
+	// global limit is lifted, the client should still have its own token
+	limiter.global = ratelimit.NewBucket(1000, 10, time.Now())
+	if code := request("203.0.113.2:1234"); code != http.StatusOK {
+		t.Fatalf("Client rejected by the global limit was charged for the request, status code %d", code)
+	}
+}
@@ -0,0 +1,58 @@
+package httpserver
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+const fileReloadInterval = 2 * time.Second
+
+// reloadableFile calls load whenever modification time of the file changes,
+// checking the file at most once per fileReloadInterval
+type reloadableFile struct {
+	path        string
+	load        func(path string) error
+	modTime     time.Time
+	lastChecked time.Time
+	mutex       sync.Mutex
+}
+
+func newReloadableFile(path string, load func(path string) error) (*reloadableFile, error) {
+	file := &reloadableFile{
+		path: path,
+		load: load,
+	}
+	_, err := file.reload()
+	return file, err
+}
+
+// reloadIfChanged returns true when the file was reloaded, on error previously loaded version should be kept
+func (f *reloadableFile) reloadIfChanged() (bool, error) {
+	f.mutex.Lock()
+	recentlyChecked := time.Since(f.lastChecked) < fileReloadInterval
+	f.mutex.Unlock()
+	if recentlyChecked {
+		return false, nil
+	}
+	return f.reload()
+}
+
+func (f *reloadableFile) reload() (bool, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.lastChecked = time.Now()
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return false, err
+	}
+	if info.ModTime().Equal(f.modTime) {
+		return false, nil
+	}
+	if err := f.load(f.path); err != nil {
+		return false, err
+	}
+	f.modTime = info.ModTime()
+	return true, nil
+}
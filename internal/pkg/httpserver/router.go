@@ -0,0 +1,103 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+)
+
+type prefixRoute struct {
+	prefix  string
+	handler http.Handler
+}
+
+// pathRouter dispatches requests to handlers by the longest matching path prefix
+type pathRouter struct {
+	routes []prefixRoute
+}
+
+func newPathRouter() *pathRouter {
+	return &pathRouter{}
+}
+
+func (pr *pathRouter) Handle(prefix string, handler http.Handler) {
+	pr.routes = append(pr.routes, prefixRoute{
+		prefix:  normalizePrefix(prefix),
+		handler: handler,
+	})
+	sort.SliceStable(pr.routes, func(i, j int) bool {
+		return len(pr.routes[i].prefix) > len(pr.routes[j].prefix)
+	})
+}
+
+func (pr *pathRouter) HasRoute(prefix string) bool {
+	prefix = normalizePrefix(prefix)
+	for _, route := range pr.routes {
+		if route.prefix == prefix {
+			return true
+		}
+	}
+	return false
+}
+
+func (pr *pathRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	for _, route := range pr.routes {
+		if matchesPathPrefix(r.URL.Path, route.prefix) {
+			route.handler.ServeHTTP(w, r)
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+func normalizePrefix(prefix string) string {
+	if prefix == "" || prefix == "/" {
+		return "/"
+	}
+	return "/" + strings.Trim(prefix, "/")
+}
+
+// matchesPathPrefix checks prefix on path segment boundaries, so '/api' matches '/api/users' but not '/apiary'
+func matchesPathPrefix(path string, prefix string) bool {
+	prefix = normalizePrefix(prefix)
+	if prefix == "/" {
+		return true
+	}
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// matchesCleanPathPrefix checks prefix against the path cleaned the way file servers and upstreams resolve it,
+// so that e.g. '/reports/../secret.txt' or '//hooks' can't escape the check; ok is false for paths with '..' segments,
+// which callers have to treat as the most restrictive case
+func matchesCleanPathPrefix(requestPath string, prefix string) (matches bool, ok bool) {
+	for _, segment := range strings.FieldsFunc(requestPath, isPathSeparator) {
+		if segment == ".." {
+			return false, false
+		}
+	}
+	return matchesPathPrefix(path.Clean("/"+requestPath), prefix), true
+}
+
+func isPathSeparator(r rune) bool {
+	return r == '/' || r == '\\'
+}
+
+func stripPathPrefix(u *url.URL, prefix string) {
+	prefix = normalizePrefix(prefix)
+	if prefix == "/" {
+		return
+	}
+	u.Path = ensureLeadingSlash(strings.TrimPrefix(u.Path, prefix))
+	if u.RawPath != "" {
+		u.RawPath = ensureLeadingSlash(strings.TrimPrefix(u.RawPath, prefix))
+	}
+}
+
+func ensureLeadingSlash(path string) string {
+	if !strings.HasPrefix(path, "/") {
+		return "/" + path
+	}
+	return path
+}
@@ -0,0 +1,70 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func namedHandler(name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(name))
+	})
+}
+
+func TestPathRouterPicksLongestPrefix(t *testing.T) {
+	router := newPathRouter()
+	router.Handle("/", namedHandler("frontend"))
+	router.Handle("/api", namedHandler("api"))
+	router.Handle("/api/admin/", namedHandler("admin"))
+
+	cases := map[string]string{
+		"/":                "frontend",
+		"/index.html":      "frontend",
+		"/api":             "api",
+		"/api/users":       "api",
+		"/apiary":          "frontend",
+		"/api/admin/stats": "admin",
+	}
+	for path, expected := range cases {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+
+		if recorder.Body.String() != expected {
+			t.Fatalf("Path '%s' was routed to '%s' instead of '%s'", path, recorder.Body.String(), expected)
+		}
+	}
+}
+
+func TestPathRouterReturnsNotFoundWithoutMatchingRoute(t *testing.T) {
+	router := newPathRouter()
+	router.Handle("/api", namedHandler("api"))
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/other", nil))
+
+	if recorder.Code != http.StatusNotFound {
+		t.Fatalf("Status code %d is different than expected: %d", recorder.Code, http.StatusNotFound)
+	}
+}
+
+func TestStripPathPrefix(t *testing.T) {
+	cases := map[string]string{
+		"/api":        "/",
+		"/api/":       "/",
+		"/api/users":  "/users",
+		"/api/a%2Fb/": "/a%2Fb/",
+	}
+	for path, expected := range cases {
+		u, err := url.Parse(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stripPathPrefix(u, "/api/")
+
+		if u.EscapedPath() != expected {
+			t.Fatalf("Stripped path '%s' is different than expected: '%s'", u.EscapedPath(), expected)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package httpserver
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/loophole/cli/internal/pkg/communication"
+	"github.com/loophole/cli/internal/pkg/sharelink"
+)
+
+const (
+	// ShareLinkQueryParam is the query parameter carrying share link token
+	ShareLinkQueryParam = "token"
+
+	shareLinkCookieName = "loophole_share"
+)
+
+// shareLinkGate lets through only requests with valid share link token, either in the query
+// or in the cookie set on first visit, so that browsing directory listings keeps working
+type shareLinkGate struct {
+	key       []byte
+	directory string
+	downloads *sharelink.Downloads
+}
+
+func newShareLinkGate(key []byte, downloads *sharelink.Downloads, directory string) *shareLinkGate {
+	return &shareLinkGate{
+		key:       key,
+		directory: directory,
+		downloads: downloads,
+	}
+}
+
+func (g *shareLinkGate) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get(ShareLinkQueryParam)
+		tokenFromQuery := token != ""
+		if !tokenFromQuery {
+			if cookie, err := r.Cookie(shareLinkCookieName); err == nil {
+				token = cookie.Value
+			}
+		}
+
+		claims, err := sharelink.Verify(g.key, token)
+		if err != nil || !g.withinLink(claims, r) {
+			writeForbiddenPage(w, r)
+			return
+		}
+
+		if tokenFromQuery {
+			cookiePath := "/"
+			if claims.Path != "" {
+				cookiePath = normalizePrefix(claims.Path)
+			}
+			http.SetCookie(w, &http.Cookie{
+				Name:     shareLinkCookieName,
+				Value:    token,
+				Path:     cookiePath,
+				Expires:  time.Unix(claims.ExpiresAt, 0),
+				Secure:   true,
+				HttpOnly: true,
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+
+		if claims.MaxDownloads > 0 && isFullDownload(r) && g.isFile(r.URL.Path) && !g.registerDownload(claims) {
+			writeForbiddenPage(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// withinLink checks that request, including destination of WebDav COPY and MOVE, stays under the path of the link
+func (g *shareLinkGate) withinLink(claims *sharelink.Claims, r *http.Request) bool {
+	if !withinPath(r.URL.Path, claims.Path) {
+		return false
+	}
+	destination := r.Header.Get("Destination")
+	if destination == "" {
+		return true
+	}
+	destinationURL, err := url.Parse(destination)
+	return err == nil && withinPath(destinationURL.Path, claims.Path)
+}
+
+func withinPath(requestPath string, linkPath string) bool {
+	matches, ok := matchesCleanPathPrefix(requestPath, linkPath)
+	return ok && matches
+}
+
+// isFullDownload tells apart downloads from range requests resuming them, which shouldn't use up the limit
+func isFullDownload(r *http.Request) bool {
+	if r.Method != http.MethodGet {
+		return false
+	}
+	byteRange := r.Header.Get("Range")
+	return byteRange == "" || strings.HasPrefix(byteRange, "bytes=0-")
+}
+
+// registerDownload counts file downloads made with the link, returning false when the limit is reached
+func (g *shareLinkGate) registerDownload(claims *sharelink.Claims) bool {
+	registered, err := g.downloads.Register(claims)
+	if err != nil {
+		communication.Warn(fmt.Sprintf("Failed to save share link download count: %v", err))
+	}
+	return registered
+}
+
+func (g *shareLinkGate) isFile(urlPath string) bool {
+	info, err := os.Stat(filepath.Join(g.directory, filepath.FromSlash(path.Clean("/"+urlPath))))
+	return err == nil && !info.IsDir()
+}
@@ -0,0 +1,162 @@
+package httpserver
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/loophole/cli/internal/pkg/sharelink"
+)
+
+func TestShareLinkGate(t *testing.T) {
+	directory, err := ioutil.TempDir("", "loophole-share")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+	os.MkdirAll(filepath.Join(directory, "reports"), 0755)
+	ioutil.WriteFile(filepath.Join(directory, "reports", "q3.pdf"), []byte("report"), 0644)
+	ioutil.WriteFile(filepath.Join(directory, "secret.txt"), []byte("secret"), 0644)
+
+	key := []byte("0123456789abcdef0123456789abcdef")
+	token, err := sharelink.Sign(key, sharelink.NewClaims(time.Hour, "/reports", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiredToken, _ := sharelink.Sign(key, sharelink.NewClaims(-time.Minute, "", 0))
+	downloads, err := sharelink.LoadDownloads(filepath.Join(directory, "downloads.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := newShareLinkGate(key, downloads, directory).Handler(namedHandler("files"))
+
+	testCases := []struct {
+		name         string
+		path         string
+		expectedCode int
+	}{
+		{"no token", "/reports/q3.pdf", http.StatusForbidden},
+		{"forged token", "/reports/q3.pdf?token=" + token + "x", http.StatusForbidden},
+		{"expired token", "/reports/q3.pdf?token=" + expiredToken, http.StatusForbidden},
+		{"path outside of the link", "/secret.txt?token=" + token, http.StatusForbidden},
+		{"path escaping the link", "/reports/../secret.txt?token=" + token, http.StatusForbidden},
+		{"path escaping the link with backslash", "/reports/..%5Csecret.txt?token=" + token, http.StatusForbidden},
+		{"directory listing", "/reports/?token=" + token, http.StatusOK},
+		{"first download", "/reports/q3.pdf?token=" + token, http.StatusOK},
+		{"download over the limit", "/reports/q3.pdf?token=" + token, http.StatusForbidden},
+	}
+
+	for _, testCase := range testCases {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, testCase.path, nil))
+		if recorder.Code != testCase.expectedCode {
+			t.Fatalf("%s: status code %d is different than expected: %d", testCase.name, recorder.Code, testCase.expectedCode)
+		}
+	}
+}
+
+func TestShareLinkGateChecksWebdavDestination(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	token, err := sharelink.Sign(key, sharelink.NewClaims(time.Hour, "/reports", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	directory := t.TempDir()
+	downloads, _ := sharelink.LoadDownloads(filepath.Join(directory, "downloads.json"))
+	handler := newShareLinkGate(key, downloads, directory).Handler(namedHandler("webdav"))
+
+	testCases := map[string]int{
+		"https://demo.loophole.site/reports/copy.pdf":          http.StatusOK,
+		"/reports/archive/q3.pdf":                              http.StatusOK,
+		"https://demo.loophole.site/secret.txt":                http.StatusForbidden,
+		"https://demo.loophole.site/reports/../secret.txt":     http.StatusForbidden,
+		"https://demo.loophole.site/reports/%2e%2e/secret.txt": http.StatusForbidden,
+	}
+	for destination, expectedCode := range testCases {
+		request := httptest.NewRequest("MOVE", "/reports/q3.pdf?token="+token, nil)
+		request.Header.Set("Destination", destination)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		if recorder.Code != expectedCode {
+			t.Fatalf("MOVE to '%s': status code %d is different than expected: %d", destination, recorder.Code, expectedCode)
+		}
+	}
+}
+
+func TestShareLinkDownloadLimit(t *testing.T) {
+	directory := t.TempDir()
+	ioutil.WriteFile(filepath.Join(directory, "q3.pdf"), []byte("report"), 0644)
+	key := []byte("0123456789abcdef0123456789abcdef")
+	token, err := sharelink.Sign(key, sharelink.NewClaims(time.Hour, "", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	countsFile := filepath.Join(directory, "downloads.json")
+	newHandler := func() http.Handler {
+		downloads, err := sharelink.LoadDownloads(countsFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return newShareLinkGate(key, downloads, directory).Handler(namedHandler("file"))
+	}
+	download := func(handler http.Handler, byteRange string) int {
+		request := httptest.NewRequest(http.MethodGet, "/q3.pdf?token="+token, nil)
+		if byteRange != "" {
+			request.Header.Set("Range", byteRange)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+
+	handler := newHandler()
+	if code := download(handler, ""); code != http.StatusOK {
+		t.Fatalf("First download failed with status code %d", code)
+	}
+	if code := download(handler, "bytes=3-"); code != http.StatusOK {
+		t.Fatalf("Resumed download failed with status code %d", code)
+	}
+	if code := download(newHandler(), ""); code != http.StatusForbidden {
+		t.Fatalf("Download over the limit after restart returned status code %d", code)
+	}
+}
+
+func TestBuiltServersLimitShareLinkDownloads(t *testing.T) {
+	directory := t.TempDir()
+	ioutil.WriteFile(filepath.Join(directory, "q3.pdf"), []byte("report"), 0644)
+	key := []byte("0123456789abcdef0123456789abcdef")
+
+	builders := map[string]func(downloads *sharelink.Downloads) (*http.Server, error){
+		"static": func(downloads *sharelink.Downloads) (*http.Server, error) {
+			return New().WithSiteID("site").WithDomain("loophole.site").ServeStatic().
+				FromDirectory(directory).WithShareLinks(key, downloads).Build()
+		},
+		"webdav": func(downloads *sharelink.Downloads) (*http.Server, error) {
+			return New().WithSiteID("site").WithDomain("loophole.site").ServeWebdav().
+				FromDirectory(directory).WithShareLinks(key, downloads).Build()
+		},
+	}
+	for name, build := range builders {
+		downloads, err := sharelink.LoadDownloads(filepath.Join(directory, name+".downloads"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		server, err := build(downloads)
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, _ := sharelink.Sign(key, sharelink.NewClaims(time.Hour, "", 1))
+
+		for _, expectedCode := range []int{http.StatusOK, http.StatusForbidden} {
+			recorder := httptest.NewRecorder()
+			server.Handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/q3.pdf?token="+token, nil))
+			if recorder.Code != expectedCode {
+				t.Fatalf("%s: status code %d is different than expected: %d", name, recorder.Code, expectedCode)
+			}
+		}
+	}
+}
@@ -5,24 +5,93 @@ package httpserver
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
 
 	"github.com/loophole/cli/internal/pkg/cache"
 	"github.com/loophole/cli/internal/pkg/urlmaker"
+	"golang.org/x/crypto/acme"
 	"golang.org/x/crypto/acme/autocert"
 )
 
-func getTLSConfig(siteID string, domain string, disableOldCiphers bool) *tls.Config {
-	certManager := autocert.Manager{
+func getTLSConfig(options tlsOptions) (*tls.Config, error) {
+	var config *tls.Config
+	if options.certificate.CertFile != "" || options.certificate.KeyFile != "" {
+		userCertificateConfig, err := getUserCertificateTLSConfig(options)
+		if err != nil {
+			return nil, err
+		}
+		config = userCertificateConfig
+	} else {
+		certManager, err := getCertManager(options)
+		if err != nil {
+			return nil, err
+		}
+		config = certManager.TLSConfig()
+	}
+
+	if err := applyTLSPolicy(config, options.disableOldCiphers, options.certificate); err != nil {
+		return nil, err
+	}
+	if err := applyClientAuth(config, options.certificate); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func getCertManager(options tlsOptions) (*autocert.Manager, error) {
+	email := options.certificate.ACMEEmail
+	if email == "" {
+		email = fmt.Sprintf("lh-%s@main.dev", options.siteID)
+	}
+	certManager := &autocert.Manager{
 		Prompt:     autocert.AcceptTOS,
-		HostPolicy: autocert.HostWhitelist(urlmaker.GetSiteFQDN(siteID, domain)),
+		HostPolicy: autocert.HostWhitelist(urlmaker.GetSiteFQDN(options.siteID, options.domain)),
 		Cache:      autocert.DirCache(cache.GetLocalStorageDir("certs")),
-		Email:      fmt.Sprintf("lh-%s@main.dev", siteID),
+		Email:      email,
+	}
+
+	if options.certificate.ACMEDirectoryURL != "" {
+		directoryURL, err := url.Parse(options.certificate.ACMEDirectoryURL)
+		if err != nil || directoryURL.Host == "" {
+			return nil, fmt.Errorf("Invalid ACME directory URL '%s'", options.certificate.ACMEDirectoryURL)
+		}
+		// certificates from different CA are kept separately, so that e.g. test certificates are never served by mistake
+		certManager.Cache = autocert.DirCache(cache.GetLocalStorageDir(path.Join("certs", strings.ReplaceAll(directoryURL.Host, ":", "_"))))
+		certManager.Client = &acme.Client{
+			DirectoryURL: options.certificate.ACMEDirectoryURL,
+		}
+		if options.certificate.ACMECAFile != "" {
+			httpClient, err := getHTTPClientTrustingCA(options.certificate.ACMECAFile)
+			if err != nil {
+				return nil, err
+			}
+			certManager.Client.HTTPClient = httpClient
+		}
 	}
+	return certManager, nil
+}
 
-	config := certManager.TLSConfig()
-	if disableOldCiphers {
-		config.MinVersion = tls.VersionTLS12
+// getHTTPClientTrustingCA returns HTTP client trusting given CA in addition to the system ones,
+// ACME servers used for testing (e.g. Pebble or step-ca) are usually served with private CA certificate
+func getHTTPClientTrustingCA(caFile string) (*http.Client, error) {
+	caCertificates, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	rootCAs, err := x509.SystemCertPool()
+	if err != nil || rootCAs == nil {
+		rootCAs = x509.NewCertPool()
+	}
+	if !rootCAs.AppendCertsFromPEM(caCertificates) {
+		return nil, fmt.Errorf("No PEM encoded certificates found in '%s'", caFile)
 	}
-	return config
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: rootCAs}
+	return &http.Client{Transport: transport}, nil
 }
@@ -4,112 +4,61 @@
 package httpserver
 
 import (
-	"crypto/rand"
-	"crypto/rsa"
 	"crypto/tls"
-	"crypto/x509"
-	"crypto/x509/pkix"
 	"fmt"
-	"math/big"
-	"net"
-	"strings"
+	"sync"
 	"time"
 
+	"github.com/loophole/cli/internal/pkg/cache"
 	"github.com/loophole/cli/internal/pkg/communication"
-	"github.com/pkg/errors"
+	"github.com/loophole/cli/internal/pkg/devca"
 )
 
-func getTLSConfig(siteID string, domain string, disableOldCiphers bool) *tls.Config {
-	config := &tls.Config{
-		GetCertificate: getCertificate(fmt.Sprintf("%s.%s", siteID, domain)),
-	}
-	if disableOldCiphers {
-		config.MinVersion = tls.VersionTLS12
-	}
-	return config
-}
-
-func getCertificate(arg interface{}) func(clientHello *tls.ClientHelloInfo) (*tls.Certificate, error) {
-	var opts certopts
-	var err error
-	if host, ok := arg.(string); ok {
-		opts = certopts{
-			RsaBits:   2048,
-			Host:      host,
-			ValidFrom: time.Now(),
+func getTLSConfig(options tlsOptions) (*tls.Config, error) {
+	var config *tls.Config
+	if options.certificate.CertFile != "" || options.certificate.KeyFile != "" {
+		userCertificateConfig, err := getUserCertificateTLSConfig(options)
+		if err != nil {
+			return nil, err
 		}
-	} else if o, ok := arg.(certopts); ok {
-		opts = o
+		config = userCertificateConfig
 	} else {
-		err = errors.New("Invalid arg type, must be string(hostname) or Certopt{...}")
-	}
-	cert, err := generate(opts)
-	return func(clientHello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		ca, err := devca.LoadOrCreate(cache.GetLocalStorageDir("dev-ca"))
 		if err != nil {
 			return nil, err
 		}
-		communication.Info("Obtained development certificate")
-		return cert, nil
+		config = &tls.Config{
+			GetCertificate: getCertificate(ca, fmt.Sprintf("%s.%s", options.siteID, options.domain)),
+		}
 	}
-}
-
-type certopts struct {
-	RsaBits   int
-	Host      string
-	IsCA      bool
-	ValidFrom time.Time
-	ValidFor  time.Duration
-}
-
-func generate(opts certopts) (*tls.Certificate, error) {
-
-	priv, err := rsa.GenerateKey(rand.Reader, opts.RsaBits)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to generate private key")
+	if err := applyTLSPolicy(config, options.disableOldCiphers, options.certificate); err != nil {
+		return nil, err
 	}
-
-	notAfter := opts.ValidFrom.Add(opts.ValidFor)
-
-	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
-	serialNumber, err := rand.Int(rand.Reader, serialNumberLimit)
-	if err != nil {
-		return nil, errors.Wrap(err, "Failed to generate serial number\n")
+	if err := applyClientAuth(config, options.certificate); err != nil {
+		return nil, err
 	}
+	return config, nil
+}
 
-	template := x509.Certificate{
-		SerialNumber: serialNumber,
-		Subject: pkix.Name{
-			Organization: []string{"Acme Co"},
-		},
-		NotBefore: opts.ValidFrom,
-		NotAfter:  notAfter,
-
-		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
-		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
-		BasicConstraintsValid: true,
-	}
+// getCertificate issues certificate for the host signed by the development CA on first use,
+// and issues it again once it expires
+func getCertificate(ca *devca.CA, host string) func(clientHello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	var cert *tls.Certificate
+	var mutex sync.Mutex
+	return func(clientHello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
 
-	hosts := strings.Split(opts.Host, ",")
-	for _, h := range hosts {
-		if ip := net.ParseIP(h); ip != nil {
-			template.IPAddresses = append(template.IPAddresses, ip)
-		} else {
-			template.DNSNames = append(template.DNSNames, h)
+		now := time.Now()
+		if cert != nil && now.Before(cert.Leaf.NotAfter) {
+			return cert, nil
 		}
+		issued, err := ca.Issue(now, host)
+		if err != nil {
+			return nil, err
+		}
+		cert = issued
+		communication.Info("Obtained development certificate, run 'loophole dev-ca export' to trust it")
+		return cert, nil
 	}
-
-	if opts.IsCA {
-		template.IsCA = true
-		template.KeyUsage |= x509.KeyUsageCertSign
-	}
-
-	derBytes, err := x509.CreateCertificate(rand.Reader, &template, &template, &priv.PublicKey, priv)
-	if err != nil {
-		return nil, errors.Wrap(err, "Failed to create certificate")
-	}
-
-	return &tls.Certificate{
-		Certificate: [][]byte{derBytes},
-		PrivateKey:  priv,
-	}, nil
 }
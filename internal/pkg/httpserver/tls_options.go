@@ -0,0 +1,136 @@
+package httpserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"sync"
+
+	lm "github.com/loophole/cli/internal/app/loophole/models"
+	"github.com/loophole/cli/internal/pkg/communication"
+	"github.com/loophole/cli/internal/pkg/urlmaker"
+	"golang.org/x/crypto/acme"
+)
+
+// tlsOptions are the settings TLS configuration of the site is built from
+type tlsOptions struct {
+	siteID            string
+	domain            string
+	disableOldCiphers bool
+	certificate       lm.TLSSpecs
+}
+
+// certificatePair serves user provided certificate, reloading it whenever certificate or key file changes
+type certificatePair struct {
+	certPath    string
+	keyPath     string
+	hostname    string
+	certFile    *reloadableFile
+	keyFile     *reloadableFile
+	certificate *tls.Certificate
+	mutex       sync.RWMutex
+}
+
+func newCertificatePair(certPath string, keyPath string, hostname string) (*certificatePair, error) {
+	if certPath == "" || keyPath == "" {
+		return nil, fmt.Errorf("Both certificate and key files have to be provided")
+	}
+	pair := &certificatePair{
+		certPath: certPath,
+		keyPath:  keyPath,
+		hostname: hostname,
+	}
+	var err error
+	pair.certFile, err = newReloadableFile(certPath, pair.load)
+	if err != nil {
+		return nil, err
+	}
+	pair.keyFile, err = newReloadableFile(keyPath, pair.load)
+	if err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+func (p *certificatePair) load(string) error {
+	certificate, err := tls.LoadX509KeyPair(p.certPath, p.keyPath)
+	if err != nil {
+		return err
+	}
+	leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+	if err != nil {
+		return err
+	}
+	if err := leaf.VerifyHostname(p.hostname); err != nil {
+		communication.Warn(fmt.Sprintf("Certificate '%s' is not valid for %s, clients will reject it: %s", p.certPath, p.hostname, err.Error()))
+	}
+	certificate.Leaf = leaf
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.certificate = &certificate
+	return nil
+}
+
+// GetCertificate is used as tls.Config callback, so that reloaded certificate is used for new connections
+func (p *certificatePair) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	for _, file := range []*reloadableFile{p.certFile, p.keyFile} {
+		reloaded, err := file.reloadIfChanged()
+		if err != nil {
+			communication.Warn(fmt.Sprintf("Failed to reload certificate from '%s', keeping previous version: %s", file.path, err.Error()))
+		} else if reloaded {
+			communication.Info(fmt.Sprintf("Certificate reloaded from '%s'", file.path))
+		}
+	}
+
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.certificate, nil
+}
+
+// getUserCertificateTLSConfig returns TLS configuration serving certificate provided by the user
+func getUserCertificateTLSConfig(options tlsOptions) (*tls.Config, error) {
+	pair, err := newCertificatePair(options.certificate.CertFile, options.certificate.KeyFile, urlmaker.GetSiteFQDN(options.siteID, options.domain))
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		GetCertificate: pair.GetCertificate,
+	}, nil
+}
+
+// applyClientAuth configures verification of client certificates when client CA is provided
+func applyClientAuth(config *tls.Config, specs lm.TLSSpecs) error {
+	if specs.ClientCAFile == "" {
+		if len(specs.ClientCertPaths) > 0 {
+			return fmt.Errorf("Client certificate paths require client CA to be provided")
+		}
+		return nil
+	}
+	caCertificates, err := ioutil.ReadFile(specs.ClientCAFile)
+	if err != nil {
+		return err
+	}
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(caCertificates) {
+		return fmt.Errorf("No PEM encoded certificates found in '%s'", specs.ClientCAFile)
+	}
+
+	// ACME server validating TLS-ALPN challenge has no client certificate, so it gets configuration without client auth
+	acmeConfig := config.Clone()
+	config.ClientCAs = clientCAs
+	config.ClientAuth = tls.RequireAndVerifyClientCert
+	if len(specs.ClientCertPaths) > 0 {
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	config.GetConfigForClient = func(clientHello *tls.ClientHelloInfo) (*tls.Config, error) {
+		for _, protocol := range clientHello.SupportedProtos {
+			if protocol == acme.ALPNProto {
+				return acmeConfig, nil
+			}
+		}
+		return nil, nil
+	}
+	return nil
+}
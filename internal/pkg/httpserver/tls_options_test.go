@@ -0,0 +1,79 @@
+package httpserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCertificate writes self-signed certificate for the hostname with given serial number
+func writeCertificate(t *testing.T, certPath string, keyPath string, hostname string, serialNumber int64) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(serialNumber),
+		Subject:      pkix.Name{CommonName: hostname},
+		DNSNames:     []string{hostname},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+}
+
+func TestCertificatePairReloadsChangedFiles(t *testing.T) {
+	directory, err := ioutil.TempDir("", "loophole-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+	certPath := filepath.Join(directory, "cert.pem")
+	keyPath := filepath.Join(directory, "key.pem")
+	writeCertificate(t, certPath, keyPath, "site.loophole.site", 1)
+
+	pair, err := newCertificatePair(certPath, keyPath, "site.loophole.site")
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, _ := pair.GetCertificate(nil)
+	if certificate.Leaf.SerialNumber.Int64() != 1 {
+		t.Fatalf("Serial number %d is different than expected: 1", certificate.Leaf.SerialNumber.Int64())
+	}
+
+	writeCertificate(t, certPath, keyPath, "site.loophole.site", 2)
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(certPath, future, future)
+	os.Chtimes(keyPath, future, future)
+	pair.certFile.lastChecked = time.Time{}
+	pair.keyFile.lastChecked = time.Time{}
+
+	certificate, _ = pair.GetCertificate(nil)
+	if certificate.Leaf.SerialNumber.Int64() != 2 {
+		t.Fatalf("Serial number %d is different than expected after reload: 2", certificate.Leaf.SerialNumber.Int64())
+	}
+}
+
+func TestCertificatePairRequiresBothFiles(t *testing.T) {
+	if _, err := newCertificatePair("cert.pem", "", "site.loophole.site"); err == nil {
+		t.Fatalf("Expected error when key file is missing")
+	}
+}
@@ -0,0 +1,168 @@
+package httpserver
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	lm "github.com/loophole/cli/internal/app/loophole/models"
+)
+
+// tlsProfile is a set of TLS settings following Mozilla server side TLS guidelines,
+// see https://wiki.mozilla.org/Security/Server_Side_TLS
+type tlsProfile struct {
+	minVersion   uint16
+	cipherSuites []uint16
+	curves       []tls.CurveID
+}
+
+var intermediateCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+}
+
+var tlsProfiles = map[string]tlsProfile{
+	// cipher suites of TLS 1.3 are not configurable, all of them are secure
+	lm.TLSProfileModern: {
+		minVersion: tls.VersionTLS13,
+		curves:     []tls.CurveID{tls.X25519, tls.CurveP256, tls.CurveP384},
+	},
+	lm.TLSProfileIntermediate: {
+		minVersion:   tls.VersionTLS12,
+		cipherSuites: intermediateCipherSuites,
+		curves:       []tls.CurveID{tls.X25519, tls.CurveP256, tls.CurveP384},
+	},
+	lm.TLSProfileLegacy: {
+		minVersion: tls.VersionTLS10,
+		cipherSuites: append(append([]uint16{}, intermediateCipherSuites...),
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
+			tls.TLS_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_RSA_WITH_AES_128_CBC_SHA256,
+			tls.TLS_RSA_WITH_AES_128_CBC_SHA,
+			tls.TLS_RSA_WITH_AES_256_CBC_SHA,
+			tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA,
+		),
+		curves: []tls.CurveID{tls.X25519, tls.CurveP256, tls.CurveP384},
+	},
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+var tlsCurves = map[string]tls.CurveID{
+	"X25519": tls.X25519,
+	"P256":   tls.CurveP256,
+	"P384":   tls.CurveP384,
+	"P521":   tls.CurveP521,
+}
+
+// applyTLSPolicy restricts protocol versions, cipher suites, curves and ALPN protocols of the configuration,
+// explicitly provided values take precedence over the profile
+func applyTLSPolicy(config *tls.Config, disableOldCiphers bool, specs lm.TLSSpecs) error {
+	if specs.Profile != "" {
+		profile, ok := tlsProfiles[strings.ToLower(specs.Profile)]
+		if !ok {
+			return fmt.Errorf("Unknown TLS profile '%s', available profiles: %s, %s, %s", specs.Profile, lm.TLSProfileModern, lm.TLSProfileIntermediate, lm.TLSProfileLegacy)
+		}
+		config.MinVersion = profile.minVersion
+		config.CipherSuites = profile.cipherSuites
+		config.CurvePreferences = profile.curves
+	}
+	if disableOldCiphers && config.MinVersion < tls.VersionTLS12 {
+		config.MinVersion = tls.VersionTLS12
+	}
+	if specs.MinVersion != "" {
+		version, ok := tlsVersions[specs.MinVersion]
+		if !ok {
+			return fmt.Errorf("Unknown TLS version '%s', expected one of: 1.0, 1.1, 1.2, 1.3", specs.MinVersion)
+		}
+		config.MinVersion = version
+	}
+	if len(specs.CipherSuites) > 0 {
+		cipherSuites, err := parseCipherSuites(specs.CipherSuites)
+		if err != nil {
+			return err
+		}
+		config.CipherSuites = cipherSuites
+	}
+	if len(specs.Curves) > 0 {
+		curves, err := parseCurves(specs.Curves)
+		if err != nil {
+			return err
+		}
+		config.CurvePreferences = curves
+	}
+	if specs.DisableHTTP2 {
+		config.NextProtos = withoutProtocol(config.NextProtos, "h2")
+	}
+	return nil
+}
+
+func parseCipherSuites(names []string) ([]uint16, error) {
+	available := map[string]uint16{}
+	for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		available[suite.Name] = suite.ID
+	}
+	cipherSuites := []uint16{}
+	for _, name := range names {
+		id, ok := available[strings.ToUpper(strings.TrimSpace(name))]
+		if !ok {
+			return nil, fmt.Errorf("Unknown cipher suite '%s', expected name like TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", name)
+		}
+		cipherSuites = append(cipherSuites, id)
+	}
+	return cipherSuites, nil
+}
+
+func parseCurves(names []string) ([]tls.CurveID, error) {
+	curves := []tls.CurveID{}
+	for _, name := range names {
+		curve, ok := tlsCurves[strings.ToUpper(strings.TrimSpace(name))]
+		if !ok {
+			known := []string{}
+			for knownName := range tlsCurves {
+				known = append(known, knownName)
+			}
+			sort.Strings(known)
+			return nil, fmt.Errorf("Unknown curve '%s', expected one of: %s", name, strings.Join(known, ", "))
+		}
+		curves = append(curves, curve)
+	}
+	return curves, nil
+}
+
+func withoutProtocol(protocols []string, protocol string) []string {
+	filtered := []string{}
+	for _, p := range protocols {
+		if p != protocol {
+			filtered = append(filtered, p)
+		}
+	}
+	return filtered
+}
+
+// hstsHandler instructs browsers to use only HTTPS for the site for given time
+func hstsHandler(maxAge time.Duration, next http.Handler) http.Handler {
+	value := fmt.Sprintf("max-age=%d", int64(maxAge.Seconds()))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Strict-Transport-Security", value)
+		next.ServeHTTP(w, r)
+	})
+}
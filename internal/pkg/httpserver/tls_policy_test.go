@@ -0,0 +1,68 @@
+package httpserver
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	lm "github.com/loophole/cli/internal/app/loophole/models"
+)
+
+func TestApplyTLSPolicy(t *testing.T) {
+	testCases := []struct {
+		name               string
+		disableOldCiphers  bool
+		specs              lm.TLSSpecs
+		expectedMinVersion uint16
+		expectedCiphers    []uint16
+		expectedProtocols  []string
+		valid              bool
+	}{
+		{"defaults", false, lm.TLSSpecs{}, 0, nil, []string{"h2", "http/1.1"}, true},
+		{"old ciphers disabled", true, lm.TLSSpecs{}, tls.VersionTLS12, nil, []string{"h2", "http/1.1"}, true},
+		{"modern profile", true, lm.TLSSpecs{Profile: "modern"}, tls.VersionTLS13, nil, []string{"h2", "http/1.1"}, true},
+		{"intermediate profile", false, lm.TLSSpecs{Profile: "intermediate"}, tls.VersionTLS12, intermediateCipherSuites, []string{"h2", "http/1.1"}, true},
+		{"legacy profile with old ciphers disabled", true, lm.TLSSpecs{Profile: "legacy"}, tls.VersionTLS12, tlsProfiles[lm.TLSProfileLegacy].cipherSuites, []string{"h2", "http/1.1"}, true},
+		{"TLS 1.3 only", false, lm.TLSSpecs{Profile: "legacy", MinVersion: "1.3"}, tls.VersionTLS13, tlsProfiles[lm.TLSProfileLegacy].cipherSuites, []string{"h2", "http/1.1"}, true},
+		{"explicit ciphers", false, lm.TLSSpecs{Profile: "intermediate", CipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"}}, tls.VersionTLS12, []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}, []string{"h2", "http/1.1"}, true},
+		{"HTTP/2 disabled", false, lm.TLSSpecs{DisableHTTP2: true}, 0, nil, []string{"http/1.1"}, true},
+		{"unknown profile", false, lm.TLSSpecs{Profile: "paranoid"}, 0, nil, nil, false},
+		{"unknown version", false, lm.TLSSpecs{MinVersion: "1.4"}, 0, nil, nil, false},
+		{"unknown cipher", false, lm.TLSSpecs{CipherSuites: []string{"RC5"}}, 0, nil, nil, false},
+		{"unknown curve", false, lm.TLSSpecs{Curves: []string{"P123"}}, 0, nil, nil, false},
+	}
+
+	for _, testCase := range testCases {
+		config := &tls.Config{NextProtos: []string{"h2", "http/1.1"}}
+		err := applyTLSPolicy(config, testCase.disableOldCiphers, testCase.specs)
+		if (err == nil) != testCase.valid {
+			t.Fatalf("%s: unexpected error: %v", testCase.name, err)
+		}
+		if !testCase.valid {
+			continue
+		}
+		if config.MinVersion != testCase.expectedMinVersion {
+			t.Fatalf("%s: minimum version %x is different than expected: %x", testCase.name, config.MinVersion, testCase.expectedMinVersion)
+		}
+		if !reflect.DeepEqual(config.CipherSuites, testCase.expectedCiphers) {
+			t.Fatalf("%s: cipher suites %v are different than expected: %v", testCase.name, config.CipherSuites, testCase.expectedCiphers)
+		}
+		if !reflect.DeepEqual(config.NextProtos, testCase.expectedProtocols) {
+			t.Fatalf("%s: ALPN protocols %v are different than expected: %v", testCase.name, config.NextProtos, testCase.expectedProtocols)
+		}
+	}
+}
+
+func TestHSTSHandler(t *testing.T) {
+	handler := hstsHandler(365*24*time.Hour, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	recorder := httptest.NewRecorder()
+
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if header := recorder.Header().Get("Strict-Transport-Security"); header != "max-age=31536000" {
+		t.Fatalf("Strict-Transport-Security header '%s' is different than expected: 'max-age=31536000'", header)
+	}
+}
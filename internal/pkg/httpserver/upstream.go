@@ -0,0 +1,78 @@
+package httpserver
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+
+	lm "github.com/loophole/cli/internal/app/loophole/models"
+	"golang.org/x/net/http2"
+)
+
+const upstreamDialTimeout = 30 * time.Second
+
+func isHTTP2Upstream(protocol string) bool {
+	return protocol == lm.UpstreamProtocolH2 || protocol == lm.UpstreamProtocolH2C
+}
+
+// NewUpstreamTransport returns transport for upstreams served over HTTPS, HTTP/2 or Unix socket,
+// nil if default one can be used
+func NewUpstreamTransport(endpoint lm.Endpoint, disableCertCheck bool, protocol string) http.RoundTripper {
+	useTLS := disableCertCheck || endpoint.Protocol == "https"
+	if isHTTP2Upstream(protocol) {
+		return newHTTP2Transport(endpoint, useTLS, disableCertCheck)
+	}
+	if !useTLS && endpoint.Socket == "" {
+		return nil
+	}
+	transport := &http.Transport{}
+	if useTLS {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: disableCertCheck}
+	}
+	if endpoint.Socket != "" {
+		transport.DialContext = upstreamDialer(endpoint)
+	}
+	return transport
+}
+
+// newHTTP2Transport returns transport speaking HTTP/2 with prior knowledge, over TLS (h2) or cleartext (h2c)
+func newHTTP2Transport(endpoint lm.Endpoint, useTLS bool, disableCertCheck bool) *http2.Transport {
+	dial := upstreamDialer(endpoint)
+	transport := &http2.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: disableCertCheck},
+	}
+	if useTLS {
+		transport.DialTLS = func(network string, address string, config *tls.Config) (net.Conn, error) {
+			conn, err := dial(context.Background(), network, address)
+			if err != nil {
+				return nil, err
+			}
+			tlsConn := tls.Client(conn, config)
+			if err := tlsConn.Handshake(); err != nil {
+				conn.Close()
+				return nil, err
+			}
+			return tlsConn, nil
+		}
+		return transport
+	}
+	// h2c requests are sent with http scheme over plain connection
+	transport.AllowHTTP = true
+	transport.DialTLS = func(network string, address string, _ *tls.Config) (net.Conn, error) {
+		return dial(context.Background(), network, address)
+	}
+	return transport
+}
+
+// upstreamDialer connects to the Unix socket of the endpoint if set, to the requested address otherwise
+func upstreamDialer(endpoint lm.Endpoint) func(ctx context.Context, network string, address string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: upstreamDialTimeout}
+	return func(ctx context.Context, network string, address string) (net.Conn, error) {
+		if endpoint.Socket != "" {
+			return dialer.DialContext(ctx, "unix", endpoint.Socket)
+		}
+		return dialer.DialContext(ctx, network, address)
+	}
+}
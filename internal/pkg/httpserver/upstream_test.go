@@ -0,0 +1,175 @@
+package httpserver
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	lm "github.com/loophole/cli/internal/app/loophole/models"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+func TestReverseProxyToUnixSocket(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix sockets are not available on all Windows versions")
+	}
+	directory, err := ioutil.TempDir("", "loophole-socket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+	socket := filepath.Join(directory, "app.sock")
+
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	upstream := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host + r.URL.Path))
+	})}
+	go upstream.Serve(listener)
+	defer upstream.Close()
+
+	psb := &proxyServerBuilder{serverBuilder: &serverBuilder{siteID: "site", domain: "loophole.site"}}
+	proxy := psb.newReverseProxy(lm.Endpoint{Protocol: "http", Socket: socket}, "", false, "")
+	recorder := httptest.NewRecorder()
+
+	proxy.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/index.php", nil))
+
+	if recorder.Code != http.StatusOK || recorder.Body.String() != "localhost/index.php" {
+		t.Fatalf("Unexpected response from Unix socket upstream: %d '%s'", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestReverseProxyToH2CUpstreamPreservesTrailers(t *testing.T) {
+	upstream := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.Write([]byte(r.Proto))
+		w.Header().Set("Grpc-Status", "0")
+	}), &http2.Server{}))
+	defer upstream.Close()
+	upstreamURL, _ := url.Parse(upstream.URL)
+	port, _ := strconv.Atoi(upstreamURL.Port())
+
+	psb := &proxyServerBuilder{serverBuilder: &serverBuilder{siteID: "site", domain: "loophole.site"}}
+	proxy := httptest.NewUnstartedServer(psb.newReverseProxy(lm.Endpoint{Protocol: "http", Host: "127.0.0.1", Port: int32(port)}, "", false, lm.UpstreamProtocolH2C))
+	proxy.EnableHTTP2 = true
+	proxy.StartTLS()
+	defer proxy.Close()
+
+	response, err := proxy.Client().Get(proxy.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+
+	if response.ProtoMajor != 2 || string(body) != "HTTP/2.0" {
+		t.Fatalf("Request wasn't proxied over HTTP/2 end to end: client %s, upstream '%s'", response.Proto, body)
+	}
+	if status := response.Trailer.Get("Grpc-Status"); status != "0" {
+		t.Fatalf("Trailer '%s' is different than expected: '0'", status)
+	}
+}
+
+func TestMaintenancePageWhileUpstreamIsDown(t *testing.T) {
+	healthy := false
+	handler := maintenanceHandler(func() bool { return healthy }, false, namedHandler("upstream"))
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	if recorder.Code != http.StatusServiceUnavailable || recorder.Header().Get("Retry-After") == "" {
+		t.Fatalf("Unexpected response while upstream is down: %d, Retry-After '%s'", recorder.Code, recorder.Header().Get("Retry-After"))
+	}
+
+	healthy = true
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	if recorder.Body.String() != "upstream" {
+		t.Fatalf("Request wasn't proxied once upstream is up")
+	}
+}
+
+func TestMaintenancePageServesEmbeddedLogo(t *testing.T) {
+	pages, err := newErrorPages("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := pages.Handler(maintenanceHandler(func() bool { return false }, false, namedHandler("upstream")))
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	if !strings.Contains(recorder.Body.String(), logoPath) {
+		t.Fatalf("Maintenance page doesn't use embedded logo: %s", recorder.Body.String())
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, logoPath, nil))
+	if recorder.Header().Get("Content-Type") != "image/png" || recorder.Body.Len() != len(logo) {
+		t.Fatalf("Embedded logo wasn't served: %d, %s", recorder.Code, recorder.Header().Get("Content-Type"))
+	}
+}
+
+func TestReverseProxyVerifiesHTTPSUpstreamCertificate(t *testing.T) {
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("secure"))
+	}))
+	defer upstream.Close()
+	upstreamURL, _ := url.Parse(upstream.URL)
+	port, _ := strconv.Atoi(upstreamURL.Port())
+	endpoint := lm.Endpoint{Protocol: "https", Host: "127.0.0.1", Port: int32(port)}
+
+	psb := &proxyServerBuilder{serverBuilder: &serverBuilder{siteID: "site", domain: "loophole.site"}}
+	recorder := httptest.NewRecorder()
+	psb.newReverseProxy(endpoint, "", false, "").ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	if recorder.Code != http.StatusBadGateway {
+		t.Fatalf("Self-signed upstream certificate was accepted: %d", recorder.Code)
+	}
+
+	recorder = httptest.NewRecorder()
+	psb.newReverseProxy(endpoint, "", true, "").ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	if recorder.Code != http.StatusOK || recorder.Body.String() != "secure" {
+		t.Fatalf("Upstream wasn't reached with certificate check disabled: %d '%s'", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestUpstreamProtocolDoesNotApplyToRoutes(t *testing.T) {
+	grpc := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("grpc " + r.Proto))
+	}), &http2.Server{}))
+	defer grpc.Close()
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("api " + r.Proto))
+	}))
+	defer api.Close()
+	endpointOf := func(server *httptest.Server) lm.Endpoint {
+		serverURL, _ := url.Parse(server.URL)
+		port, _ := strconv.Atoi(serverURL.Port())
+		return lm.Endpoint{Protocol: "http", Host: "127.0.0.1", Port: int32(port)}
+	}
+
+	psb := &proxyServerBuilder{
+		serverBuilder:    &serverBuilder{siteID: "site", domain: "loophole.site"},
+		endpoint:         endpointOf(grpc),
+		routes:           []lm.Route{{Prefix: "/api", Endpoint: endpointOf(api)}},
+		upstreamProtocol: lm.UpstreamProtocolH2C,
+	}
+	proxy := psb.newRoutingProxy()
+
+	for path, expected := range map[string]string{"/api/users": "api HTTP/1.1", "/service.Greeter/Hello": "grpc HTTP/2.0"} {
+		recorder := httptest.NewRecorder()
+		proxy.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		if recorder.Code != http.StatusOK || recorder.Body.String() != expected {
+			t.Fatalf("%s: unexpected response %d '%s', expected '%s'", path, recorder.Code, recorder.Body.String(), expected)
+		}
+	}
+}
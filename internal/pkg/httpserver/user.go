@@ -0,0 +1,24 @@
+package httpserver
+
+import (
+	"context"
+	"net/http"
+)
+
+type contextKey string
+
+const userContextKey contextKey = "user"
+
+// withUser stores name of the authenticated user in the request context and the access log entry
+func withUser(r *http.Request, user string) *http.Request {
+	if entry, ok := r.Context().Value(accessLogContextKey).(*accessLogEntry); ok {
+		entry.User = user
+	}
+	return r.WithContext(context.WithValue(r.Context(), userContextKey, user))
+}
+
+// userFromRequest returns name of the authenticated user or empty string for anonymous requests
+func userFromRequest(r *http.Request) string {
+	user, _ := r.Context().Value(userContextKey).(string)
+	return user
+}
@@ -0,0 +1,257 @@
+// Package logfiles manages log files written by each loophole invocation
+package logfiles
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// TimeFormat is used in log file names, so that each invocation gets its own file
+const TimeFormat = "2006-01-02--15-04-05"
+
+const (
+	logExtension        = ".log"
+	compressedExtension = ".gz"
+)
+
+// recentlyWritten is how long after the last write the log is assumed to be used by another running invocation
+const recentlyWritten = time.Hour
+
+// FileName returns name of the log file for session started at given time
+func FileName(started time.Time) string {
+	return started.Format(TimeFormat) + logExtension
+}
+
+// Session is a log file written by single loophole invocation
+type Session struct {
+	// Name is the session start time as used in the file name, e.g. '2006-01-02--15-04-05'
+	Name       string
+	Path       string
+	Started    time.Time
+	Modified   time.Time
+	Size       int64
+	Compressed bool
+}
+
+// Is returns whether the session is the log file at given path, paths are compared cleaned,
+// as they may be joined with different separators
+func (s *Session) Is(path string) bool {
+	return filepath.Clean(s.Path) == filepath.Clean(path)
+}
+
+// Open returns reader of the log, decompressing it when needed
+func (s *Session) Open() (io.ReadCloser, error) {
+	file, err := os.Open(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	if !s.Compressed {
+		return file, nil
+	}
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &compressedLog{Reader: reader, file: file}, nil
+}
+
+type compressedLog struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (l *compressedLog) Close() error {
+	l.Reader.Close()
+	return l.file.Close()
+}
+
+// List returns log sessions found in the directory, most recent first
+func List(directory string) ([]*Session, error) {
+	files, err := ioutil.ReadDir(directory)
+	if err != nil {
+		return nil, err
+	}
+	sessions := []*Session{}
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		name := file.Name()
+		compressed := strings.HasSuffix(name, compressedExtension)
+		name = strings.TrimSuffix(name, compressedExtension)
+		if !strings.HasSuffix(name, logExtension) {
+			continue
+		}
+		name = strings.TrimSuffix(name, logExtension)
+		started, err := time.ParseInLocation(TimeFormat, name, time.Local)
+		if err != nil {
+			continue
+		}
+		sessions = append(sessions, &Session{
+			Name:       name,
+			Path:       filepath.Join(directory, file.Name()),
+			Started:    started,
+			Modified:   file.ModTime(),
+			Size:       file.Size(),
+			Compressed: compressed,
+		})
+	}
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return sessions[i].Started.After(sessions[j].Started)
+	})
+	return sessions, nil
+}
+
+// Find returns the session with given name
+func Find(directory string, name string) (*Session, error) {
+	sessions, err := List(directory)
+	if err != nil {
+		return nil, err
+	}
+	name = strings.TrimSuffix(strings.TrimSuffix(filepath.Base(name), compressedExtension), logExtension)
+	for _, session := range sessions {
+		if session.Name == name {
+			return session, nil
+		}
+	}
+	return nil, fmt.Errorf("Log session '%s' not found", name)
+}
+
+// RetentionPolicy limits log files kept, zero values mean no limit
+type RetentionPolicy struct {
+	MaxAge       time.Duration
+	MaxCount     int
+	MaxTotalSize int64
+}
+
+// ApplyRetention compresses logs of previous sessions and removes the ones over the limits of the policy,
+// starting with the oldest, log of the current session is left untouched and recently written logs,
+// which may belong to other running invocations, are neither compressed nor removed;
+// failing to clean up one log doesn't stop the others from being cleaned up
+func ApplyRetention(directory string, policy RetentionPolicy, now time.Time, currentPath string) error {
+	sessions, err := List(directory)
+	if err != nil {
+		return err
+	}
+	count := 0
+	var totalSize int64
+	failures := []string{}
+	for _, session := range sessions {
+		if session.Is(currentPath) {
+			continue
+		}
+		count++
+		if now.Sub(session.Modified) <= recentlyWritten {
+			totalSize += session.Size
+			continue
+		}
+		if policy.MaxAge > 0 && now.Sub(session.Started) > policy.MaxAge ||
+			policy.MaxCount > 0 && count > policy.MaxCount {
+			if err := os.Remove(session.Path); err != nil {
+				failures = append(failures, err.Error())
+			}
+			continue
+		}
+		if !session.Compressed {
+			if err := compress(session); err != nil {
+				failures = append(failures, err.Error())
+			}
+		}
+		totalSize += session.Size
+		if policy.MaxTotalSize > 0 && totalSize > policy.MaxTotalSize {
+			if err := os.Remove(session.Path); err != nil {
+				failures = append(failures, err.Error())
+			}
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("Failed to clean up %d log files: %s", len(failures), strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// compress replaces the log file with gzipped one
+func compress(session *Session) error {
+	source, err := os.Open(session.Path)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	compressedPath := session.Path + compressedExtension
+	target, err := os.OpenFile(compressedPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	writer := gzip.NewWriter(target)
+	_, err = io.Copy(writer, source)
+	if err == nil {
+		err = writer.Close()
+	}
+	if closeErr := target.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(compressedPath)
+		return err
+	}
+	source.Close()
+	if err := os.Remove(session.Path); err != nil {
+		return err
+	}
+
+	// keep time of the last write, so that the logs can be told apart from running ones
+	os.Chtimes(compressedPath, session.Modified, session.Modified)
+	info, err := os.Stat(compressedPath)
+	if err != nil {
+		return err
+	}
+	session.Path = compressedPath
+	session.Size = info.Size()
+	session.Compressed = true
+	return nil
+}
+
+// Filter selects log lines written by zerolog
+type Filter struct {
+	TunnelID string
+	// Level is the minimum level of the lines
+	Level   zerolog.Level
+	Pattern *regexp.Regexp
+}
+
+type logLine struct {
+	Level    string `json:"level"`
+	TunnelID string `json:"tunnelId"`
+}
+
+// Match returns whether the line passes the filter
+func (f *Filter) Match(line []byte) bool {
+	if f.Pattern != nil && !f.Pattern.Match(line) {
+		return false
+	}
+	if f.TunnelID == "" && f.Level <= zerolog.DebugLevel {
+		return true
+	}
+	var parsed logLine
+	if err := json.Unmarshal(line, &parsed); err != nil {
+		return false
+	}
+	if f.TunnelID != "" && parsed.TunnelID != f.TunnelID {
+		return false
+	}
+	level, err := zerolog.ParseLevel(parsed.Level)
+	return err == nil && level >= f.Level
+}
@@ -0,0 +1,134 @@
+package logfiles
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func writeSession(t *testing.T, directory string, started time.Time, content string) string {
+	path := filepath.Join(directory, FileName(started))
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(path, started, started)
+	return path
+}
+
+func TestApplyRetention(t *testing.T) {
+	directory, err := ioutil.TempDir("", "loophole-logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+
+	now := time.Now().Truncate(time.Second)
+	current := writeSession(t, directory, now, "current\n")
+	writeSession(t, directory, now.Add(-10*time.Minute), "running\n")
+	writeSession(t, directory, now.Add(-2*time.Hour), "previous\n")
+	writeSession(t, directory, now.Add(-3*time.Hour), "older\n")
+	writeSession(t, directory, now.Add(-48*time.Hour), "expired\n")
+	ioutil.WriteFile(filepath.Join(directory, "unrelated.txt"), []byte{}, 0600)
+
+	err = ApplyRetention(directory, RetentionPolicy{MaxAge: 24 * time.Hour, MaxCount: 3}, now, current)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sessions, err := List(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, session := range sessions {
+		names = append(names, filepath.Base(session.Path))
+	}
+	expected := []string{
+		FileName(now),
+		FileName(now.Add(-10 * time.Minute)),
+		FileName(now.Add(-2*time.Hour)) + ".gz",
+		FileName(now.Add(-3*time.Hour)) + ".gz",
+	}
+	if strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Fatalf("Log files %v are different than expected: %v", names, expected)
+	}
+
+	reader, err := sessions[2].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	content, _ := ioutil.ReadAll(reader)
+	if string(content) != "previous\n" {
+		t.Fatalf("Compressed log contains %q", content)
+	}
+}
+
+func TestApplyRetentionKeepsRecentlyWrittenLogs(t *testing.T) {
+	directory, err := ioutil.TempDir("", "loophole-logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+
+	now := time.Now().Truncate(time.Second)
+	// current session may be quiet for longer than other running ones are assumed to be
+	current := writeSession(t, directory, now.Add(-49*time.Hour), "current\n")
+	running := writeSession(t, directory, now.Add(-48*time.Hour), "running for two days\n")
+	os.Chtimes(running, now, now)
+	writeSession(t, directory, now.Add(-72*time.Hour), "expired\n")
+
+	policies := []RetentionPolicy{
+		{MaxAge: 24 * time.Hour},
+		{MaxCount: 1},
+		{MaxTotalSize: 1},
+	}
+	for _, policy := range policies {
+		// current log path isn't cleaned the way the listed ones are
+		err = ApplyRetention(directory, policy, now, directory+"/./"+FileName(now.Add(-49*time.Hour)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, path := range []string{current, running} {
+			if _, err := os.Stat(path); err != nil {
+				t.Fatalf("Current or recently written log was cleaned up with policy %+v: %v", policy, err)
+			}
+		}
+	}
+	sessions, _ := List(directory)
+	if len(sessions) != 2 {
+		t.Fatalf("Expired log of finished session wasn't removed, %d sessions left", len(sessions))
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	lines := []string{
+		`{"level":"debug","tunnelId":"a","message":"connected"}`,
+		`{"level":"warn","tunnelId":"a","message":"upstream down"}`,
+		`{"level":"error","tunnelId":"b","message":"upstream down"}`,
+		`not a log line`,
+	}
+	tests := []struct {
+		filter   Filter
+		expected []bool
+	}{
+		{Filter{}, []bool{true, true, true, true}},
+		{Filter{TunnelID: "a"}, []bool{true, true, false, false}},
+		{Filter{Level: zerolog.WarnLevel}, []bool{false, true, true, false}},
+		{Filter{Pattern: regexp.MustCompile("upstream")}, []bool{false, true, true, false}},
+		{Filter{TunnelID: "b", Pattern: regexp.MustCompile("down")}, []bool{false, false, true, false}},
+	}
+	for _, test := range tests {
+		for i, line := range lines {
+			if test.filter.Match([]byte(line)) != test.expected[i] {
+				t.Errorf("Filter %+v matching %s should return %v", test.filter, line, test.expected[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,52 @@
+// Package metrics keeps process wide counters, reported periodically in tunnel logs
+package metrics
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// Counter is monotonically increasing value
+type Counter struct {
+	value int64
+}
+
+// Inc increments the counter by one
+func (c *Counter) Inc() {
+	atomic.AddInt64(&c.value, 1)
+}
+
+// Add increments the counter by given value
+func (c *Counter) Add(delta int64) {
+	atomic.AddInt64(&c.value, delta)
+}
+
+// Value returns current value of the counter
+func (c *Counter) Value() int64 {
+	return atomic.LoadInt64(&c.value)
+}
+
+var registry = struct {
+	counters map[string]*Counter
+	mutex    sync.Mutex
+}{
+	counters: map[string]*Counter{},
+}
+
+// GetCounter returns counter registered under given name, creating it on first use
+func GetCounter(name string) *Counter {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	counter, ok := registry.counters[name]
+	if !ok {
+		counter = &Counter{}
+		registry.counters[name] = counter
+	}
+	return counter
+}
+
+// GetSiteCounter returns counter of given name for the site, e.g. requests_rate_limited{site="mysite"}
+func GetSiteCounter(name string, siteID string) *Counter {
+	return GetCounter(fmt.Sprintf("%s{site=%q}", name, siteID))
+}
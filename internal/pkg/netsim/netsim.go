@@ -0,0 +1,146 @@
+// Package netsim simulates bad network conditions on tunneled connections
+package netsim
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	lm "github.com/loophole/cli/internal/app/loophole/models"
+	"github.com/loophole/cli/internal/pkg/bandwidth"
+)
+
+// maxResetDelay is the longest time after which connection chosen to be reset is closed
+const maxResetDelay = 10 * time.Second
+
+// burstGap is the pause after which next write starts new burst of data, delayed by the latency again;
+// writes within the burst follow the first one right away, so latency doesn't cap the throughput
+const burstGap = 10 * time.Millisecond
+
+// presets are rough approximations of mobile networks, latency is one way
+var presets = map[string]lm.NetworkSimulationSpecs{
+	"2g": {Latency: 300 * time.Millisecond, Jitter: 100 * time.Millisecond, Bandwidth: 30 * 1000, ResetRate: 0.02},
+	"3g": {Latency: 100 * time.Millisecond, Jitter: 50 * time.Millisecond, Bandwidth: 200 * 1000, ResetRate: 0.01},
+	"4g": {Latency: 40 * time.Millisecond, Jitter: 15 * time.Millisecond, Bandwidth: 1500 * 1000, ResetRate: 0.002},
+}
+
+// Preset returns network simulation settings of given name
+func Preset(name string) (lm.NetworkSimulationSpecs, error) {
+	preset, ok := presets[strings.ToLower(name)]
+	if !ok {
+		return lm.NetworkSimulationSpecs{}, fmt.Errorf("Unknown network simulation preset '%s', available presets: %s", name, strings.Join(PresetNames(), ", "))
+	}
+	return preset, nil
+}
+
+// PresetNames returns names of all the available presets
+func PresetNames() []string {
+	names := []string{}
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Describe returns human readable summary of simulated conditions, e.g. 'latency 100ms ± 50ms, bandwidth 200.0 KB/s'
+func Describe(specs lm.NetworkSimulationSpecs) string {
+	conditions := []string{}
+	if specs.Latency > 0 || specs.Jitter > 0 {
+		conditions = append(conditions, fmt.Sprintf("latency %s ± %s", specs.Latency, specs.Jitter))
+	}
+	if specs.Bandwidth > 0 {
+		conditions = append(conditions, fmt.Sprintf("bandwidth %s/s", bandwidth.FormatSize(specs.Bandwidth)))
+	}
+	if specs.ResetRate > 0 {
+		conditions = append(conditions, fmt.Sprintf("%g%% of connections reset", specs.ResetRate*100))
+	}
+	return strings.Join(conditions, ", ")
+}
+
+// Simulator applies the same network conditions to every connection of the tunnel
+type Simulator struct {
+	specs  lm.NetworkSimulationSpecs
+	random *rand.Rand
+	mutex  sync.Mutex
+}
+
+// New creates simulator, returning nil when no simulation is configured
+func New(specs lm.NetworkSimulationSpecs) *Simulator {
+	if !specs.Enabled() {
+		return nil
+	}
+	return &Simulator{
+		specs:  specs,
+		random: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// delay returns latency with random jitter applied
+func (s *Simulator) delay() time.Duration {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delay := s.specs.Latency
+	if s.specs.Jitter > 0 {
+		delay += time.Duration(s.random.Int63n(int64(2*s.specs.Jitter)+1)) - s.specs.Jitter
+	}
+	if delay < 0 {
+		return 0
+	}
+	return delay
+}
+
+// resetDelay decides whether connection should be reset and after how long
+func (s *Simulator) resetDelay() (time.Duration, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.specs.ResetRate <= 0 || s.random.Float64() >= s.specs.ResetRate {
+		return 0, false
+	}
+	return time.Duration(s.random.Int63n(int64(maxResetDelay))), true
+}
+
+// ScheduleReset closes the connection after random time if it was chosen to be reset
+func (s *Simulator) ScheduleReset(conn io.Closer) (time.Duration, bool) {
+	if s == nil {
+		return 0, false
+	}
+	delay, reset := s.resetDelay()
+	if reset {
+		time.AfterFunc(delay, func() { conn.Close() })
+	}
+	return delay, reset
+}
+
+// Writer wraps the writer delaying every burst of writes by the latency and limiting its bandwidth
+func (s *Simulator) Writer(w io.Writer) io.Writer {
+	if s == nil {
+		return w
+	}
+	return &writer{
+		w:         w,
+		simulator: s,
+		limiter:   bandwidth.NewLimiter(s.specs.Bandwidth),
+	}
+}
+
+type writer struct {
+	w         io.Writer
+	simulator *Simulator
+	limiter   *bandwidth.Limiter
+	lastWrite time.Time
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if time.Since(w.lastWrite) >= burstGap {
+		time.Sleep(w.simulator.delay())
+	}
+	w.limiter.Wait(len(p))
+	n, err := w.w.Write(p)
+	w.lastWrite = time.Now()
+	return n, err
+}
@@ -0,0 +1,65 @@
+package netsim
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	lm "github.com/loophole/cli/internal/app/loophole/models"
+)
+
+func TestPreset(t *testing.T) {
+	preset, err := Preset("3G")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if preset.Latency != 100*time.Millisecond {
+		t.Fatalf("Latency %s is different than expected: %s", preset.Latency, 100*time.Millisecond)
+	}
+	if _, err := Preset("carrier-pigeon"); err == nil {
+		t.Fatalf("Expected error for unknown preset")
+	}
+}
+
+func TestDelayStaysWithinJitter(t *testing.T) {
+	simulator := New(lm.NetworkSimulationSpecs{Latency: 100 * time.Millisecond, Jitter: 20 * time.Millisecond})
+	for i := 0; i < 1000; i++ {
+		if delay := simulator.delay(); delay < 80*time.Millisecond || delay > 120*time.Millisecond {
+			t.Fatalf("Delay %s is out of expected range", delay)
+		}
+	}
+}
+
+func TestResetRate(t *testing.T) {
+	always := New(lm.NetworkSimulationSpecs{ResetRate: 1})
+	if delay, reset := always.resetDelay(); !reset || delay >= maxResetDelay {
+		t.Fatalf("Connection should be reset within %s, got %t after %s", maxResetDelay, reset, delay)
+	}
+	if New(lm.NetworkSimulationSpecs{}) != nil {
+		t.Fatalf("Simulator without any conditions should be disabled")
+	}
+}
+
+func TestWriterDelaysBurstsNotEveryWrite(t *testing.T) {
+	simulator := New(lm.NetworkSimulationSpecs{Latency: 50 * time.Millisecond})
+	writer := simulator.Writer(ioutil.Discard)
+
+	started := time.Now()
+	for i := 0; i < 100; i++ {
+		writer.Write([]byte("chunk"))
+	}
+	elapsed := time.Since(started)
+	if elapsed < 50*time.Millisecond {
+		t.Fatalf("First write of the burst wasn't delayed: %s", elapsed)
+	}
+	if elapsed > time.Second {
+		t.Fatalf("Writes within the burst were delayed, 100 writes took %s", elapsed)
+	}
+
+	time.Sleep(2 * burstGap)
+	started = time.Now()
+	writer.Write([]byte("next burst"))
+	if elapsed := time.Since(started); elapsed < 50*time.Millisecond {
+		t.Fatalf("Write after a pause wasn't delayed: %s", elapsed)
+	}
+}
@@ -0,0 +1,136 @@
+// Package proxyprotocol implements minimal PROXY protocol (version 1) support, used to pass
+// the address of the client reported by the gateway through the local hop between tunnel and local server
+package proxyprotocol
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maximal length of PROXY protocol v1 header, including CRLF
+	maxHeaderLength = 107
+	headerTimeout   = 10 * time.Second
+)
+
+// ErrInvalidHeader is returned when connection doesn't start with valid PROXY protocol header
+var ErrInvalidHeader = errors.New("invalid PROXY protocol header")
+
+// WriteHeader writes PROXY protocol v1 header describing given source and destination addresses
+func WriteHeader(conn net.Conn, source net.Addr, destination net.Addr) error {
+	_, err := conn.Write([]byte(header(source, destination)))
+	return err
+}
+
+func header(source net.Addr, destination net.Addr) string {
+	sourceAddr, sourceOk := source.(*net.TCPAddr)
+	destinationAddr, destinationOk := destination.(*net.TCPAddr)
+	if !sourceOk || !destinationOk || sourceAddr.IP == nil || destinationAddr.IP == nil {
+		return "PROXY UNKNOWN\r\n"
+	}
+	family := "TCP4"
+	if sourceAddr.IP.To4() == nil || destinationAddr.IP.To4() == nil {
+		family = "TCP6"
+	}
+	return fmt.Sprintf("PROXY %s %s %s %d %d\r\n", family,
+		sourceAddr.IP.String(), destinationAddr.IP.String(), sourceAddr.Port, destinationAddr.Port)
+}
+
+// NewListener wraps the listener so that remote address of accepted connections is read from PROXY protocol header
+func NewListener(listener net.Listener) net.Listener {
+	return &proxyListener{Listener: listener}
+}
+
+type proxyListener struct {
+	net.Listener
+}
+
+func (l *proxyListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &proxyConn{
+		Conn:   conn,
+		reader: bufio.NewReader(conn),
+	}, nil
+}
+
+// proxyConn reads the header lazily, so that slow client is not blocking the accept loop
+type proxyConn struct {
+	net.Conn
+	reader     *bufio.Reader
+	once       sync.Once
+	remoteAddr net.Addr
+	headerErr  error
+}
+
+func (c *proxyConn) readHeader() {
+	c.once.Do(func() {
+		c.Conn.SetReadDeadline(time.Now().Add(headerTimeout))
+		defer c.Conn.SetReadDeadline(time.Time{})
+
+		c.remoteAddr, c.headerErr = parseHeader(c.reader)
+		if c.headerErr != nil {
+			c.Conn.Close()
+		}
+	})
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	c.readHeader()
+	if c.headerErr != nil {
+		return 0, c.headerErr
+	}
+	return c.reader.Read(b)
+}
+
+func (c *proxyConn) RemoteAddr() net.Addr {
+	c.readHeader()
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+func parseHeader(reader *bufio.Reader) (net.Addr, error) {
+	line := make([]byte, 0, maxHeaderLength)
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+		if len(line) >= maxHeaderLength {
+			return nil, ErrInvalidHeader
+		}
+	}
+	if !strings.HasSuffix(string(line), "\r\n") {
+		return nil, ErrInvalidHeader
+	}
+	fields := strings.Fields(string(line))
+	if len(fields) < 2 || fields[0] != "PROXY" {
+		return nil, ErrInvalidHeader
+	}
+	if fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, ErrInvalidHeader
+	}
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.Atoi(fields[4])
+	if ip == nil || err != nil || port < 0 || port > 65535 {
+		return nil, ErrInvalidHeader
+	}
+	return &net.TCPAddr{IP: ip, Port: port}, nil
+}
@@ -0,0 +1,65 @@
+package proxyprotocol
+
+import (
+	"io/ioutil"
+	"net"
+	"testing"
+)
+
+func TestListenerExposesClientAddressFromHeader(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxyListener := NewListener(listener)
+	defer proxyListener.Close()
+
+	go func() {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		source := &net.TCPAddr{IP: net.ParseIP("203.0.113.7"), Port: 51234}
+		destination := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 80}
+		WriteHeader(conn, source, destination)
+		conn.Write([]byte("payload"))
+	}()
+
+	conn, err := proxyListener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	expectedAddr := "203.0.113.7:51234"
+	if conn.RemoteAddr().String() != expectedAddr {
+		t.Fatalf("Remote address '%s' is different than expected: '%s'", conn.RemoteAddr().String(), expectedAddr)
+	}
+	payload, err := ioutil.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(payload) != "payload" {
+		t.Fatalf("Payload '%s' is different than expected: 'payload'", payload)
+	}
+}
+
+func TestHeaderFormatsIPv6Addresses(t *testing.T) {
+	source := &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 443}
+	destination := &net.TCPAddr{IP: net.ParseIP("::1"), Port: 80}
+	expected := "PROXY TCP6 2001:db8::1 ::1 443 80\r\n"
+
+	if result := header(source, destination); result != expected {
+		t.Fatalf("Header '%s' is different than expected: '%s'", result, expected)
+	}
+}
+
+func TestHeaderFallsBackToUnknownForNonTCPAddresses(t *testing.T) {
+	source := &net.UnixAddr{Name: "/tmp/socket", Net: "unix"}
+	destination := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 80}
+
+	if result := header(source, destination); result != "PROXY UNKNOWN\r\n" {
+		t.Fatalf("Header '%s' is different than expected: 'PROXY UNKNOWN'", result)
+	}
+}
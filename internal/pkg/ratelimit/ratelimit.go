@@ -0,0 +1,150 @@
+// Package ratelimit implements token bucket rate limiting, globally and per key (e.g. client IP)
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// idleBucketTTL is how long bucket of key which is not seen anymore is kept in memory
+const idleBucketTTL = 10 * time.Minute
+
+// ParseRate parses rate in '<number>r/s', '<number>r/m' or '<number>r/h' format
+// (plain number means per second) and returns it in requests per second
+func ParseRate(value string) (float64, error) {
+	number := strings.TrimSpace(value)
+	unit := time.Second
+	if index := strings.Index(number, "r/"); index >= 0 {
+		switch number[index+2:] {
+		case "s":
+			unit = time.Second
+		case "m":
+			unit = time.Minute
+		case "h":
+			unit = time.Hour
+		default:
+			return 0, fmt.Errorf("Invalid rate '%s', expected unit is r/s, r/m or r/h", value)
+		}
+		number = number[:index]
+	}
+	requests, err := strconv.ParseFloat(number, 64)
+	if err != nil || requests <= 0 {
+		return 0, fmt.Errorf("Invalid rate '%s', expected positive number of requests, e.g. 10r/s", value)
+	}
+	return requests / unit.Seconds(), nil
+}
+
+// FormatRate formats rate given in requests per second, as accepted by ParseRate
+func FormatRate(rate float64) string {
+	return strconv.FormatFloat(rate, 'f', -1, 64) + "r/s"
+}
+
+// Bucket is a token bucket refilled with rate tokens per second, holding at most burst tokens
+type Bucket struct {
+	rate     float64
+	burst    float64
+	tokens   float64
+	lastSeen time.Time
+	mutex    sync.Mutex
+}
+
+// NewBucket creates full bucket, burst lower than 1 defaults to the rate rounded up
+func NewBucket(rate float64, burst int, now time.Time) *Bucket {
+	capacity := float64(burst)
+	if burst < 1 {
+		capacity = math.Max(1, math.Ceil(rate))
+	}
+	return &Bucket{
+		rate:     rate,
+		burst:    capacity,
+		tokens:   capacity,
+		lastSeen: now,
+	}
+}
+
+// Take consumes a token, returning false and time after which the token will be available
+// if the bucket is empty
+func (b *Bucket) Take(now time.Time) (bool, time.Duration) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if elapsed := now.Sub(b.lastSeen).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed*b.rate)
+	}
+	b.lastSeen = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	missing := (1 - b.tokens) / b.rate
+	return false, time.Duration(missing * float64(time.Second))
+}
+
+// Refund puts back the token taken for request which was rejected for another reason
+func (b *Bucket) Refund() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.tokens = math.Min(b.burst, b.tokens+1)
+}
+
+// KeyedLimiter keeps separate bucket for every key
+type KeyedLimiter struct {
+	rate        float64
+	burst       int
+	buckets     map[string]*Bucket
+	lastCleanup time.Time
+	mutex       sync.Mutex
+}
+
+// NewKeyedLimiter creates limiter with the same rate and burst for every key
+func NewKeyedLimiter(rate float64, burst int) *KeyedLimiter {
+	return &KeyedLimiter{
+		rate:    rate,
+		burst:   burst,
+		buckets: map[string]*Bucket{},
+	}
+}
+
+// Take consumes a token from the bucket of given key
+func (l *KeyedLimiter) Take(key string, now time.Time) (bool, time.Duration) {
+	l.mutex.Lock()
+	if now.Sub(l.lastCleanup) > idleBucketTTL {
+		l.cleanup(now)
+	}
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = NewBucket(l.rate, l.burst, now)
+		l.buckets[key] = bucket
+	}
+	l.mutex.Unlock()
+
+	return bucket.Take(now)
+}
+
+// Refund puts back the token taken from the bucket of given key
+func (l *KeyedLimiter) Refund(key string) {
+	l.mutex.Lock()
+	bucket, ok := l.buckets[key]
+	l.mutex.Unlock()
+	if ok {
+		bucket.Refund()
+	}
+}
+
+// cleanup forgets buckets not used for a while, they would be full by now anyway
+func (l *KeyedLimiter) cleanup(now time.Time) {
+	for key, bucket := range l.buckets {
+		bucket.mutex.Lock()
+		idle := now.Sub(bucket.lastSeen) > idleBucketTTL
+		bucket.mutex.Unlock()
+		if idle {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastCleanup = now
+}
@@ -0,0 +1,69 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRate(t *testing.T) {
+	testCases := []struct {
+		value    string
+		expected float64
+		valid    bool
+	}{
+		{"10r/s", 10, true},
+		{"60r/m", 1, true},
+		{"7200r/h", 2, true},
+		{"5", 5, true},
+		{"0.5r/s", 0.5, true},
+		{"10r/d", 0, false},
+		{"-1r/s", 0, false},
+		{"fast", 0, false},
+	}
+
+	for _, testCase := range testCases {
+		rate, err := ParseRate(testCase.value)
+		if (err == nil) != testCase.valid {
+			t.Fatalf("Parsing '%s' returned unexpected error: %v", testCase.value, err)
+		}
+		if rate != testCase.expected {
+			t.Fatalf("Rate %f parsed from '%s' is different than expected: %f", rate, testCase.value, testCase.expected)
+		}
+	}
+}
+
+func TestBucketAllowsBurstAndRefills(t *testing.T) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	bucket := NewBucket(2, 3, now)
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := bucket.Take(now); !ok {
+			t.Fatalf("Request %d within burst was rejected", i+1)
+		}
+	}
+	ok, retryAfter := bucket.Take(now)
+	if ok {
+		t.Fatalf("Request over burst was allowed")
+	}
+	if retryAfter != 500*time.Millisecond {
+		t.Fatalf("Retry after %s is different than expected: %s", retryAfter, 500*time.Millisecond)
+	}
+	if ok, _ := bucket.Take(now.Add(500 * time.Millisecond)); !ok {
+		t.Fatalf("Request after refill was rejected")
+	}
+}
+
+func TestKeyedLimiterSeparatesKeys(t *testing.T) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	limiter := NewKeyedLimiter(1, 1)
+
+	if ok, _ := limiter.Take("203.0.113.1", now); !ok {
+		t.Fatalf("First request of the first client was rejected")
+	}
+	if ok, _ := limiter.Take("203.0.113.1", now); ok {
+		t.Fatalf("Second request of the first client was allowed")
+	}
+	if ok, _ := limiter.Take("203.0.113.2", now); !ok {
+		t.Fatalf("First request of the second client was rejected")
+	}
+}
@@ -0,0 +1,75 @@
+package sharelink
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+type downloadCount struct {
+	Count     int   `json:"count"`
+	ExpiresAt int64 `json:"exp"`
+}
+
+// Downloads counts file downloads made with each link, saving the counts to the file
+// so that download limits survive tunnel restarts the same way the signing key does
+type Downloads struct {
+	path   string
+	counts map[string]downloadCount
+	mutex  sync.Mutex
+}
+
+// LoadDownloads reads download counts from the file, forgetting links which already expired
+func LoadDownloads(path string) (*Downloads, error) {
+	downloads := &Downloads{
+		path:   path,
+		counts: map[string]downloadCount{},
+	}
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return downloads, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	counts := map[string]downloadCount{}
+	if err := json.Unmarshal(content, &counts); err != nil {
+		return nil, err
+	}
+	now := time.Now().Unix()
+	for id, count := range counts {
+		if count.ExpiresAt > now {
+			downloads.counts[id] = count
+		}
+	}
+	return downloads, nil
+}
+
+// Register counts download made with the link, returning false when its limit is already reached
+func (d *Downloads) Register(claims *Claims) (bool, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	count := d.counts[claims.ID]
+	if count.Count >= claims.MaxDownloads {
+		return false, nil
+	}
+	count.Count++
+	count.ExpiresAt = claims.ExpiresAt
+	d.counts[claims.ID] = count
+	return true, d.save()
+}
+
+// save replaces the file at once, so that interrupted write doesn't reset the counts
+func (d *Downloads) save() error {
+	content, err := json.Marshal(d.counts)
+	if err != nil {
+		return err
+	}
+	temporaryPath := d.path + ".tmp"
+	if err := ioutil.WriteFile(temporaryPath, content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(temporaryPath, d.path)
+}
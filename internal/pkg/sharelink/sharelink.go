@@ -0,0 +1,104 @@
+// Package sharelink implements HMAC signed, time limited tokens used in share links
+package sharelink
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+const keyLength = 32
+
+var (
+	// ErrInvalidToken is returned when token is malformed or its signature doesn't match
+	ErrInvalidToken = errors.New("invalid share link token")
+	// ErrExpiredToken is returned when token is past its expiry date
+	ErrExpiredToken = errors.New("share link token expired")
+)
+
+// Claims are the values protected by the token signature
+type Claims struct {
+	ID           string `json:"id"`
+	ExpiresAt    int64  `json:"exp"`
+	Path         string `json:"path,omitempty"`
+	MaxDownloads int    `json:"max,omitempty"`
+}
+
+// NewClaims creates claims for link valid for given duration, with random ID
+func NewClaims(ttl time.Duration, path string, maxDownloads int) Claims {
+	id := make([]byte, 12)
+	rand.Read(id)
+	return Claims{
+		ID:           base64.RawURLEncoding.EncodeToString(id),
+		ExpiresAt:    time.Now().Add(ttl).Unix(),
+		Path:         path,
+		MaxDownloads: maxDownloads,
+	}
+}
+
+// Sign produces '<payload>.<signature>' token for the claims
+func Sign(key []byte, claims Claims) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	encodedPayload := base64.RawURLEncoding.EncodeToString(payload)
+	return encodedPayload + "." + base64.RawURLEncoding.EncodeToString(signature(key, encodedPayload)), nil
+}
+
+// Verify checks token signature and expiry, returning claims of valid token
+func Verify(key []byte, token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return nil, ErrInvalidToken
+	}
+	tokenSignature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(tokenSignature, signature(key, parts[0])) {
+		return nil, ErrInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, ErrExpiredToken
+	}
+	return &claims, nil
+}
+
+// LoadOrCreateKey reads signing key from the file, generating new one if the file doesn't exist,
+// so that links stay valid when the tunnel is restarted
+func LoadOrCreateKey(path string) ([]byte, error) {
+	key, err := ioutil.ReadFile(path)
+	if err == nil && len(key) == keyLength {
+		return key, nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	key = make([]byte, keyLength)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(path, key, 0600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func signature(key []byte, payload string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
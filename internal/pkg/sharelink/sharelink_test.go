@@ -0,0 +1,108 @@
+package sharelink
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var testKey = []byte("0123456789abcdef0123456789abcdef")
+
+func TestSignedTokenVerifies(t *testing.T) {
+	claims := NewClaims(time.Hour, "/reports", 1)
+	token, err := Sign(testKey, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verified, err := Verify(testKey, token)
+	if err != nil {
+		t.Fatalf("Unexpected error returned: %v", err)
+	}
+	if *verified != claims {
+		t.Fatalf("Verified claims %+v are different than expected: %+v", *verified, claims)
+	}
+}
+
+func TestTamperedTokenIsRejected(t *testing.T) {
+	token, err := Sign(testKey, NewClaims(time.Hour, "/reports", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherToken, err := Sign(testKey, NewClaims(time.Hour, "/", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := otherToken[:len(otherToken)-43] + token[len(token)-43:]
+
+	if _, err := Verify(testKey, tampered); err != ErrInvalidToken {
+		t.Fatalf("Error '%v' is different than expected: '%v'", err, ErrInvalidToken)
+	}
+	if _, err := Verify([]byte("another-key-another-key-another!!"), token); err != ErrInvalidToken {
+		t.Fatalf("Error '%v' is different than expected: '%v'", err, ErrInvalidToken)
+	}
+}
+
+func TestExpiredTokenIsRejected(t *testing.T) {
+	token, err := Sign(testKey, NewClaims(-time.Minute, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Verify(testKey, token); err != ErrExpiredToken {
+		t.Fatalf("Error '%v' is different than expected: '%v'", err, ErrExpiredToken)
+	}
+}
+
+func TestLoadOrCreateKeyPersistsKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sharelink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "share-links.key")
+
+	created, err := LoadOrCreateKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadOrCreateKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(created) != string(loaded) {
+		t.Fatalf("Loaded key is different than created one")
+	}
+}
+
+func TestDownloadsSurviveReload(t *testing.T) {
+	countsFile := filepath.Join(t.TempDir(), "downloads.json")
+	claims := NewClaims(time.Hour, "", 2)
+	expiredClaims := NewClaims(-time.Minute, "", 2)
+
+	downloads, err := LoadDownloads(countsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []*Claims{&claims, &expiredClaims} {
+		if registered, err := downloads.Register(c); !registered || err != nil {
+			t.Fatalf("First download wasn't registered: %v", err)
+		}
+	}
+
+	reloaded, err := LoadDownloads(countsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := reloaded.counts[expiredClaims.ID]; ok {
+		t.Fatal("Count of expired link was kept")
+	}
+	if registered, _ := reloaded.Register(&claims); !registered {
+		t.Fatal("Second download was rejected")
+	}
+	if registered, _ := reloaded.Register(&claims); registered {
+		t.Fatal("Download over the limit was registered after reload")
+	}
+}
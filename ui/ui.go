@@ -25,7 +25,11 @@ import (
 	"github.com/loophole/cli/internal/pkg/token"
 )
 
+// websocketQueueSize is number of log messages waiting for the window, so that it can't stall the tunnels
+const websocketQueueSize = 256
+
 var upgrader = websocket.Upgrader{} // use default options
+
 var authQuitChannel = make(chan bool)
 var authAlreadyRan = false
 
@@ -39,7 +43,8 @@ func websocketHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	defer c.Close()
-	communication.SetCommunicationMechanism(communication.NewWebsocketLogger(c))
+	removeSink := communication.AddSink(communication.Sink{Mechanism: communication.NewWebsocketLogger(c), QueueSize: websocketQueueSize})
+	defer removeSink()
 	loggedIn := token.IsTokenSaved()
 	idToken := token.GetIdToken()
 	communication.ApplicationStart(loggedIn, idToken)
@@ -75,6 +80,12 @@ func websocketHandler(w http.ResponseWriter, r *http.Request) {
 						fmt.Errorf("Tunnel '%s' is already running", exposeHTTPConfig.Remote.SiteID))
 					return
 				}
+				if exposeHTTPConfig.Local.WaitForUpstream {
+					if err := loophole.WaitForUpstream(exposeHTTPConfig, tunnelQuitChannel); err != nil {
+						communication.TunnelStartFailure(exposeHTTPConfig.Remote.TunnelID, err)
+						return
+					}
+				}
 				authMethod, err := loophole.RegisterTunnel(&exposeHTTPConfig.Remote)
 				if err != nil {
 					communication.TunnelStartFailure(exposeHTTPConfig.Remote.TunnelID, err)
@@ -239,6 +250,9 @@ var box embed.FS
 
 // Display shows the main app window
 func Display() {
+	// failures are shown in the window, they shouldn't stop the application
+	communication.SetSinks(communication.Sink{Mechanism: communication.NewStdOutLogger(false)})
+
 	chromeLocation := lorca.LocateChrome()
 	if chromeLocation == "" {
 		message := "Chrome/Chromium >= 70 is required."